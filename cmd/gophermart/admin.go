@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// createAdmin saves a new user with the admin role. An existing login is an error, so nobody can get the role
+// by registering an admin login before an operator.
+func createAdmin(ctx context.Context, store storage, hasher *security.PasswordHasher, policy *security.CredentialsPolicy, login string, password string) error {
+	err := policy.Check(login, password)
+	if err != nil {
+		return fmt.Errorf("admin credentials break registration rules, err: %w", err)
+	}
+	passwordHash, err := hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("cant hash an admin password, err: %w", err)
+	}
+	_, err = store.SaveUser(ctx, login, passwordHash, "")
+	if errors.Is(err, gophermart_errors.MakeErrUserAlreadyExists()) {
+		return fmt.Errorf("login `%s` is already taken, an admin can be created only as a new user", login)
+	} else if err != nil {
+		return fmt.Errorf("cant save an admin, err: %w", err)
+	}
+	err = store.GrantRole(ctx, login, entities.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("user `%s` is created, but the admin role isn`t granted, err: %w", login, err)
+	}
+	return nil
+}
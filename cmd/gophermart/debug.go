@@ -0,0 +1,36 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+)
+
+// newDebugServer makes a server for an internal address, which serves expvar metrics at /debug/vars.
+func newDebugServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", debugVarsHandler)
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
+
+// debugVarsHandler writes expvar vars like expvar.Handler does, but without cmdline,
+// because flags may hold secrets (a db conn str, jwt keys).
+func debugVarsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
@@ -9,14 +10,27 @@ import (
 	"time"
 	"yandex_gophermart/config"
 	"yandex_gophermart/internal/app/accrualdaemon"
+	"yandex_gophermart/internal/app/archiver"
 	"yandex_gophermart/internal/app/handlers"
+	"yandex_gophermart/internal/app/loginguard"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/internal/app/notifier"
+	"yandex_gophermart/internal/app/outbox"
+	"yandex_gophermart/internal/app/storagemw"
 	"yandex_gophermart/pkg/databases"
+	"yandex_gophermart/pkg/security"
 )
 
+// passwordResetQueueSize is how many password reset notices may wait for a delivery.
+const passwordResetQueueSize = 1000
+
 func main() {
 	//conf
 	cfg := config.Config{}
-	cfg.Configure()
+	err := cfg.Configure()
+	if err != nil {
+		log.Fatalf("Cant configure, err: %v", err)
+	}
 
 	//logger set
 	zCfg := zap.NewProductionConfig()
@@ -32,47 +46,285 @@ func main() {
 	}
 	sugar := logger.Sugar()
 
+	mainCtx, cancelMainCtx := context.WithCancel(context.Background())
+	defer cancelMainCtx()
+
 	//db set
-	pg, err := databases.NewPostgresql(cfg.DBConnStr)
+	pg, err := openStorage(mainCtx, cfg, sugar)
 	if err != nil {
 		sugar.Fatalf("cant start database, err: %v", err.Error())
 	}
-	err = pg.SetTables()
+	defer pg.Close()
+	err = pg.SetTables(mainCtx)
 	if err != nil {
 		sugar.Fatalf("error while setting tables in database, err: %v", err.Error())
 	}
 	sugar.Infof("db started")
 
-	//shutdown server if db won`t response
-	mainCtx, cancelMainCtx := context.WithCancel(context.Background())
+	//password hashing
+	hasher, err := security.NewPasswordHasher(security.PasswordHashSettings{
+		Algorithm:     cfg.PasswordHashAlgorithm,
+		Argon2Time:    uint32(cfg.PasswordArgon2Time),
+		Argon2Memory:  uint32(cfg.PasswordArgon2Memory),
+		Argon2Threads: uint8(cfg.PasswordArgon2Threads),
+		BcryptCost:    cfg.PasswordBcryptCost,
+	})
+	if err != nil {
+		sugar.Fatalf("wrong password hash settings, err: %v", err.Error())
+	}
+	pg.SetPasswordHasher(hasher)
+
+	//registration rules, bcrypt limits passwords in bytes
+	passwordMaxBytes := 0
+	if cfg.PasswordHashAlgorithm == security.PasswordHashBcrypt {
+		passwordMaxBytes = security.BcryptMaxPasswordBytes
+	}
+	credentialsPolicy, err := security.NewCredentialsPolicy(security.CredentialsPolicySettings{
+		LoginMinLength:         cfg.LoginMinLength,
+		LoginMaxLength:         cfg.LoginMaxLength,
+		PasswordMinLength:      cfg.PasswordMinLength,
+		PasswordMaxLength:      cfg.PasswordMaxLength,
+		PasswordMaxBytes:       passwordMaxBytes,
+		PasswordMinCharClasses: cfg.PasswordMinCharClasses,
+		RejectCommonPasswords:  cfg.RejectCommonPasswords,
+	})
+	if err != nil {
+		sugar.Fatalf("wrong registration rules, err: %v", err.Error())
+	}
+
+	//an operator creates an admin and the app exits
+	if cfg.CreateAdminLogin != "" {
+		err = createAdmin(mainCtx, pg, hasher, credentialsPolicy, cfg.CreateAdminLogin, cfg.CreateAdminPassword)
+		if err != nil {
+			sugar.Fatalf("cant create an admin, err: %v", err.Error())
+		}
+		sugar.Infof("admin `%s` is created", cfg.CreateAdminLogin)
+		return
+	}
+
+	//jwt
+	if len(cfg.JWTKeys) == 0 {
+		sugar.Warnf("jwt keys are not set, a random one is used, so tokens won`t be valid after a restart")
+	}
+	jwtHelper, err := security.NewJWTHelper(security.JWTSettings{
+		Keys:         cfg.JWTKeys,
+		SigningKeyID: cfg.JWTSigningKeyID,
+		TTL:          cfg.JWTTTL,
+	})
+	if err != nil {
+		sugar.Fatalf("wrong jwt settings, err: %v", err.Error())
+	}
+
+	//storage decorators
+	var appStorage storagemw.StorageInt = pg
+	var interceptors []storagemw.Interceptor
+	if cfg.StorageTracing != "" {
+		tracer, shutdownTracing, err := setupTracing(cfg.StorageTracing)
+		if err != nil {
+			sugar.Fatalf("cant start tracing, err: %v", err.Error())
+		}
+		defer shutdownTracing(context.Background())
+		interceptors = append(interceptors, storagemw.Tracing(tracer))
+	}
+	if cfg.StorageMetrics {
+		interceptors = append(interceptors, storagemw.Metrics("storage"))
+	}
+	if cfg.StorageSlowQueryThreshold > 0 {
+		interceptors = append(interceptors, storagemw.SlowLog(sugar, cfg.StorageSlowQueryThreshold))
+	}
+	if cfg.StorageRetries > 0 {
+		interceptors = append(interceptors, storagemw.Retry(cfg.StorageRetries, cfg.StorageRetryDelay, databases.IsTransientError))
+	}
+	if len(interceptors) > 0 {
+		appStorage = storagemw.Decorate(appStorage, interceptors...)
+	}
+
+	//balance cache
+	if cfg.BalanceCacheSize > 0 {
+		appStorage = storagemw.NewBalanceCache(appStorage, cfg.BalanceCacheSize, cfg.BalanceCacheTTL)
+		sugar.Infof("balance cache is used")
+	}
+
+	//revoked access tokens cache
+	if cfg.RevocationCacheSize > 0 {
+		appStorage = storagemw.NewRevocationCache(appStorage, cfg.RevocationCacheSize, cfg.RevocationCacheTTL)
+	}
+
+	//failed login limits
+	var guardStorage loginguard.StorageInt
+	switch cfg.LoginGuardBackend {
+	case "memory":
+		guardStorage = loginguard.NewMemoryStorage()
+	case "db":
+		guardStorage = pg
+	case "":
+		sugar.Warnf("failed login limits are disabled")
+	default:
+		sugar.Fatalf("unknown login guard backend `%s`", cfg.LoginGuardBackend)
+	}
+	var loginGuard *loginguard.Guard
+	var routerLoginGuard handlers.LoginGuardInt
+	if guardStorage != nil {
+		loginGuard = loginguard.NewGuard(guardStorage,
+			loginguard.Policy{
+				Threshold: cfg.LoginMaxFailures,
+				BaseDelay: cfg.LoginFailureDelay,
+				MaxDelay:  cfg.LoginMaxFailureDelay,
+				Lockout:   cfg.LoginLockout,
+				Window:    cfg.LoginFailureWindow,
+			},
+			loginguard.Policy{
+				Threshold: cfg.LoginIPMaxFailures,
+				Lockout:   cfg.LoginLockout,
+				Window:    cfg.LoginFailureWindow,
+			})
+		routerLoginGuard = loginGuard
+	}
+
+	//password reset notifications
+	var resetNotifier handlers.PasswordResetNotifierInt
+	switch cfg.PasswordResetNotifier {
+	case "log":
+		resetNotifier = notifier.NewLogNotifier(sugar)
+		sugar.Warnf("password reset tokens are written to the log, it is for local use only")
+	case "file":
+		fileNotifier, err := notifier.NewFileNotifier(cfg.PasswordResetFilePath)
+		if err != nil {
+			sugar.Fatalf("cant start a password reset file notifier, err: %v", err.Error())
+		}
+		defer fileNotifier.Close()
+		resetNotifier = fileNotifier
+	case "":
+		sugar.Infof("password reset notifier is not set, password resets are disabled")
+	default:
+		sugar.Fatalf("unknown password reset notifier `%s`", cfg.PasswordResetNotifier)
+	}
+
+	//watch db availability, requests changing data are rejected while it is down
 	wg := sync.WaitGroup{}
+	healthMonitor := storagemw.NewHealthMonitor(pg, sugar)
 	wg.Add(1)
-	go func(ctx context.Context, cancelMainCtxFunc context.CancelFunc, wg *sync.WaitGroup) {
+	go healthMonitor.Run(mainCtx, cfg.DBPingInterval, cfg.DBReconnectMaxBackoff, &wg)
+
+	//password reset notices are delivered in the background, so a response doesn`t show if a login exists
+	if resetNotifier != nil {
+		asyncNotifier := notifier.NewAsyncNotifier(resetNotifier, sugar, passwordResetQueueSize)
+		wg.Add(1)
+		go asyncNotifier.Run(mainCtx, &wg)
+		resetNotifier = asyncNotifier
+	}
+
+	//remove expired idempotency keys, tokens, failed login counters and published outbox events
+	wg.Add(1)
+	go func(ctx context.Context, wg *sync.WaitGroup) {
 		defer wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			default:
-				dbErr := pg.Ping()
-				if dbErr != nil {
-					sugar.Errorf("DB ping error (shutting down a server...), err: %v", dbErr.Error())
-					cancelMainCtxFunc()
-					return
+			case <-ticker.C:
+				deleted, err := pg.DeleteExpiredIdempotencyKeys(ctx, cfg.IdempotencyKeyTTL)
+				if err != nil {
+					sugar.Errorf("cant delete expired idempotency keys, err: %v", err.Error())
+				} else {
+					sugar.Debugf("expired idempotency keys deleted: %d", deleted)
+				}
+				deleted, err = pg.DeleteExpiredTokens(ctx)
+				if err != nil {
+					sugar.Errorf("cant delete expired tokens, err: %v", err.Error())
 				} else {
-					time.Sleep(time.Second * 3)
+					sugar.Debugf("expired tokens deleted: %d", deleted)
+				}
+				if cfg.OutboxRetention > 0 {
+					deleted, err = pg.DeletePublishedEvents(ctx, time.Now().Add(-cfg.OutboxRetention))
+					if err != nil {
+						sugar.Errorf("cant delete published outbox events, err: %v", err.Error())
+					} else {
+						sugar.Debugf("published outbox events deleted: %d", deleted)
+					}
+				}
+				if loginGuard != nil {
+					deleted, err = loginGuard.DeleteExpired(ctx)
+					if err != nil {
+						sugar.Errorf("cant delete expired failed login counters, err: %v", err.Error())
+					} else {
+						sugar.Debugf("expired failed login counters deleted: %d", deleted)
+					}
 				}
 			}
 		}
-	}(mainCtx, cancelMainCtx, &wg)
+	}(mainCtx, &wg)
 
 	//start an accrual daemon
 	wg.Add(1)
-	go accrualdaemon.AccrualCheckDaemon(mainCtx, sugar, pg, cfg.AccrualSystemAddress, &wg)
+	go accrualdaemon.AccrualCheckDaemon(mainCtx, sugar, appStorage, cfg.AccrualSystemAddress, &wg)
 	sugar.Infof("starting an accrual daemon")
 
+	//start an outbox relay
+	var sink outbox.Sink
+	switch cfg.OutboxSink {
+	case "file":
+		fileSink, err := outbox.NewFileSink(cfg.OutboxFilePath)
+		if err != nil {
+			sugar.Fatalf("cant start an outbox file sink, err: %v", err.Error())
+		}
+		defer fileSink.Close()
+		sink = fileSink
+	case "webhook":
+		sink = outbox.NewWebhookSink(cfg.OutboxWebhookURL)
+	case "":
+		sugar.Infof("outbox sink is not set, events won`t be published")
+	default:
+		sugar.Fatalf("unknown outbox sink `%s`", cfg.OutboxSink)
+	}
+	if sink != nil {
+		wg.Add(1)
+		go outbox.RelayDaemon(mainCtx, sugar, pg, sink, cfg.OutboxPollInterval, cfg.OutboxBatchSize, &wg)
+		sugar.Infof("starting an outbox relay")
+	}
+
+	//start an archiver
+	if cfg.ArchiveAfter > 0 {
+		wg.Add(1)
+		go archiver.ArchiverDaemon(mainCtx, sugar, pg, cfg.ArchiveAfter, cfg.ArchiveInterval, cfg.ArchiveBatchSize, &wg)
+		sugar.Infof("starting an archiver")
+	}
+
 	//router set and server start
-	router := handlers.NewRouter(*sugar, pg, cfg.AccrualSystemAddress)
+	router := handlers.NewRouter(handlers.RouterDeps{
+		Logger:               *sugar,
+		Storage:              appStorage,
+		IdempotencyStorage:   pg,
+		Health:               healthMonitor,
+		Hasher:               hasher,
+		Credentials:          credentialsPolicy,
+		LoginGuard:           routerLoginGuard,
+		Notifier:             resetNotifier,
+		JWTHelper:            jwtHelper,
+		AccrualSystemAddress: cfg.AccrualSystemAddress,
+		Idempotency: middlewares.IdempotencySettings{
+			TTL:   cfg.IdempotencyKeyTTL,
+			Lease: cfg.IdempotencyKeyLease,
+		},
+		Auth: handlers.AuthSettings{
+			AccessTokenTTL:        cfg.JWTTTL,
+			RefreshTokenTTL:       cfg.RefreshTokenTTL,
+			PasswordResetTokenTTL: cfg.PasswordResetTokenTTL,
+			Cookies: handlers.CookieSettings{
+				Secure:   cfg.CookieSecure,
+				SameSite: cfg.CookieSameSite,
+				Domain:   cfg.CookieDomain,
+			},
+			APIKeyRateLimit: cfg.APIKeyRateLimit,
+			PasswordResetLimits: handlers.RequestLimits{
+				PerLogin: cfg.PasswordResetLoginLimit,
+				PerIP:    cfg.PasswordResetIPLimit,
+				Window:   cfg.PasswordResetLimitWindow,
+			},
+		},
+	})
 	sugar.Infof("starting server")
 	server := &http.Server{
 		Addr:    cfg.RunAddress,
@@ -84,11 +336,30 @@ func main() {
 		sugar.Fatalf("Cant run a server, err: %v", server.ListenAndServe().Error())
 	}(&wg)
 
+	//metrics are served only on an internal address, they aren`t a part of the public api
+	var debugServer *http.Server
+	if cfg.DebugAddress != "" {
+		debugServer = newDebugServer(cfg.DebugAddress)
+		wg.Add(1)
+		go func(wg *sync.WaitGroup) {
+			defer wg.Done()
+			errDebug := debugServer.ListenAndServe()
+			if !errors.Is(errDebug, http.ErrServerClosed) {
+				sugar.Fatalf("Cant run a debug server, err: %v", errDebug.Error())
+			}
+		}(&wg)
+	}
+
 	//shutdown server when context is cancelled
 	wg.Add(1)
 	go func(ctx context.Context, wg *sync.WaitGroup) {
 		defer wg.Done()
 		<-ctx.Done() //program will wait here
+		if debugServer != nil {
+			if errSh := debugServer.Shutdown(context.Background()); errSh != nil {
+				sugar.Errorf("cant shutdown a debug server, err: %v", errSh.Error())
+			}
+		}
 		errSh := server.Shutdown(context.Background())
 		if errSh != nil {
 			sugar.Fatalf("Tryed to shutdown server carefully, but got en error. Shutting down with Fatalf(). Err: %v", errSh.Error())
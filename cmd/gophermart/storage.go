@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+	"yandex_gophermart/config"
+	"yandex_gophermart/internal/app/accrualdaemon"
+	"yandex_gophermart/internal/app/archiver"
+	"yandex_gophermart/internal/app/handlers"
+	"yandex_gophermart/internal/app/loginguard"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/internal/app/outbox"
+	"yandex_gophermart/pkg/databases"
+	"yandex_gophermart/pkg/security"
+)
+
+// storage is implemented by every storage backend.
+type storage interface {
+	handlers.StorageInt
+	accrualdaemon.UnfinishedOrdersStorageInt
+	middlewares.RevokedTokensStorageInt
+	middlewares.APIKeyStorageInt
+	middlewares.IdempotencyStorageInt
+	outbox.OutboxStorageInt
+	archiver.ArchiveStorageInt
+	loginguard.StorageInt
+	SetPasswordHasher(hasher *security.PasswordHasher)
+	SetLogger(logger *zap.SugaredLogger)
+	GrantRole(ctx context.Context, login string, role string) error
+	Ping(ctx context.Context) error
+	SetTables(ctx context.Context) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error)
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+	DeletePublishedEvents(ctx context.Context, olderThan time.Time) (int64, error)
+	Close()
+}
+
+// openStorage chooses a storage backend by DATABASE_URI scheme: "sqlite://" is SQLite, everything else is PostgreSQL.
+func openStorage(ctx context.Context, cfg config.Config, sugar *zap.SugaredLogger) (storage, error) {
+	if strings.HasPrefix(cfg.DBConnStr, databases.SQLiteScheme+":") {
+		sugar.Infof("sqlite storage is used")
+		lite, err := databases.NewSQLite(ctx, cfg.DBConnStr)
+		if err != nil {
+			return nil, err
+		}
+		lite.SetLogger(sugar)
+		return lite, nil
+	}
+
+	poolSettings := databases.PoolSettings{
+		MaxConns:           int32(cfg.DBMaxConns),
+		MinConns:           int32(cfg.DBMinConns),
+		MaxConnLifetime:    cfg.DBMaxConnLifetime,
+		HealthCheckPeriod:  cfg.DBHealthCheckPeriod,
+		StatementCacheMode: cfg.DBStatementCacheMode,
+	}
+	pg, err := databases.NewPostgresql(ctx, cfg.DBConnStr, poolSettings)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.SetTxSettings(databases.TxSettings{
+		Isolation:  cfg.DBTxIsolation,
+		MaxRetries: cfg.DBTxMaxRetries,
+		RetryDelay: cfg.DBTxRetryDelay,
+	})
+	if err != nil {
+		pg.Close()
+		return nil, err
+	}
+	pg.SetLogger(sugar)
+	pg.SetQueryTimeouts(databases.QueryTimeouts{
+		Default:   cfg.DBQueryTimeout,
+		PerMethod: cfg.DBQueryMethodTimeouts,
+	})
+	if cfg.DBReplicaConnStr != "" {
+		err = pg.UseReplica(ctx, databases.ReplicaSettings{
+			ConnStr:           cfg.DBReplicaConnStr,
+			MaxLag:            cfg.DBReplicaMaxLag,
+			PrimaryAfterWrite: cfg.DBReplicaPrimaryAfterWrite,
+		}, poolSettings)
+		if err != nil {
+			pg.Close()
+			return nil, err
+		}
+		sugar.Infof("read replica is used")
+	}
+	expvar.Publish("db_pool", expvar.Func(func() any {
+		return pg.Stats()
+	}))
+	return pg, nil
+}
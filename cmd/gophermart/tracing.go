@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+)
+
+const tracerName = "yandex_gophermart"
+
+// setupTracing makes a tracer, which writes spans as JSON to stdout or to a file.
+// The returned func flushes spans and should be called before exit.
+func setupTracing(target string) (trace.Tracer, func(ctx context.Context) error, error) {
+	var writer io.Writer = os.Stdout
+	var file *os.File
+	if target != "stdout" {
+		var err error
+		file, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cant open a traces file, err: %w", err)
+		}
+		writer = file
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cant create a traces exporter, err: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+
+	shutdown := func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}
+	return provider.Tracer(tracerName), shutdown, nil
+}
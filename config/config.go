@@ -1,8 +1,16 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/security"
 )
 
 type Config struct {
@@ -10,10 +18,126 @@ type Config struct {
 	AccrualSystemAddress string
 	DBConnStr            string
 	LogLevel             string
+
+	//db pool settings (zero values mean "pgxpool default")
+	DBMaxConns           int
+	DBMinConns           int
+	DBMaxConnLifetime    time.Duration
+	DBHealthCheckPeriod  time.Duration
+	DBStatementCacheMode string
+
+	//balance-changing transactions
+	DBTxIsolation  string
+	DBTxMaxRetries int
+	DBTxRetryDelay time.Duration
+
+	//storage call deadlines, per method ones override the default one (zero means "no limit")
+	DBQueryTimeout        time.Duration
+	DBQueryMethodTimeouts map[string]time.Duration
+	dbQueryMethodTimeouts string
+
+	//password hashing
+	PasswordHashAlgorithm string
+	PasswordArgon2Time    int
+	PasswordArgon2Memory  int
+	PasswordArgon2Threads int
+	PasswordBcryptCost    int
+
+	//registration rules
+	LoginMinLength         int
+	LoginMaxLength         int
+	PasswordMinLength      int
+	PasswordMaxLength      int
+	PasswordMinCharClasses int
+	RejectCommonPasswords  bool
+
+	//jwt keys by ids, tokens are signed with JWTSigningKeyID one
+	JWTKeys         map[string]string
+	jwtKeys         string
+	jwtKeysFile     string
+	JWTSigningKeyID string
+	JWTTTL          time.Duration
+	RefreshTokenTTL time.Duration
+
+	//password reset ("log", "file" or empty to disable resets)
+	PasswordResetNotifier string
+	PasswordResetFilePath string
+	PasswordResetTokenTTL time.Duration
+
+	//password reset requests per login and per IP in a window (zero disables a limit)
+	PasswordResetLoginLimit  int
+	PasswordResetIPLimit     int
+	PasswordResetLimitWindow time.Duration
+
+	//auth cookies attributes. The service serves plain http, so Secure is off by default,
+	//it should be enabled when clients reach the service over https
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	cookieSameSite string
+	CookieDomain   string
+
+	//access tokens denylist cache (zero size disables it)
+	RevocationCacheSize int
+	RevocationCacheTTL  time.Duration
+
+	//failed login limits ("memory", "db" or empty to disable them), zero max failures disables a limit
+	LoginGuardBackend    string
+	LoginMaxFailures     int
+	LoginFailureDelay    time.Duration
+	LoginMaxFailureDelay time.Duration
+	LoginLockout         time.Duration
+	LoginFailureWindow   time.Duration
+	LoginIPMaxFailures   int
+
+	//an admin, who is created by an operator, the app exits after that (a password is read from env only)
+	CreateAdminLogin    string
+	CreateAdminPassword string
+
+	//default requests per minute of a merchant api key
+	APIKeyRateLimit int
+
+	//db availability checks
+	DBPingInterval        time.Duration
+	DBReconnectMaxBackoff time.Duration
+
+	//read replica (empty conn str disables it)
+	DBReplicaConnStr           string
+	DBReplicaMaxLag            time.Duration
+	DBReplicaPrimaryAfterWrite time.Duration
+
+	IdempotencyKeyTTL   time.Duration
+	IdempotencyKeyLease time.Duration
+
+	//storage decorators (zero values disable them)
+	StorageRetries            int
+	StorageRetryDelay         time.Duration
+	StorageMetrics            bool
+	StorageTracing            string
+	StorageSlowQueryThreshold time.Duration
+
+	//internal listener for /debug/vars metrics (empty address disables it)
+	DebugAddress string
+
+	//balance cache (zero size disables it)
+	BalanceCacheSize int
+	BalanceCacheTTL  time.Duration
+
+	//outbox relay ("file", "webhook" or empty to disable it), published events are kept for OutboxRetention (0 is forever)
+	OutboxSink         string
+	OutboxFilePath     string
+	OutboxWebhookURL   string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxRetention    time.Duration
+
+	//archiver (zero ArchiveAfter disables it)
+	ArchiveAfter     time.Duration
+	ArchiveInterval  time.Duration
+	ArchiveBatchSize int
 }
 
 // Configure priority: 1 - Environment. 2 - Flags
-func (c *Config) Configure() {
+func (c *Config) Configure() error {
 	//env
 	runAddr, okRunAddr := os.LookupEnv("RUN_ADDRESS")
 	dbStr, okdbStr := os.LookupEnv("DATABASE_URI")
@@ -28,7 +152,7 @@ func (c *Config) Configure() {
 	}
 
 	if !okdbStr {
-		flag.StringVar(&c.DBConnStr, "d", "", "Db conn str")
+		flag.StringVar(&c.DBConnStr, "d", "", "Db conn str (postgres://... or sqlite:///path/to/file.db)")
 	} else {
 		c.DBConnStr = dbStr
 	}
@@ -46,4 +170,376 @@ func (c *Config) Configure() {
 	} else {
 		c.LogLevel = "debug"
 	}
+
+	//db pool
+	if err := intSetting(&c.DBMaxConns, "DB_MAX_CONNS", "db-max-conns", 0, "Max amount of connections in db pool"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.DBMinConns, "DB_MIN_CONNS", "db-min-conns", 0, "Min amount of connections in db pool"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.DBMaxConnLifetime, "DB_MAX_CONN_LIFETIME", "db-max-conn-lifetime", 0, "Max lifetime of a db connection"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.DBHealthCheckPeriod, "DB_HEALTH_CHECK_PERIOD", "db-health-check-period", 0, "Period of db pool health checks"); err != nil {
+		return err
+	}
+	stringSetting(&c.DBStatementCacheMode, "DB_STATEMENT_CACHE_MODE", "db-statement-cache-mode", "", "Statement cache mode: cache_statement, cache_describe, describe_exec, exec or simple_protocol")
+
+	//transactions
+	stringSetting(&c.DBTxIsolation, "DB_TX_ISOLATION", "db-tx-isolation", "serializable", "Isolation level of balance-changing transactions: serializable, repeatable_read or read_committed")
+	if err := intSetting(&c.DBTxMaxRetries, "DB_TX_MAX_RETRIES", "db-tx-max-retries", 5, "How many times a transaction is retried after a serialization failure or a deadlock"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.DBTxRetryDelay, "DB_TX_RETRY_DELAY", "db-tx-retry-delay", time.Millisecond*10, "Delay before the first transaction retry, doubled on every next one"); err != nil {
+		return err
+	}
+
+	//query timeouts
+	if err := durationSetting(&c.DBQueryTimeout, "DB_QUERY_TIMEOUT", "db-query-timeout", time.Second*10, "Default deadline of a storage call"); err != nil {
+		return err
+	}
+	stringSetting(&c.dbQueryMethodTimeouts, "DB_QUERY_TIMEOUTS", "db-query-timeouts", "", "Deadlines of storage methods, like `GetOrdersList=2s,UpdateOrder=1s`")
+
+	//password hashing
+	stringSetting(&c.PasswordHashAlgorithm, "PASSWORD_HASH_ALGORITHM", "password-hash-algorithm", security.DefaultPasswordHashSettings.Algorithm, "Algorithm for new password hashes: argon2id or bcrypt")
+	if err := intSetting(&c.PasswordArgon2Time, "PASSWORD_ARGON2_TIME", "password-argon2-time", int(security.DefaultPasswordHashSettings.Argon2Time), "Argon2id iterations"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordArgon2Memory, "PASSWORD_ARGON2_MEMORY", "password-argon2-memory", int(security.DefaultPasswordHashSettings.Argon2Memory), "Argon2id memory in KiB"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordArgon2Threads, "PASSWORD_ARGON2_THREADS", "password-argon2-threads", int(security.DefaultPasswordHashSettings.Argon2Threads), "Argon2id parallelism"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordBcryptCost, "PASSWORD_BCRYPT_COST", "password-bcrypt-cost", security.DefaultPasswordHashSettings.BcryptCost, "Bcrypt cost"); err != nil {
+		return err
+	}
+
+	//registration rules
+	if err := intSetting(&c.LoginMinLength, "LOGIN_MIN_LENGTH", "login-min-length", security.DefaultCredentialsPolicySettings.LoginMinLength, "Min login length"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.LoginMaxLength, "LOGIN_MAX_LENGTH", "login-max-length", security.DefaultCredentialsPolicySettings.LoginMaxLength, "Max login length"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordMinLength, "PASSWORD_MIN_LENGTH", "password-min-length", security.DefaultCredentialsPolicySettings.PasswordMinLength, "Min password length"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordMaxLength, "PASSWORD_MAX_LENGTH", "password-max-length", security.DefaultCredentialsPolicySettings.PasswordMaxLength, "Max password length (with bcrypt passwords are also limited to 72 bytes)"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordMinCharClasses, "PASSWORD_MIN_CHAR_CLASSES", "password-min-char-classes", security.DefaultCredentialsPolicySettings.PasswordMinCharClasses, "How many of lowercase letters, uppercase letters, digits and other symbols a password should have"); err != nil {
+		return err
+	}
+	if err := boolSetting(&c.RejectCommonPasswords, "PASSWORD_REJECT_COMMON", "password-reject-common", security.DefaultCredentialsPolicySettings.RejectCommonPasswords, "Reject passwords from the bundled list of common passwords"); err != nil {
+		return err
+	}
+
+	//jwt
+	stringSetting(&c.jwtKeys, "JWT_KEYS", "jwt-keys", "", "JWT signing keys, like `2024-01=secret1,2024-06=@/path/to/key.pem`")
+	stringSetting(&c.jwtKeysFile, "JWT_KEYS_FILE", "jwt-keys-file", "", "File with JWT signing keys, one `id=secret` per line")
+	stringSetting(&c.JWTSigningKeyID, "JWT_SIGNING_KEY_ID", "jwt-signing-key-id", "", "Id of a key new tokens are signed with (may be empty if there is one key)")
+	if err := durationSetting(&c.JWTTTL, "JWT_TTL", "jwt-ttl", time.Minute*15, "Access token (JWT) lifetime"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.RefreshTokenTTL, "REFRESH_TOKEN_TTL", "refresh-token-ttl", time.Hour*24*30, "Refresh token lifetime"); err != nil {
+		return err
+	}
+	stringSetting(&c.PasswordResetNotifier, "PASSWORD_RESET_NOTIFIER", "password-reset-notifier", "", "How password reset tokens are delivered: log, file or empty to disable resets")
+	stringSetting(&c.PasswordResetFilePath, "PASSWORD_RESET_FILE", "password-reset-file", "password_resets.jsonl", "File for the file password reset notifier")
+	if err := durationSetting(&c.PasswordResetTokenTTL, "PASSWORD_RESET_TOKEN_TTL", "password-reset-token-ttl", time.Minute*30, "Password reset token lifetime"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordResetLoginLimit, "PASSWORD_RESET_LOGIN_LIMIT", "password-reset-login-limit", 3, "Password reset requests of one login in a window (0 disables the limit)"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.PasswordResetIPLimit, "PASSWORD_RESET_IP_LIMIT", "password-reset-ip-limit", 20, "Password reset requests from one IP in a window (0 disables the limit)"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.PasswordResetLimitWindow, "PASSWORD_RESET_LIMIT_WINDOW", "password-reset-limit-window", time.Hour, "Window of password reset request limits"); err != nil {
+		return err
+	}
+	if err := boolSetting(&c.CookieSecure, "COOKIE_SECURE", "cookie-secure", false, "Send auth cookies over https only, enable it when the service is served over https (a proxy terminates TLS)"); err != nil {
+		return err
+	}
+	stringSetting(&c.cookieSameSite, "COOKIE_SAMESITE", "cookie-samesite", "strict", "SameSite attribute of auth cookies: strict, lax or none")
+	stringSetting(&c.CookieDomain, "COOKIE_DOMAIN", "cookie-domain", "", "Domain attribute of auth cookies, empty means the current host only")
+	if err := intSetting(&c.RevocationCacheSize, "REVOCATION_CACHE_SIZE", "revocation-cache-size", 10000, "Max amount of cached denylist answers, 0 disables the cache"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.RevocationCacheTTL, "REVOCATION_CACHE_TTL", "revocation-cache-ttl", time.Second*10, "How long a denylist answer is cached"); err != nil {
+		return err
+	}
+
+	//failed login limits
+	stringSetting(&c.LoginGuardBackend, "LOGIN_GUARD_BACKEND", "login-guard-backend", "memory", "Where failed logins are counted: memory, db or empty to disable limits")
+	if err := intSetting(&c.LoginMaxFailures, "LOGIN_MAX_FAILURES", "login-max-failures", 5, "Failed logins in a row, after which a login is locked (0 disables the limit)"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.LoginFailureDelay, "LOGIN_FAILURE_DELAY", "login-failure-delay", time.Second, "Delay after the first failed login of a login, doubled on every next one"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.LoginMaxFailureDelay, "LOGIN_MAX_FAILURE_DELAY", "login-max-failure-delay", time.Second*30, "Max delay after a failed login"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.LoginLockout, "LOGIN_LOCKOUT", "login-lockout", time.Minute*15, "How long a login or an IP is locked"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.LoginFailureWindow, "LOGIN_FAILURE_WINDOW", "login-failure-window", time.Minute*15, "Failed logins are counted in a row if there is less than this between them"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.LoginIPMaxFailures, "LOGIN_IP_MAX_FAILURES", "login-ip-max-failures", 50, "Failed logins in a row from one IP, after which it is locked (0 disables the limit)"); err != nil {
+		return err
+	}
+
+	//admins
+	stringSetting(&c.CreateAdminLogin, "CREATE_ADMIN_LOGIN", "create-admin", "", "Create a new user with this login and the admin role, then exit (the password is read from CREATE_ADMIN_PASSWORD)")
+	c.CreateAdminPassword = os.Getenv("CREATE_ADMIN_PASSWORD")
+
+	//merchants
+	if err := intSetting(&c.APIKeyRateLimit, "API_KEY_RATE_LIMIT", "api-key-rate-limit", 60, "Requests per minute of a merchant api key, if its own limit isn`t set"); err != nil {
+		return err
+	}
+
+	//db availability checks
+	if err := durationSetting(&c.DBPingInterval, "DB_PING_INTERVAL", "db-ping-interval", time.Second*3, "How often db availability is checked"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.DBReconnectMaxBackoff, "DB_RECONNECT_MAX_BACKOFF", "db-reconnect-max-backoff", time.Second*30, "Max delay between checks while db is unavailable"); err != nil {
+		return err
+	}
+
+	//read replica
+	stringSetting(&c.DBReplicaConnStr, "DATABASE_REPLICA_URI", "db-replica", "", "Read replica db conn str")
+	if err := durationSetting(&c.DBReplicaMaxLag, "DB_REPLICA_MAX_LAG", "db-replica-max-lag", time.Second*5, "Replica is not used while its lag is bigger"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.DBReplicaPrimaryAfterWrite, "DB_REPLICA_PRIMARY_AFTER_WRITE", "db-replica-primary-after-write", time.Second*5, "User`s reads go to the primary for this time after his write"); err != nil {
+		return err
+	}
+
+	if err := durationSetting(&c.IdempotencyKeyTTL, "IDEMPOTENCY_KEY_TTL", "idempotency-key-ttl", time.Hour*24, "How long idempotency keys are kept"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.IdempotencyKeyLease, "IDEMPOTENCY_KEY_LEASE", "idempotency-key-lease", time.Minute, "How long a request in progress holds its idempotency key, a key of a crashed request is free after it"); err != nil {
+		return err
+	}
+
+	//storage decorators
+	if err := intSetting(&c.StorageRetries, "STORAGE_RETRIES", "storage-retries", 0, "How many times a storage call is repeated after a transient connection error"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.StorageRetryDelay, "STORAGE_RETRY_DELAY", "storage-retry-delay", time.Millisecond*50, "Delay before the first storage call retry, doubled on every next one"); err != nil {
+		return err
+	}
+	if err := boolSetting(&c.StorageMetrics, "STORAGE_METRICS", "storage-metrics", false, "Publish storage calls latency and errors at /debug/vars of the debug listener"); err != nil {
+		return err
+	}
+	stringSetting(&c.StorageTracing, "STORAGE_TRACING", "storage-tracing", "", "Where to write storage tracing spans: stdout, a file path or empty to disable tracing")
+	if err := durationSetting(&c.StorageSlowQueryThreshold, "STORAGE_SLOW_QUERY_THRESHOLD", "storage-slow-query-threshold", 0, "Storage calls longer than this are logged"); err != nil {
+		return err
+	}
+	stringSetting(&c.DebugAddress, "DEBUG_ADDRESS", "debug-address", "", "Internal address for /debug/vars metrics, it mustn`t be reachable from outside (empty disables it)")
+
+	//balance cache
+	if err := intSetting(&c.BalanceCacheSize, "BALANCE_CACHE_SIZE", "balance-cache-size", 10000, "Max amount of cached balances (0 disables the cache)"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.BalanceCacheTTL, "BALANCE_CACHE_TTL", "balance-cache-ttl", time.Second*30, "How long a balance is cached"); err != nil {
+		return err
+	}
+
+	//outbox
+	stringSetting(&c.OutboxSink, "OUTBOX_SINK", "outbox-sink", "", "Where to publish domain events: file, webhook or empty to disable")
+	stringSetting(&c.OutboxFilePath, "OUTBOX_FILE", "outbox-file", "events.jsonl", "File for the file outbox sink")
+	stringSetting(&c.OutboxWebhookURL, "OUTBOX_WEBHOOK_URL", "outbox-webhook-url", "", "URL for the webhook outbox sink")
+	if err := durationSetting(&c.OutboxPollInterval, "OUTBOX_POLL_INTERVAL", "outbox-poll-interval", time.Second, "How often outbox is checked for new events"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.OutboxBatchSize, "OUTBOX_BATCH_SIZE", "outbox-batch-size", 100, "Max amount of events published at once"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.OutboxRetention, "OUTBOX_RETENTION", "outbox-retention", time.Hour*24*7, "Published events older than this are deleted (0 keeps them forever)"); err != nil {
+		return err
+	}
+
+	//archiver
+	if err := durationSetting(&c.ArchiveAfter, "ARCHIVE_AFTER", "archive-after", 0, "Finished orders and withdrawals older than this are moved to archive tables (0 disables archiving)"); err != nil {
+		return err
+	}
+	if err := durationSetting(&c.ArchiveInterval, "ARCHIVE_INTERVAL", "archive-interval", time.Hour, "How often old rows are archived"); err != nil {
+		return err
+	}
+	if err := intSetting(&c.ArchiveBatchSize, "ARCHIVE_BATCH_SIZE", "archive-batch-size", 1000, "Max amount of rows moved to an archive at once"); err != nil {
+		return err
+	}
+
+	flag.Parse()
+
+	var err error
+	c.DBQueryMethodTimeouts, err = parseDurationMap(c.dbQueryMethodTimeouts)
+	if err != nil {
+		return fmt.Errorf("cant parse storage method timeouts, err: %w", err)
+	}
+	c.JWTKeys, err = readJWTKeys(c.jwtKeys, c.jwtKeysFile)
+	if err != nil {
+		return fmt.Errorf("cant read jwt keys, err: %w", err)
+	}
+	c.CookieSameSite, err = parseSameSite(c.cookieSameSite)
+	if err != nil {
+		return err
+	}
+	if c.CookieSameSite == http.SameSiteNoneMode && !c.CookieSecure {
+		return errors.New("cookies with SameSite=None should be secure")
+	}
+	if (c.PasswordResetLoginLimit > 0 || c.PasswordResetIPLimit > 0) && c.PasswordResetLimitWindow <= 0 {
+		return errors.New("password reset limit window should be positive")
+	}
+	if c.APIKeyRateLimit <= 0 {
+		return errors.New("api key rate limit should be positive")
+	}
+	if c.IdempotencyKeyLease <= 0 || c.IdempotencyKeyLease > c.IdempotencyKeyTTL {
+		return errors.New("idempotency key lease should be positive and not longer than the key ttl")
+	}
+	if c.OutboxSink == "webhook" {
+		webhookURL, err := url.Parse(c.OutboxWebhookURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return fmt.Errorf("OUTBOX_WEBHOOK_URL should be an http(s) url for the webhook outbox sink, got `%s`", c.OutboxWebhookURL)
+		}
+	}
+	if c.OutboxRetention < 0 {
+		return errors.New("outbox retention should not be negative")
+	}
+	if c.CreateAdminLogin != "" && c.CreateAdminPassword == "" {
+		return errors.New("CREATE_ADMIN_PASSWORD should be set to create an admin")
+	}
+	return nil
+}
+
+// stringSetting takes a value from environment if it is set, otherwise registers a flag for it.
+func stringSetting(target *string, envName string, flagName string, defaultValue string, usage string) {
+	if val, ok := os.LookupEnv(envName); ok {
+		*target = val
+		return
+	}
+	flag.StringVar(target, flagName, defaultValue, usage)
+}
+
+// intSetting takes a value from environment if it is set, otherwise registers a flag for it.
+func intSetting(target *int, envName string, flagName string, defaultValue int, usage string) error {
+	if val, ok := os.LookupEnv(envName); ok {
+		parsed, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("cant parse %s, err: %w", envName, err)
+		}
+		*target = parsed
+		return nil
+	}
+	flag.IntVar(target, flagName, defaultValue, usage)
+	return nil
+}
+
+// boolSetting takes a value from environment if it is set, otherwise registers a flag for it.
+func boolSetting(target *bool, envName string, flagName string, defaultValue bool, usage string) error {
+	if val, ok := os.LookupEnv(envName); ok {
+		parsed, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("cant parse %s, err: %w", envName, err)
+		}
+		*target = parsed
+		return nil
+	}
+	flag.BoolVar(target, flagName, defaultValue, usage)
+	return nil
+}
+
+// durationSetting takes a value from environment if it is set, otherwise registers a flag for it.
+func durationSetting(target *time.Duration, envName string, flagName string, defaultValue time.Duration, usage string) error {
+	if val, ok := os.LookupEnv(envName); ok {
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("cant parse %s, err: %w", envName, err)
+		}
+		*target = parsed
+		return nil
+	}
+	flag.DurationVar(target, flagName, defaultValue, usage)
+	return nil
+}
+
+// readJWTKeys merges keys from a "id=secret,..." string and from a file with one "id=secret" per line.
+// Empty lines and lines starting with "#" are skipped in a file. A "@path" secret is read from a file (used for PEM keys).
+func readJWTKeys(val string, filePath string) (map[string]string, error) {
+	keys := make(map[string]string)
+	pairs := strings.Split(val, ",")
+	if filePath != "" {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+				pairs = append(pairs, line)
+			}
+		}
+	}
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, errors.New("a key should look like `id=secret`")
+		}
+		id = strings.TrimSpace(id)
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("key `%s` is set twice", id)
+		}
+		secret = strings.TrimSpace(secret)
+		if path, ok := strings.CutPrefix(secret, "@"); ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cant read key `%s`, err: %w", id, err)
+			}
+			secret = string(data)
+		}
+		keys[id] = secret
+	}
+	return keys, nil
+}
+
+func parseSameSite(val string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(val)) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite value `%s`, should be strict, lax or none", val)
+	}
+}
+
+// parseDurationMap parses "name=duration" pairs, separated by commas. Empty pairs are skipped.
+func parseDurationMap(val string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration)
+	for _, pair := range strings.Split(val, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, durationStr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("`%s` should look like `name=duration`", pair)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(durationStr))
+		if err != nil {
+			return nil, err
+		}
+		durations[strings.TrimSpace(name)] = duration
+	}
+	return durations, nil
 }
@@ -18,6 +18,9 @@ import (
 const (
 	dbWaitLong  = time.Second * 7
 	dbWaitShort = time.Millisecond * 100
+
+	//accrual system status, which has no match in our statuses
+	accrualStatusRegistered = "REGISTERED"
 )
 
 type UnfinishedOrdersStorageInt interface {
@@ -50,9 +53,15 @@ func AccrualCheckDaemon(ctx context.Context, logger *zap.SugaredLogger, storage
 
 			var err error
 			orders, err = storage.GetUnfinishedOrdersList(ctx)
+			if ctx.Err() != nil {
+				return
+			}
 			if err != nil {
+				//db may be down for a while, so try again later instead of stopping
 				logger.Errorf("cant get unfinished orders from db, err: %v", err.Error())
-				return
+				orders = orders[:0]
+				waitBeforeNewDBRequest = dbWaitLong
+				continue
 			}
 			i = 0
 
@@ -87,6 +96,9 @@ func AccrualCheckDaemon(ctx context.Context, logger *zap.SugaredLogger, storage
 					//update an order in db
 					order := orders[i]
 					order.Status = data.Status
+					if order.Status == accrualStatusRegistered {
+						order.Status = entities.OrderStatusProcessing
+					}
 					order.Accrual = data.Accrual
 					err = storage.UpdateOrder(ctx, order)
 					if err != nil {
@@ -0,0 +1,53 @@
+package archiver
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type ArchiveStorageInt interface {
+	ArchiveOrders(ctx context.Context, olderThan time.Time, batchSize int) (int64, error)
+	ArchiveWithdrawals(ctx context.Context, olderThan time.Time, batchSize int) (int64, error)
+}
+
+// ArchiverDaemon moves finished orders and withdrawals, which are older than "after", to archive tables.
+// Rows are moved in batches, so tables are not locked for a long time.
+func ArchiverDaemon(ctx context.Context, logger *zap.SugaredLogger, storage ArchiveStorageInt, after time.Duration, interval time.Duration, batchSize int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	logger.Infof("Archiver started")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			olderThan := time.Now().Add(-after)
+			orders, err := archiveAll(ctx, storage.ArchiveOrders, olderThan, batchSize)
+			if err != nil {
+				logger.Errorf("cant archive orders, err: %v", err.Error())
+			}
+			withdrawals, err := archiveAll(ctx, storage.ArchiveWithdrawals, olderThan, batchSize)
+			if err != nil {
+				logger.Errorf("cant archive withdrawals, err: %v", err.Error())
+			}
+			logger.Debugf("archived orders: %d, withdrawals: %d", orders, withdrawals)
+		}
+	}
+}
+
+// archiveAll moves batches until there is nothing to move, returns an amount of moved rows.
+func archiveAll(ctx context.Context, archive func(ctx context.Context, olderThan time.Time, batchSize int) (int64, error), olderThan time.Time, batchSize int) (int64, error) {
+	var total int64
+	for {
+		moved, err := archive(ctx, olderThan, batchSize)
+		total += moved
+		if err != nil || moved < int64(batchSize) || ctx.Err() != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"net/http"
+	"strings"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	g_errors "yandex_gophermart/pkg/errors"
+)
+
+const maxAdjustmentReasonLength = 500
+
+type adminUserResponse struct {
+	entities.UserInfo
+	Balance entities.BalanceData `json:"balance"`
+}
+
+type balanceAdjustmentRequest struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+// adminID takes an id of an admin from request.ctx, responds with 401 if there is no id.
+func (h *Handler) adminID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	adminID, ok := r.Context().Value(middlewares.UserIDContextKey).(int)
+	if !ok {
+		h.Logger.Debugf("admin id wasn`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	return adminID, ok
+}
+
+// audit saves an admin action, which was done outside of a storage transaction. An action isn`t reported
+// as successful if it wasn`t audited, so it responds with an error status and returns false on failure.
+func (h *Handler) audit(w http.ResponseWriter, r *http.Request, record entities.AdminAuditRecord) bool {
+	err := h.Storage.SaveAdminAuditRecord(r.Context(), record)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return false
+	} else if err != nil {
+		h.Logger.Errorf("cant save an audit record of `%s` by admin %d, err: %v", record.Action, record.AdminID, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// findUser finds a user from a "login" route param, responds with 400/404/5xx if it can`t.
+func (h *Handler) findUser(w http.ResponseWriter, r *http.Request) (entities.UserInfo, bool) {
+	login := chi.URLParam(r, "login")
+	if login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return entities.UserInfo{}, false
+	}
+
+	user, err := h.Storage.GetUserByLogin(r.Context(), login)
+	if errors.Is(err, g_errors.MakeErrUserNotFound()) {
+		h.Logger.Debugf("user `%s` not found", login)
+		w.WriteHeader(http.StatusNotFound)
+		return user, false
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return user, false
+	} else if err != nil {
+		h.Logger.Errorf("cant find user `%s`, err: %v", login, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return user, false
+	}
+	return user, true
+}
+
+// AdminGetUserHandler returns a user with roles and a balance.
+func (h *Handler) AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	user, ok := h.findUser(w, r)
+	if !ok {
+		return
+	}
+
+	balance, err := h.Storage.GetBalance(r.Context(), user.ID)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant get balance of user %d, err: %v", user.ID, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !h.audit(w, r, entities.AdminAuditRecord{
+		AdminID:      adminID,
+		Action:       entities.AuditActionUserLookup,
+		TargetUserID: user.ID,
+		Details:      map[string]string{"login": user.Login},
+	}) {
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, adminUserResponse{UserInfo: user, Balance: balance})
+}
+
+// AdminAdjustBalanceHandler adds points to a balance or takes them away. A reason is required, it is saved
+// with an adjustment. Responds with 422 if a balance would become negative.
+func (h *Handler) AdminAdjustBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	request := balanceAdjustmentRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if request.Amount == 0 || request.Reason == "" || len(request.Reason) > maxAdjustmentReasonLength {
+		h.Logger.Debugf("wrong balance adjustment, amount: %v, reason length: %d", request.Amount, len(request.Reason))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user, ok := h.findUser(w, r)
+	if !ok {
+		return
+	}
+
+	balance, err := h.Storage.AdjustBalance(r.Context(), entities.BalanceAdjustment{
+		UserID:  user.ID,
+		AdminID: adminID,
+		Amount:  request.Amount,
+		Reason:  request.Reason,
+	})
+	if errors.Is(err, g_errors.MakeErrNotEnoughPoints()) {
+		h.Logger.Debugf("balance of user %d would become negative, err: %v", user.ID, err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant adjust balance of user %d, err: %v", user.ID, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("balance of user %d was adjusted by %v by admin %d", user.ID, request.Amount, adminID)
+	h.writeJSON(w, http.StatusOK, balance)
+}
+
+// AdminRequeueOrderHandler sends an unprocessed order to the accrual system once more.
+// Responds with 409 if an order is already processed.
+func (h *Handler) AdminRequeueOrderHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	number := chi.URLParam(r, "number")
+	if number == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.Storage.RequeueOrder(r.Context(), number, adminID)
+	if errors.Is(err, g_errors.MakeErrOrderNotFound()) {
+		h.Logger.Debugf("order `%s` not found", number)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, g_errors.MakeErrOrderAlreadyProcessed()) {
+		h.Logger.Debugf("order `%s` is already processed", number)
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant requeue order `%s`, err: %v", number, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("order `%s` was requeued by admin %d", number, adminID)
+	h.writeJSON(w, http.StatusOK, &order)
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, status int, value any) {
+	jsonToRet, err := json.Marshal(value)
+	if err != nil {
+		h.Logger.Errorf("error while marshalling a response: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonToRet)
+}
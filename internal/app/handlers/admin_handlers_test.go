@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// newAdminRequest makes a request of an admin with route params.
+func newAdminRequest(method string, target string, body io.Reader, adminID int, params map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	routeCtx := chi.NewRouteContext()
+	for key, value := range params {
+		routeCtx.URLParams.Add(key, value)
+	}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+	return r.WithContext(context.WithValue(ctx, middlewares.UserIDContextKey, adminID))
+}
+
+func TestHandler_AdminGetUserHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+	testUser := entities.UserInfo{ID: 2, Login: "login", Roles: []string{}}
+	testBalance := entities.BalanceData{UserID: testUser.ID, Current: 500, Withdrawn: 42}
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+		bodyWant   string
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), "LOGIN").Return(testUser, nil)
+					storage.EXPECT().GetBalance(gomock.Any(), testUser.ID).Return(testBalance, nil)
+					storage.EXPECT().SaveAdminAuditRecord(gomock.Any(), entities.AdminAuditRecord{
+						AdminID:      adminID,
+						Action:       entities.AuditActionUserLookup,
+						TargetUserID: testUser.ID,
+						Details:      map[string]string{"login": testUser.Login},
+					}).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newAdminRequest(http.MethodGet, "/api/admin/users/LOGIN", nil, adminID, map[string]string{"login": "LOGIN"}),
+			},
+			statusWant: http.StatusOK,
+			bodyWant:   `{"id":2,"login":"login","roles":[],"balance":{"current":500,"withdrawn":42}}`,
+		},
+		{
+			name: "unknown user",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), "nobody").Return(entities.UserInfo{}, gophermart_errors.MakeErrUserNotFound())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newAdminRequest(http.MethodGet, "/api/admin/users/nobody", nil, adminID, map[string]string{"login": "nobody"}),
+			},
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "audit failed",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), "login").Return(testUser, nil)
+					storage.EXPECT().GetBalance(gomock.Any(), testUser.ID).Return(testBalance, nil)
+					storage.EXPECT().SaveAdminAuditRecord(gomock.Any(), gomock.Any()).Return(errors.New("some test error"))
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newAdminRequest(http.MethodGet, "/api/admin/users/login", nil, adminID, map[string]string{"login": "login"}),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.AdminGetUserHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			if tt.bodyWant != "" {
+				assert.JSONEq(t, tt.bodyWant, tt.args.w.Body.String(), "wrong body")
+			}
+		})
+	}
+}
+
+func TestHandler_AdminAdjustBalanceHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+	testUser := entities.UserInfo{ID: 2, Login: "login"}
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func(body string) *http.Request {
+		return newAdminRequest(http.MethodPost, "/api/admin/users/login/balance", strings.NewReader(body), adminID, map[string]string{"login": testUser.Login})
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), testUser.Login).Return(testUser, nil)
+					storage.EXPECT().AdjustBalance(gomock.Any(), entities.BalanceAdjustment{
+						UserID:  testUser.ID,
+						AdminID: adminID,
+						Amount:  -50,
+						Reason:  "fraud",
+					}).Return(entities.BalanceData{UserID: testUser.ID, Current: 50}, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"amount":-50,"reason":" fraud "}`),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "no reason",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"amount":50,"reason":"  "}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "zero amount",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"amount":0,"reason":"bonus"}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "not enough points",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), testUser.Login).Return(testUser, nil)
+					storage.EXPECT().AdjustBalance(gomock.Any(), gomock.Any()).Return(entities.BalanceData{}, gophermart_errors.MakeErrNotEnoughPoints())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"amount":-1000,"reason":"fraud"}`),
+			},
+			statusWant: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.AdminAdjustBalanceHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestHandler_AdminRequeueOrderHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+	orderNumber := "12345678903"
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func() *http.Request {
+		return newAdminRequest(http.MethodPost, "/api/admin/orders/"+orderNumber+"/requeue", nil, adminID, map[string]string{"number": orderNumber})
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RequeueOrder(gomock.Any(), orderNumber, adminID).Return(entities.OrderData{Number: orderNumber, Status: entities.OrderStatusNew}, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "order not found",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RequeueOrder(gomock.Any(), orderNumber, adminID).Return(entities.OrderData{}, gophermart_errors.MakeErrOrderNotFound())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(),
+			},
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "order is processed",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RequeueOrder(gomock.Any(), orderNumber, adminID).Return(entities.OrderData{}, gophermart_errors.MakeErrOrderAlreadyProcessed())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(),
+			},
+			statusWant: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.AdminRequeueOrderHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			if tt.statusWant == http.StatusOK {
+				order := entities.OrderData{}
+				err := json.Unmarshal(tt.args.w.Body.Bytes(), &order)
+				assert.NoError(t, err, "cant unmarshal an order")
+				assert.Equal(t, entities.OrderStatusNew, order.Status, "wrong order status")
+			}
+		})
+	}
+}
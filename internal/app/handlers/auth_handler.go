@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"yandex_gophermart/internal/app/middlewares"
 	"yandex_gophermart/pkg/entities"
 	g_errors "yandex_gophermart/pkg/errors"
-	"yandex_gophermart/pkg/security"
 )
 
 func (h *Handler) AuthUser(w http.ResponseWriter, r *http.Request) {
@@ -27,37 +30,98 @@ func (h *Handler) AuthUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//checking failed attempts
+	attempt, ok := h.reserveLoginAttempt(w, r, uData.Login, clientIP(r))
+	if !ok {
+		return
+	}
+
 	//checking user
 	uID, err := h.Storage.GetUserIDWithCheck(r.Context(), uData.Login, uData.Password)
 	if errors.Is(err, g_errors.MakeErrWrongLoginOrPassword()) {
 		h.Logger.Warnf("auth error: %v", err.Error())
+		h.countLoginFailure(r, attempt)
 		w.WriteHeader(http.StatusUnauthorized)
-		//_, err := w.Write([]byte("auth error"))
-		if err != nil {
-			h.Logger.Errorf("response write err: %v", err.Error())
-			return
-		}
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
 		return
 	} else if err != nil {
 		h.Logger.Warnf("cant find user in db, err: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	h.resetLoginFailures(r, attempt)
 
-	//creating and setting jwt token
-	jwtString, err := h.JWTH.BuildNewJWTString(uID)
-	if err != nil {
-		h.Logger.Errorf("jwt err: %v", err.Error())
+	//creating tokens
+	tokens, err := h.issueTokens(r.Context(), uID)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant issue tokens: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:  security.JWTCookieName,
-		Value: jwtString,
-	})
-
 	//return
 	h.Logger.Debugf("User authorised, id '%d'", uID)
-	w.WriteHeader(http.StatusOK)
+	h.writeTokens(w, tokens)
+}
+
+// reserveLoginAttempt counts an attempt before a password is checked, responds with 429 and "Retry-After"
+// if attempts of a login or an IP are locked.
+func (h *Handler) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, login string, ip string) (entities.LoginAttempt, bool) {
+	if h.LoginGuard == nil {
+		return entities.LoginAttempt{}, true
+	}
+	attempt, retryAfter, err := h.LoginGuard.Reserve(r.Context(), login, ip)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return attempt, false
+	} else if err != nil {
+		h.Logger.Errorf("cant count a login attempt, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return attempt, false
+	} else if retryAfter > 0 {
+		h.Logger.Warnf("login attempts are locked, login: %s, ip: %s", login, ip)
+		//rounded up, so a client doesn`t retry a bit too early
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return attempt, false
+	}
+	return attempt, true
+}
+
+// countLoginFailure locks next attempts after a wrong password if it is needed, a guard error doesn`t change a response.
+func (h *Handler) countLoginFailure(r *http.Request, attempt entities.LoginAttempt) {
+	if h.LoginGuard == nil {
+		return
+	}
+	err := h.LoginGuard.Failure(r.Context(), attempt)
+	if err != nil {
+		h.Logger.Errorf("cant count a failed login attempt, err: %v", err.Error())
+	}
+}
+
+// resetLoginFailures resets failures of a login after a correct password.
+func (h *Handler) resetLoginFailures(r *http.Request, attempt entities.LoginAttempt) {
+	if h.LoginGuard == nil {
+		return
+	}
+	err := h.LoginGuard.Success(r.Context(), attempt)
+	if err != nil {
+		h.Logger.Errorf("cant reset failed login attempts, err: %v", err.Error())
+	}
+}
+
+// userGuardLogin is a login guard key of a signed in user. "#" isn`t a login symbol, so it doesn`t collide with logins.
+func userGuardLogin(userID int) string {
+	return "#" + strconv.Itoa(userID)
+}
+
+// clientIP is a host of a remote address without a port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
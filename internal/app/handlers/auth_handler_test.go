@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
 	"yandex_gophermart/pkg/entities"
 	gophermart_errors "yandex_gophermart/pkg/errors"
@@ -28,6 +29,7 @@ func TestHandler_AuthUser(t *testing.T) {
 	}
 
 	correctJWTString := "someTestJWT"
+	testAttempt := entities.LoginAttempt{Login: testUser.Login, IP: "192.0.2.1", LoginFailures: 1, IPFailures: 1}
 
 	//logger set
 	logger := zaptest.NewLogger(t)
@@ -38,28 +40,26 @@ func TestHandler_AuthUser(t *testing.T) {
 
 	//tests set
 	type fields struct {
-		Logger  zap.SugaredLogger
-		Storage StorageInt
-		JWTH    JWTHelperInt
+		Logger     zap.SugaredLogger
+		Storage    StorageInt
+		JWTH       JWTHelperInt
+		LoginGuard LoginGuardInt
 	}
 	type args struct {
 		w *httptest.ResponseRecorder
 		r *http.Request
 	}
 	tests := []struct {
-		name       string
-		fields     fields
-		args       args
-		statusWant int
-		checkJWT   bool
+		name           string
+		fields         fields
+		args           args
+		statusWant     int
+		retryAfterWant string
+		checkJWT       bool
 	}{
 		{
 			name: "normal",
-			fields: struct {
-				Logger  zap.SugaredLogger
-				Storage StorageInt
-				JWTH    JWTHelperInt
-			}{
+			fields: fields{
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
@@ -70,13 +70,25 @@ func TestHandler_AuthUser(t *testing.T) {
 							return -1, gophermart_errors.MakeErrUserNotFound()
 						}
 					})
+					storage.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, token entities.RefreshToken) error {
+						assert.Equal(t, testUser.ID, token.UserID, "refresh token of a wrong user")
+						assert.NotEmpty(t, token.FamilyID, "refresh token without a family")
+						return nil
+					})
+					storage.EXPECT().GetUserRoles(gomock.Any(), testUser.ID).Return([]string{entities.RoleAdmin}, nil)
 					return storage
 				}(),
 				JWTH: func() JWTHelperInt {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
-					JWTH.EXPECT().BuildNewJWTString(testUser.ID).Return(correctJWTString, nil)
+					JWTH.EXPECT().BuildNewJWTString(testUser.ID, []string{entities.RoleAdmin}).Return(correctJWTString, nil)
 					return JWTH
 				}(),
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Reserve(gomock.Any(), testUser.Login, "192.0.2.1").Return(testAttempt, time.Duration(0), nil)
+					guard.EXPECT().Success(gomock.Any(), testAttempt).Return(nil)
+					return guard
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -100,11 +112,7 @@ func TestHandler_AuthUser(t *testing.T) {
 		},
 		{
 			name: "wrong password",
-			fields: struct {
-				Logger  zap.SugaredLogger
-				Storage StorageInt
-				JWTH    JWTHelperInt
-			}{
+			fields: fields{
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
@@ -117,6 +125,12 @@ func TestHandler_AuthUser(t *testing.T) {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
 					return JWTH
 				}(),
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Reserve(gomock.Any(), testUser.Login, "192.0.2.1").Return(testAttempt, time.Duration(0), nil)
+					guard.EXPECT().Failure(gomock.Any(), testAttempt).Return(nil)
+					return guard
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -140,11 +154,7 @@ func TestHandler_AuthUser(t *testing.T) {
 		},
 		{
 			name: "bad request",
-			fields: struct {
-				Logger  zap.SugaredLogger
-				Storage StorageInt
-				JWTH    JWTHelperInt
-			}{
+			fields: fields{
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
@@ -154,6 +164,10 @@ func TestHandler_AuthUser(t *testing.T) {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
 					return JWTH
 				}(),
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					return guard
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -164,31 +178,88 @@ func TestHandler_AuthUser(t *testing.T) {
 			statusWant: http.StatusBadRequest,
 			checkJWT:   false,
 		},
+		{
+			name: "login is locked",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+				JWTH: func() JWTHelperInt {
+					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+					return JWTH
+				}(),
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Reserve(gomock.Any(), testUser.Login, "192.0.2.1").Return(testAttempt, time.Millisecond*29500, nil)
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/login", func() io.Reader {
+					jsonData, err := json.Marshal(testUser)
+					if err != nil {
+						logger.Error("auth handler test, err while building json request", zap.Error(err))
+					}
+					return bytes.NewReader(jsonData)
+				}()),
+			},
+			statusWant:     http.StatusTooManyRequests,
+			retryAfterWant: "30",
+			checkJWT:       false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &Handler{
-				Logger:  tt.fields.Logger,
-				Storage: tt.fields.Storage,
-				JWTH:    tt.fields.JWTH,
+				Logger:     tt.fields.Logger,
+				Storage:    tt.fields.Storage,
+				JWTH:       tt.fields.JWTH,
+				LoginGuard: tt.fields.LoginGuard,
+				Auth: AuthSettings{
+					AccessTokenTTL:  time.Minute,
+					RefreshTokenTTL: time.Hour,
+					Cookies: CookieSettings{
+						Secure:   true,
+						SameSite: http.SameSiteStrictMode,
+					},
+				},
 			}
 			h.AuthUser(tt.args.w, tt.args.r)
 
 			assert.Equal(t, tt.statusWant, tt.args.w.Code, "HTTP status is wrong")
+			assert.Equal(t, tt.retryAfterWant, tt.args.w.Header().Get("Retry-After"), "wrong Retry-After header")
 
 			if tt.checkJWT {
 				wasJWTFound := false
+				wasRefreshTokenFound := false
 				resp := tt.args.w.Result()
 				cookies := resp.Cookies()
 				for _, cookie := range cookies {
 					if cookie.Name == security.JWTCookieName {
 						wasJWTFound = true
 						assert.Equal(t, correctJWTString, cookie.Value)
+						assert.True(t, cookie.HttpOnly, "JWT cookie should be http only")
+						assert.True(t, cookie.Secure, "JWT cookie should be secure")
+						assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, "wrong JWT cookie SameSite")
+					}
+					if cookie.Name == security.RefreshTokenCookieName {
+						wasRefreshTokenFound = true
 					}
 				}
 				resp.Body.Close()
 
 				assert.Equal(t, true, wasJWTFound, "JWT cookie wasn`t found")
+				assert.Equal(t, true, wasRefreshTokenFound, "refresh token cookie wasn`t found")
+				assert.Equal(t, "Bearer "+correctJWTString, tt.args.w.Header().Get("Authorization"), "wrong Authorization header")
+
+				tokens := tokensResponse{}
+				err := json.Unmarshal(tt.args.w.Body.Bytes(), &tokens)
+				assert.NoError(t, err, "cant unmarshal tokens")
+				assert.Equal(t, correctJWTString, tokens.AccessToken, "wrong access token in a body")
+				assert.NotEmpty(t, tokens.RefreshToken, "no refresh token in a body")
 			}
 			err := tt.args.w.Result().Body.Close()
 			if err != nil {
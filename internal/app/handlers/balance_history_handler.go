@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+)
+
+const (
+	defaultBalanceHistoryRange = time.Hour * 24 * 30
+	maxBalanceHistoryRange     = time.Hour * 24 * 366
+)
+
+type balanceHistoryParams struct {
+	from        time.Time
+	to          time.Time
+	granularity string
+}
+
+// parseBalanceHistoryParams reads optional "from", "to" (RFC3339) and "granularity" ("day" or "event") query params.
+// By default it is a daily history for the last 30 days.
+func parseBalanceHistoryParams(query url.Values, now time.Time) (balanceHistoryParams, error) {
+	params := balanceHistoryParams{
+		to:          now,
+		granularity: entities.BalanceHistoryDay,
+	}
+
+	var err error
+	if to := query.Get("to"); to != "" {
+		params.to, err = time.Parse(entities.OrderTimeFormat, to)
+		if err != nil {
+			return params, fmt.Errorf("cant parse `to`: %w", err)
+		}
+	}
+	params.from = params.to.Add(-defaultBalanceHistoryRange)
+	if from := query.Get("from"); from != "" {
+		params.from, err = time.Parse(entities.OrderTimeFormat, from)
+		if err != nil {
+			return params, fmt.Errorf("cant parse `from`: %w", err)
+		}
+	}
+	if !params.from.Before(params.to) {
+		return params, fmt.Errorf("`from` should be before `to`")
+	}
+	if params.to.Sub(params.from) > maxBalanceHistoryRange {
+		return params, fmt.Errorf("history range should be not longer than %v", maxBalanceHistoryRange)
+	}
+
+	if granularity := query.Get("granularity"); granularity != "" {
+		if granularity != entities.BalanceHistoryDay && granularity != entities.BalanceHistoryEvent {
+			return params, fmt.Errorf("unknown granularity `%s`", granularity)
+		}
+		params.granularity = granularity
+	}
+
+	return params, nil
+}
+
+// buildBalanceHistory makes a time series from a balance at "from" and changes in (from, to].
+// The first point is a balance at "from". Daily points are taken at midnights (in a time zone of "from")
+// and at "to", event points are taken after every change.
+func buildBalanceHistory(opening entities.BalanceData, events []entities.BalanceEvent, params balanceHistoryParams) []entities.BalancePoint {
+	current, withdrawn := opening.Current, opening.Withdrawn
+	history := []entities.BalancePoint{{At: entities.TimeRFC3339{Time: params.from}, Current: current, Withdrawn: withdrawn}}
+
+	if params.granularity == entities.BalanceHistoryEvent {
+		for _, event := range events {
+			current += event.Accrued - event.Withdrawn
+			withdrawn += event.Withdrawn
+			history = append(history, entities.BalancePoint{At: entities.TimeRFC3339{Time: event.Time}, Current: current, Withdrawn: withdrawn})
+		}
+		return history
+	}
+
+	year, month, day := params.from.Date()
+	next := time.Date(year, month, day, 0, 0, 0, 0, params.from.Location()).AddDate(0, 0, 1)
+	for {
+		at := next
+		if !at.Before(params.to) {
+			at = params.to
+		}
+		for len(events) > 0 && !events[0].Time.After(at) {
+			current += events[0].Accrued - events[0].Withdrawn
+			withdrawn += events[0].Withdrawn
+			events = events[1:]
+		}
+		history = append(history, entities.BalancePoint{At: entities.TimeRFC3339{Time: at}, Current: current, Withdrawn: withdrawn})
+		if at.Equal(params.to) {
+			return history
+		}
+		next = next.AddDate(0, 0, 1)
+	}
+}
+
+func (h *Handler) GetBalanceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	//get userID
+	userIDInt, ok := r.Context().Value(middlewares.UserIDContextKey).(int)
+	if !ok {
+		h.Logger.Debugf("user id wasn`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	params, err := parseBalanceHistoryParams(r.URL.Query(), time.Now())
+	if err != nil {
+		h.Logger.Debugf("wrong balance history params: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	//getting balance changes from db
+	opening, err := h.Storage.GetBalanceAt(r.Context(), userIDInt, params.from)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("error while getting balance from db: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	events, err := h.Storage.GetBalanceEvents(r.Context(), userIDInt, params.from, params.to)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("error while getting balance events from db: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	//return
+	history := buildBalanceHistory(opening, events, params)
+	jsonToRet, err := json.Marshal(&history)
+	if err != nil {
+		h.Logger.Errorf("error while marshalling balance history: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonToRet)
+}
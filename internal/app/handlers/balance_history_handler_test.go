@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+)
+
+func TestHandler_GetBalanceHistoryHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	correctUserID := 1
+	from := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	opening := entities.BalanceData{UserID: correctUserID, Current: 100, Withdrawn: 10}
+	events := []entities.BalanceEvent{
+		{Time: time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC), Accrued: 50},
+		{Time: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), Withdrawn: 20},
+		{Time: time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), Accrued: 5},
+	}
+	makeRequest := func(query string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/user/balance/history?"+query, nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID))
+	}
+
+	tests := []struct {
+		name       string
+		storage    StorageInt
+		r          *http.Request
+		statusWant int
+		bodyWant   string
+	}{
+		{
+			name: "daily",
+			storage: func() StorageInt {
+				storage := mock_handlers.NewMockStorageInt(controller)
+				storage.EXPECT().GetBalanceAt(gomock.Any(), correctUserID, from).Return(opening, nil)
+				storage.EXPECT().GetBalanceEvents(gomock.Any(), correctUserID, from, to).Return(events, nil)
+				return storage
+			}(),
+			r:          makeRequest("from=2024-03-01T12:00:00Z&to=2024-03-03T12:00:00Z"),
+			statusWant: http.StatusOK,
+			bodyWant: `[{"at":"2024-03-01T12:00:00Z","current":100,"withdrawn":10},
+				{"at":"2024-03-02T00:00:00Z","current":130,"withdrawn":30},
+				{"at":"2024-03-03T00:00:00Z","current":130,"withdrawn":30},
+				{"at":"2024-03-03T12:00:00Z","current":135,"withdrawn":30}]`,
+		},
+		{
+			name: "per event",
+			storage: func() StorageInt {
+				storage := mock_handlers.NewMockStorageInt(controller)
+				storage.EXPECT().GetBalanceAt(gomock.Any(), correctUserID, from).Return(opening, nil)
+				storage.EXPECT().GetBalanceEvents(gomock.Any(), correctUserID, from, to).Return(events, nil)
+				return storage
+			}(),
+			r:          makeRequest("from=2024-03-01T12:00:00Z&to=2024-03-03T12:00:00Z&granularity=event"),
+			statusWant: http.StatusOK,
+			bodyWant: `[{"at":"2024-03-01T12:00:00Z","current":100,"withdrawn":10},
+				{"at":"2024-03-01T15:00:00Z","current":150,"withdrawn":10},
+				{"at":"2024-03-02T00:00:00Z","current":130,"withdrawn":30},
+				{"at":"2024-03-03T10:00:00Z","current":135,"withdrawn":30}]`,
+		},
+		{
+			name:       "unknown granularity",
+			storage:    mock_handlers.NewMockStorageInt(controller),
+			r:          makeRequest("granularity=hour"),
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name:       "from after to",
+			storage:    mock_handlers.NewMockStorageInt(controller),
+			r:          makeRequest("from=2024-03-03T12:00:00Z&to=2024-03-01T12:00:00Z"),
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name:       "too long range",
+			storage:    mock_handlers.NewMockStorageInt(controller),
+			r:          makeRequest("from=2020-03-03T12:00:00Z&to=2024-03-01T12:00:00Z"),
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name:       "no user ID",
+			storage:    mock_handlers.NewMockStorageInt(controller),
+			r:          httptest.NewRequest(http.MethodGet, "/api/user/balance/history", nil),
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  *sugarLogger,
+				Storage: tt.storage,
+			}
+			w := httptest.NewRecorder()
+			h.GetBalanceHistoryHandler(w, tt.r)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusWant, res.StatusCode, "wrong status code")
+			if tt.bodyWant != "" {
+				body, err := io.ReadAll(res.Body)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tt.bodyWant, string(body), "wrong history")
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
 )
 
 func (h *Handler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,9 +25,23 @@ func (h *Handler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//getting balance from db
-	balance, err := h.Storage.GetBalance(r.Context(), userIDInt)
-	if err != nil {
+	//getting balance from db, "at" asks for a balance at some moment in the past
+	var balance entities.BalanceData
+	var err error
+	if at := r.URL.Query().Get("at"); at != "" {
+		atTime, parseErr := time.Parse(entities.OrderTimeFormat, at)
+		if parseErr != nil {
+			h.Logger.Debugf("cant parse `at`: %v", parseErr.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		balance, err = h.Storage.GetBalanceAt(r.Context(), userIDInt, atTime)
+	} else {
+		balance, err = h.Storage.GetBalance(r.Context(), userIDInt)
+	}
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
 		h.Logger.Errorf("error while getting balance from db: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -9,9 +10,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
 	"yandex_gophermart/internal/app/middlewares"
 	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
 )
 
 func TestHandler_GetBalanceHandler(t *testing.T) {
@@ -43,10 +46,11 @@ func TestHandler_GetBalanceHandler(t *testing.T) {
 		r *http.Request
 	}
 	tests := []struct {
-		name       string
-		fields     fields
-		args       args
-		statusWant int
+		name           string
+		fields         fields
+		args           args
+		statusWant     int
+		retryAfterWant string
 	}{
 		{
 			name: "normal",
@@ -64,6 +68,54 @@ func TestHandler_GetBalanceHandler(t *testing.T) {
 			},
 			statusWant: http.StatusOK,
 		},
+		{
+			name: "balance in the past",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetBalanceAt(gomock.Any(), 1, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)).Return(correctBalance, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance?at=2024-03-01T12:00:00Z", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "wrong time",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance?at=yesterday", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "storage timeout",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetBalance(gomock.Any(), 1).Return(entities.BalanceData{}, errors.Join(gophermarterrors.MakeErrQueryTimeout(), context.DeadlineExceeded))
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant:     http.StatusServiceUnavailable,
+			retryAfterWant: middlewares.StorageBusyRetryAfter,
+		},
 		{
 			name: "no user ID",
 			fields: fields{
@@ -89,6 +141,7 @@ func TestHandler_GetBalanceHandler(t *testing.T) {
 			h.GetBalanceHandler(tt.args.w, tt.args.r)
 
 			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			assert.Equal(t, tt.retryAfterWant, tt.args.w.Header().Get("Retry-After"), "wrong Retry-After header")
 		})
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
 )
 
 func (h *Handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
@@ -23,13 +24,33 @@ func (h *Handler) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//get withdrawals
-	withdrawals, err := h.Storage.GetWithdrawals(r.Context(), userIDInt)
+	//get page params
+	filter, err := parseListFilter(r.URL.Query(), false)
 	if err != nil {
+		h.Logger.Debugf("wrong list params: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := filter.Limit
+	if limit > 0 {
+		//one more row tells us if there is a next page
+		filter.Limit = limit + 1
+	}
+
+	//get withdrawals
+	withdrawals, err := h.Storage.GetWithdrawals(r.Context(), userIDInt, filter)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
 		h.Logger.Errorf("cant get withdrawals from db, err: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if limit > 0 && len(withdrawals) > limit {
+		withdrawals = withdrawals[:limit]
+		last := withdrawals[limit-1]
+		setNextPageHeaders(w, r, entities.ListCursor{Time: last.ProcessedAt.Time, ID: last.ID})
+	}
 	if len(withdrawals) == 0 {
 		h.Logger.Debugf("no content")
 		w.WriteHeader(http.StatusNoContent)
@@ -58,7 +58,7 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 				Logger: *sugared,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID).Return([]entities.WithdrawalData{
+					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID, entities.ListFilter{}).Return([]entities.WithdrawalData{
 						{
 							OrderNum:    correctOrderID,
 							Sum:         correctSum,
@@ -98,7 +98,7 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 				Logger: *sugared,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID).Return([]entities.WithdrawalData{}, nil)
+					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID, entities.ListFilter{}).Return([]entities.WithdrawalData{}, nil)
 					return storage
 				}(),
 			},
@@ -109,6 +109,39 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 			statusWant: http.StatusNoContent,
 			answerWant: []byte(""),
 		},
+		{
+			name: "with archived",
+			fields: fields{
+				Logger: *sugared,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID, entities.ListFilter{IncludeArchived: true}).Return([]entities.WithdrawalData{}, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/api/user/withdrawals?include_archived=true", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusNoContent,
+			answerWant: []byte(""),
+		},
+		{
+			name: "wrong include_archived",
+			fields: fields{
+				Logger: *sugared,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/api/user/withdrawals?include_archived=maybe", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusBadRequest,
+			answerWant: []byte(""),
+		},
 		{
 			name: "not auth",
 			fields: fields{
@@ -131,7 +164,7 @@ func TestHandler_GetWithdrawals(t *testing.T) {
 				Logger: *sugared,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID).Return([]entities.WithdrawalData{}, errors.New("some test error"))
+					storage.EXPECT().GetWithdrawals(gomock.Any(), correctUserID, entities.ListFilter{}).Return([]entities.WithdrawalData{}, errors.New("some test error"))
 					return storage
 				}(),
 			},
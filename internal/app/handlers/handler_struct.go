@@ -8,5 +8,13 @@ type Handler struct {
 	Logger               zap.SugaredLogger
 	Storage              StorageInt
 	JWTH                 JWTHelperInt
+	Hasher               PasswordHasherInt
+	Credentials          CredentialsPolicyInt
 	AccrualSystemAddress string
+	Auth                 AuthSettings
+	Health               HealthCheckerInt
+	LoginGuard           LoginGuardInt
+	Notifier             PasswordResetNotifierInt
+	ResetLoginLimiter    RequestLimiterInt
+	ResetIPLimiter       RequestLimiterInt
 }
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// LivenessHandler responds 200 while a process is running, even if a storage is unavailable.
+func (h *Handler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReadinessHandler responds 503 while a storage is unavailable, so a balancer stops sending requests here.
+func (h *Handler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if h.Health != nil && !h.Health.Healthy() {
+		h.Logger.Debugf("not ready: storage is unavailable")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+)
+
+func TestHandler_ReadinessHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//tests set
+	type fields struct {
+		Logger zap.SugaredLogger
+		Health HealthCheckerInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "db is available",
+			fields: fields{
+				Logger: *sugarLogger,
+				Health: func() HealthCheckerInt {
+					health := mock_handlers.NewMockHealthCheckerInt(controller)
+					health.EXPECT().Healthy().Return(true)
+					return health
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/readyz", nil),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "db is unavailable",
+			fields: fields{
+				Logger: *sugarLogger,
+				Health: func() HealthCheckerInt {
+					health := mock_handlers.NewMockHealthCheckerInt(controller)
+					health.EXPECT().Healthy().Return(false)
+					return health
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/readyz", nil),
+			},
+			statusWant: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger: tt.fields.Logger,
+				Health: tt.fields.Health,
+			}
+			h.ReadinessHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// jwksMaxAge is how long (in seconds) other services may cache public keys.
+const jwksMaxAge = "300"
+
+// JWKSHandler publishes public keys, which tokens are signed with.
+func (h *Handler) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jsonToRet, err := json.Marshal(h.JWTH.JWKS())
+	if err != nil {
+		h.Logger.Errorf("error while marshalling jwks: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonToRet)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/pkg/security"
+)
+
+func TestHandler_JWKSHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	keys := security.JWKSet{Keys: []security.JWK{
+		{KeyType: "OKP", KeyID: "2024-06", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+	}}
+
+	JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+	JWTH.EXPECT().JWKS().Return(keys)
+
+	h := &Handler{
+		Logger: *sugarLogger,
+		JWTH:   JWTH,
+	}
+	w := httptest.NewRecorder()
+	h.JWKSHandler(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code, "wrong status code")
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "wrong content type")
+	gotKeys := security.JWKSet{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotKeys), "cant unmarshal jwks")
+	assert.Equal(t, keys, gotKeys, "wrong keys")
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+const (
+	maxListLimit = 1000
+
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// parseListFilter reads optional "limit", "cursor", "status", "from", "to" and "include_archived" query params.
+// Statuses are accepted only if withStatus is true.
+func parseListFilter(query url.Values, withStatus bool) (entities.ListFilter, error) {
+	filter := entities.ListFilter{}
+
+	if limit := query.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil || limitInt <= 0 || limitInt > maxListLimit {
+			return filter, fmt.Errorf("limit should be a number from 1 to %d", maxListLimit)
+		}
+		filter.Limit = limitInt
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		decoded, err := entities.DecodeListCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = &decoded
+	}
+
+	if statuses := query.Get("status"); statuses != "" {
+		if !withStatus {
+			return filter, fmt.Errorf("status filter is not supported here")
+		}
+		for _, status := range strings.Split(statuses, ",") {
+			switch status {
+			case entities.OrderStatusNew, entities.OrderStatusProcessing, entities.OrderStatusInvalid, entities.OrderStatusProcessed:
+				filter.Statuses = append(filter.Statuses, status)
+			default:
+				return filter, fmt.Errorf("unknown status `%s`", status)
+			}
+		}
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		filter.From, err = time.Parse(entities.OrderTimeFormat, from)
+		if err != nil {
+			return filter, fmt.Errorf("cant parse `from`: %w", err)
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		filter.To, err = time.Parse(entities.OrderTimeFormat, to)
+		if err != nil {
+			return filter, fmt.Errorf("cant parse `to`: %w", err)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("`from` should be before `to`")
+	}
+
+	if includeArchived := query.Get("include_archived"); includeArchived != "" {
+		filter.IncludeArchived, err = strconv.ParseBool(includeArchived)
+		if err != nil {
+			return filter, fmt.Errorf("cant parse `include_archived`: %w", err)
+		}
+	}
+
+	return filter, nil
+}
+
+// setNextPageHeaders sets "Link" and "X-Next-Cursor" headers pointing to the next page.
+func setNextPageHeaders(w http.ResponseWriter, r *http.Request, next entities.ListCursor) {
+	encoded := next.Encode()
+	query := r.URL.Query()
+	query.Set("cursor", encoded)
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+
+	w.Header().Set(nextCursorHeader, encoded)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.String()))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/security"
+)
+
+// LogoutHandler revokes an access token and a refresh token family of a session and clears cookies.
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.TokenClaimsContextKey).(security.TokenClaims)
+	if !ok {
+		h.Logger.Debugf("token claims weren`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, err := refreshTokenFromRequest(r)
+	if err != nil {
+		h.Logger.Debugf("wrong refresh token in a logout request, err: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.RevokeAccessToken(r.Context(), claims.ID, claims.ExpiresAt)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant revoke an access token: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if refreshToken != "" {
+		err = h.Storage.RevokeRefreshTokenFamily(r.Context(), security.HashRefreshToken(refreshToken))
+		if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+			return
+		} else if err != nil {
+			h.Logger.Errorf("cant revoke a refresh token: %v", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.clearTokenCookies(w)
+	w.WriteHeader(http.StatusOK)
+}
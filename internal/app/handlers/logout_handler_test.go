@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/security"
+)
+
+func TestHandler_LogoutHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	claims := security.TokenClaims{
+		UserID:    1,
+		ID:        "someTokenID",
+		ExpiresAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	refreshToken := "someRefreshToken"
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RevokeAccessToken(gomock.Any(), claims.ID, claims.ExpiresAt).Return(nil)
+					storage.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), security.HashRefreshToken(refreshToken)).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: func() *http.Request {
+					r := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil).WithContext(context.WithValue(context.Background(), middlewares.TokenClaimsContextKey, claims))
+					r.AddCookie(&http.Cookie{Name: security.RefreshTokenCookieName, Value: refreshToken})
+					return r
+				}(),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "no refresh token",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RevokeAccessToken(gomock.Any(), claims.ID, claims.ExpiresAt).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/logout", nil).WithContext(context.WithValue(context.Background(), middlewares.TokenClaimsContextKey, claims)),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "no token claims",
+			fields: fields{
+				Logger:  *sugarLogger,
+				Storage: mock_handlers.NewMockStorageInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/logout", nil),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.LogoutHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	g_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+const maxMerchantNameLength = 255
+
+type createMerchantRequest struct {
+	Name string `json:"name"`
+}
+
+type createAPIKeyRequest struct {
+	Scopes    []string `json:"scopes"`
+	RateLimit int      `json:"rate_limit"` //requests per minute, 0 is a default limit
+}
+
+// createAPIKeyResponse has a key itself, it is shown once and can`t be got later.
+type createAPIKeyResponse struct {
+	Key string `json:"key"`
+	entities.APIKey
+}
+
+// AdminCreateMerchantHandler creates a merchant, which can get API keys.
+func (h *Handler) AdminCreateMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	request := createMerchantRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > maxMerchantNameLength {
+		h.Logger.Debugf("wrong merchant name length: %d", len(request.Name))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	merchant, err := h.Storage.CreateMerchant(r.Context(), request.Name, adminID)
+	if errors.Is(err, g_errors.MakeErrMerchantAlreadyExists()) {
+		h.Logger.Debugf("merchant `%s` already exists", request.Name)
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant create a merchant, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("merchant %d `%s` was created by admin %d", merchant.ID, merchant.Name, adminID)
+	h.writeJSON(w, http.StatusCreated, &merchant)
+}
+
+// AdminCreateAPIKeyHandler makes a new key of a merchant with scopes and a rate limit.
+func (h *Handler) AdminCreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	merchantID, err := strconv.Atoi(chi.URLParam(r, "merchantID"))
+	if err != nil {
+		h.Logger.Debugf("wrong merchant id, err: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request := createAPIKeyRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	scopes, ok := checkScopes(request.Scopes)
+	if !ok || request.RateLimit < 0 {
+		h.Logger.Debugf("wrong api key scopes %v or rate limit %d", request.Scopes, request.RateLimit)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rateLimit := request.RateLimit
+	if rateLimit == 0 {
+		rateLimit = h.Auth.APIKeyRateLimit
+	}
+
+	key, keyHash, err := security.NewAPIKey()
+	if err != nil {
+		h.Logger.Errorf("cant make an api key, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	apiKey, err := h.Storage.CreateAPIKey(r.Context(), entities.APIKey{
+		MerchantID: merchantID,
+		Prefix:     security.APIKeyPrefix(key),
+		Hash:       keyHash,
+		Scopes:     scopes,
+		RateLimit:  rateLimit,
+	}, adminID)
+	if errors.Is(err, g_errors.MakeErrMerchantNotFound()) {
+		h.Logger.Debugf("merchant %d not found", merchantID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant save an api key, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("api key %d of merchant %d was created by admin %d", apiKey.ID, merchantID, adminID)
+	//a key mustn`t be cached by proxies
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusCreated, &createAPIKeyResponse{Key: key, APIKey: apiKey})
+}
+
+// AdminRevokeAPIKeyHandler revokes a key of a merchant, it stops working at once.
+func (h *Handler) AdminRevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	merchantID, err := strconv.Atoi(chi.URLParam(r, "merchantID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	keyID, err := strconv.Atoi(chi.URLParam(r, "keyID"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Storage.RevokeAPIKey(r.Context(), merchantID, keyID, adminID)
+	if errors.Is(err, g_errors.MakeErrAPIKeyNotFound()) {
+		h.Logger.Debugf("active api key %d of merchant %d not found", keyID, merchantID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant revoke an api key, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("api key %d of merchant %d was revoked by admin %d", keyID, merchantID, adminID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkScopes removes duplicates, a key should have at least one scope and all of them should be known.
+func checkScopes(scopes []string) ([]string, bool) {
+	checked := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(entities.APIKeyScopes, scope) {
+			return nil, false
+		}
+		if !slices.Contains(checked, scope) {
+			checked = append(checked, scope)
+		}
+	}
+	return checked, len(checked) > 0
+}
+
+// ActAsUserMW lets a merchant call user endpoints on behalf of a user from a "login" route param:
+// a user id is put in request.ctx, like AuthMW does. It should be used after APIKeyMW.
+// A user should link a merchant first, otherwise the user isn`t found, so merchants can`t find out which logins exist.
+func (h *Handler) ActAsUserMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := r.Context().Value(middlewares.APIKeyContextKey).(entities.APIKey)
+		if !ok {
+			h.Logger.Debugf("api key wasn`t found in ctx")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		user, ok := h.findUser(w, r)
+		if !ok {
+			return
+		}
+
+		linked, err := h.Storage.IsMerchantLinked(r.Context(), key.MerchantID, user.ID)
+		if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+			return
+		} else if err != nil {
+			h.Logger.Errorf("cant check a merchant link, err: %v", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !linked {
+			h.Logger.Warnf("merchant %d isn`t linked to user %d, path - %s", key.MerchantID, user.ID, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		h.Logger.Debugf("merchant %d acts as user %d, path - %s", key.MerchantID, user.ID, r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middlewares.UserIDContextKey, user.ID)))
+	})
+}
+
+// merchantIDFromCtx returns a merchant, which acts on behalf of a user, or 0 if a user calls the API on their own.
+func merchantIDFromCtx(r *http.Request) int {
+	key, ok := r.Context().Value(middlewares.APIKeyContextKey).(entities.APIKey)
+	if !ok {
+		return 0
+	}
+	return key.MerchantID
+}
+
+// LinkedMerchantsHandler returns merchants, which can act on behalf of a user.
+func (h *Handler) LinkedMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDContextKey).(int)
+	if !ok {
+		h.Logger.Debugf("user id wasn`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	links, err := h.Storage.GetLinkedMerchants(r.Context(), userID)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant get linked merchants, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(links) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, links)
+}
+
+// LinkMerchantHandler is a consent of a user: a merchant from a "merchantID" route param can act on behalf of the user.
+func (h *Handler) LinkMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	userID, merchantID, ok := h.userAndMerchantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Storage.LinkMerchant(r.Context(), userID, merchantID)
+	if errors.Is(err, g_errors.MakeErrMerchantNotFound()) {
+		h.Logger.Debugf("merchant %d not found", merchantID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant link a merchant, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("user %d linked merchant %d", userID, merchantID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// UnlinkMerchantHandler takes a consent of a user back, a merchant can`t act on behalf of the user at once.
+func (h *Handler) UnlinkMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	userID, merchantID, ok := h.userAndMerchantIDs(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Storage.UnlinkMerchant(r.Context(), userID, merchantID)
+	if errors.Is(err, g_errors.MakeErrMerchantNotLinked()) {
+		h.Logger.Debugf("merchant %d isn`t linked to user %d", merchantID, userID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant unlink a merchant, err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("user %d unlinked merchant %d", userID, merchantID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// userAndMerchantIDs gets a user from request.ctx and a merchant from a "merchantID" route param.
+// It writes an error status if something is missing.
+func (h *Handler) userAndMerchantIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := r.Context().Value(middlewares.UserIDContextKey).(int)
+	if !ok {
+		h.Logger.Debugf("user id wasn`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	merchantID, err := strconv.Atoi(chi.URLParam(r, "merchantID"))
+	if err != nil {
+		h.Logger.Debugf("wrong merchant id, err: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, merchantID, true
+}
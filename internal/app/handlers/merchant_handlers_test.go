@@ -0,0 +1,709 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+func TestHandler_AdminCreateMerchantHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func(body string) *http.Request {
+		return newAdminRequest(http.MethodPost, "/api/admin/merchants", strings.NewReader(body), adminID, nil)
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreateMerchant(gomock.Any(), "shop", adminID).Return(entities.Merchant{ID: 3, Name: "shop"}, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"name":" shop "}`),
+			},
+			statusWant: http.StatusCreated,
+		},
+		{
+			name: "no name",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"name":""}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "name is taken",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreateMerchant(gomock.Any(), "shop", adminID).Return(entities.Merchant{}, gophermart_errors.MakeErrMerchantAlreadyExists())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(`{"name":"shop"}`),
+			},
+			statusWant: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.AdminCreateMerchantHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestHandler_AdminCreateAPIKeyHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+	defaultRateLimit := 60
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func(merchantID string, body string) *http.Request {
+		return newAdminRequest(http.MethodPost, "/api/admin/merchants/"+merchantID+"/keys", strings.NewReader(body), adminID, map[string]string{"merchantID": merchantID})
+	}
+	//a saved key is returned as is, so a response shows what was stored
+	saveKey := func(ctx context.Context, key entities.APIKey, adminID int) (entities.APIKey, error) {
+		key.ID = 5
+		return key, nil
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name          string
+		fields        fields
+		args          args
+		statusWant    int
+		scopesWant    []string
+		rateLimitWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), adminID).DoAndReturn(saveKey)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", `{"scopes":["orders:submit","balance:read","orders:submit"],"rate_limit":10}`),
+			},
+			statusWant:    http.StatusCreated,
+			scopesWant:    []string{entities.ScopeOrdersSubmit, entities.ScopeBalanceRead},
+			rateLimitWant: 10,
+		},
+		{
+			name: "default rate limit",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), adminID).DoAndReturn(saveKey)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", `{"scopes":["points:redeem"]}`),
+			},
+			statusWant:    http.StatusCreated,
+			scopesWant:    []string{entities.ScopePointsRedeem},
+			rateLimitWant: defaultRateLimit,
+		},
+		{
+			name: "unknown scope",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", `{"scopes":["orders:submit","admin"]}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "no scopes",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", `{"scopes":[]}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "wrong merchant id",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("shop", `{"scopes":["balance:read"]}`),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "unknown merchant",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any(), adminID).Return(entities.APIKey{}, gophermart_errors.MakeErrMerchantNotFound())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", `{"scopes":["balance:read"]}`),
+			},
+			statusWant: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+				Auth:    AuthSettings{APIKeyRateLimit: defaultRateLimit},
+			}
+			h.AdminCreateAPIKeyHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			if tt.statusWant != http.StatusCreated {
+				return
+			}
+			response := struct {
+				Key        string   `json:"key"`
+				MerchantID int      `json:"merchant_id"`
+				Prefix     string   `json:"prefix"`
+				Hash       string   `json:"hash"`
+				Scopes     []string `json:"scopes"`
+				RateLimit  int      `json:"rate_limit"`
+			}{}
+			assert.NoError(t, json.Unmarshal(tt.args.w.Body.Bytes(), &response), "wrong response")
+			assert.Equal(t, 3, response.MerchantID, "wrong merchant id")
+			assert.Equal(t, security.APIKeyPrefix(response.Key), response.Prefix, "wrong key prefix")
+			assert.Empty(t, response.Hash, "key hash is shown")
+			assert.Equal(t, tt.scopesWant, response.Scopes, "wrong scopes")
+			assert.Equal(t, tt.rateLimitWant, response.RateLimit, "wrong rate limit")
+			assert.Equal(t, "no-store", tt.args.w.Header().Get("Cache-Control"), "key can be cached")
+		})
+	}
+}
+
+func TestHandler_AdminRevokeAPIKeyHandler(t *testing.T) {
+
+	//data set
+	adminID := 1
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func(merchantID string, keyID string) *http.Request {
+		return newAdminRequest(http.MethodDelete, "/api/admin/merchants/"+merchantID+"/keys/"+keyID, nil, adminID, map[string]string{"merchantID": merchantID, "keyID": keyID})
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RevokeAPIKey(gomock.Any(), 3, 5, adminID).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", "5"),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "unknown key",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RevokeAPIKey(gomock.Any(), 3, 6, adminID).Return(gophermart_errors.MakeErrAPIKeyNotFound())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", "6"),
+			},
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "wrong key id",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", "key"),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "storage error",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RevokeAPIKey(gomock.Any(), 3, 5, adminID).Return(errors.New("some test error"))
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("3", "5"),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			h.AdminRevokeAPIKeyHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestHandler_ActAsUserMW(t *testing.T) {
+
+	//data set
+	testUser := entities.UserInfo{ID: 2, Login: "login"}
+	testKey := entities.APIKey{ID: 1, MerchantID: 3}
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func(login string) *http.Request {
+		r := newAdminRequest(http.MethodGet, "/api/merchant/users/"+login+"/balance", nil, 0, map[string]string{"login": login})
+		return r.WithContext(context.WithValue(r.Context(), middlewares.APIKeyContextKey, testKey))
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		r          *http.Request
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), testUser.Login).Return(testUser, nil)
+					storage.EXPECT().IsMerchantLinked(gomock.Any(), testKey.MerchantID, testUser.ID).Return(true, nil)
+					return storage
+				}(),
+			},
+			r:          newRequest(testUser.Login),
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "merchant isn`t linked",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), testUser.Login).Return(testUser, nil)
+					storage.EXPECT().IsMerchantLinked(gomock.Any(), testKey.MerchantID, testUser.ID).Return(false, nil)
+					return storage
+				}(),
+			},
+			r:          newRequest(testUser.Login),
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "unknown user",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), "other").Return(entities.UserInfo{}, gophermart_errors.MakeErrUserNotFound())
+					return storage
+				}(),
+			},
+			r:          newRequest("other"),
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "storage error",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetUserByLogin(gomock.Any(), testUser.Login).Return(testUser, nil)
+					storage.EXPECT().IsMerchantLinked(gomock.Any(), testKey.MerchantID, testUser.ID).Return(false, errors.New("some test error"))
+					return storage
+				}(),
+			},
+			r:          newRequest(testUser.Login),
+			statusWant: http.StatusInternalServerError,
+		},
+		{
+			name: "no api key",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			r:          httptest.NewRequest(http.MethodGet, "/api/merchant/users/login/balance", nil),
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			w := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testUser.ID, r.Context().Value(middlewares.UserIDContextKey), "wrong user id")
+				assert.Equal(t, testKey.MerchantID, merchantIDFromCtx(r), "wrong merchant id")
+				w.WriteHeader(http.StatusOK)
+			})
+			h.ActAsUserMW(next).ServeHTTP(w, tt.r)
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestHandler_LinkMerchantHandler(t *testing.T) {
+
+	//data set
+	userID := 2
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//a request of a user is like an admin one, an admin is a user too
+	newRequest := func(method string, merchantID string) *http.Request {
+		return newAdminRequest(method, "/api/user/merchants/"+merchantID, nil, userID, map[string]string{"merchantID": merchantID})
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		handler    func(h *Handler) http.HandlerFunc
+		statusWant int
+	}{
+		{
+			name: "link",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().LinkMerchant(gomock.Any(), userID, 3).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(http.MethodPut, "3"),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.LinkMerchantHandler },
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "link an unknown merchant",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().LinkMerchant(gomock.Any(), userID, 4).Return(gophermart_errors.MakeErrMerchantNotFound())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(http.MethodPut, "4"),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.LinkMerchantHandler },
+			statusWant: http.StatusNotFound,
+		},
+		{
+			name: "wrong merchant id",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(http.MethodPut, "shop"),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.LinkMerchantHandler },
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "not auth",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPut, "/api/user/merchants/3", nil),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.LinkMerchantHandler },
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "unlink",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().UnlinkMerchant(gomock.Any(), userID, 3).Return(nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(http.MethodDelete, "3"),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.UnlinkMerchantHandler },
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "unlink a merchant, which isn`t linked",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().UnlinkMerchant(gomock.Any(), userID, 4).Return(gophermart_errors.MakeErrMerchantNotLinked())
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(http.MethodDelete, "4"),
+			},
+			handler:    func(h *Handler) http.HandlerFunc { return h.UnlinkMerchantHandler },
+			statusWant: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+			}
+			tt.handler(h)(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestHandler_LinkedMerchantsHandler(t *testing.T) {
+
+	//data set
+	userID := 2
+	links := []entities.MerchantLink{{MerchantID: 3, MerchantName: "shop"}}
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/merchants", nil)
+		return r.WithContext(context.WithValue(r.Context(), middlewares.UserIDContextKey, userID))
+	}
+
+	//tests set
+	tests := []struct {
+		name       string
+		storage    StorageInt
+		statusWant int
+	}{
+		{
+			name: "normal",
+			storage: func() StorageInt {
+				storage := mock_handlers.NewMockStorageInt(controller)
+				storage.EXPECT().GetLinkedMerchants(gomock.Any(), userID).Return(links, nil)
+				return storage
+			}(),
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "no merchants",
+			storage: func() StorageInt {
+				storage := mock_handlers.NewMockStorageInt(controller)
+				storage.EXPECT().GetLinkedMerchants(gomock.Any(), userID).Return(nil, nil)
+				return storage
+			}(),
+			statusWant: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  *sugarLogger,
+				Storage: tt.storage,
+			}
+			w := httptest.NewRecorder()
+			h.LinkedMerchantsHandler(w, newRequest())
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+		})
+	}
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: yandex_gophermart/internal/app/handlers (interfaces: StorageInt,JWTHelperInt)
+// Source: yandex_gophermart/internal/app/handlers (interfaces: StorageInt,JWTHelperInt,HealthCheckerInt,PasswordHasherInt,LoginGuardInt,PasswordResetNotifierInt)
 
 // Package mock_handlers is a generated GoMock package.
 package mock_handlers
@@ -7,7 +7,9 @@ package mock_handlers
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 	entities "yandex_gophermart/pkg/entities"
+	security "yandex_gophermart/pkg/security"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,18 +37,77 @@ func (m *MockStorageInt) EXPECT() *MockStorageIntMockRecorder {
 	return m.recorder
 }
 
-// AddToBalance mocks base method.
-func (m *MockStorageInt) AddToBalance(arg0 context.Context, arg1 int, arg2 float64) error {
+// AdjustBalance mocks base method.
+func (m *MockStorageInt) AdjustBalance(arg0 context.Context, arg1 entities.BalanceAdjustment) (entities.BalanceData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddToBalance", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "AdjustBalance", arg0, arg1)
+	ret0, _ := ret[0].(entities.BalanceData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockStorageIntMockRecorder) AdjustBalance(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockStorageInt)(nil).AdjustBalance), arg0, arg1)
+}
+
+// ChangePassword mocks base method.
+func (m *MockStorageInt) ChangePassword(arg0 context.Context, arg1 int, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// AddToBalance indicates an expected call of AddToBalance.
-func (mr *MockStorageIntMockRecorder) AddToBalance(arg0, arg1, arg2 interface{}) *gomock.Call {
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockStorageIntMockRecorder) ChangePassword(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToBalance", reflect.TypeOf((*MockStorageInt)(nil).AddToBalance), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockStorageInt)(nil).ChangePassword), arg0, arg1, arg2, arg3)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockStorageInt) CreateAPIKey(arg0 context.Context, arg1 entities.APIKey, arg2 int) (entities.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entities.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockStorageIntMockRecorder) CreateAPIKey(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockStorageInt)(nil).CreateAPIKey), arg0, arg1, arg2)
+}
+
+// CreateMerchant mocks base method.
+func (m *MockStorageInt) CreateMerchant(arg0 context.Context, arg1 string, arg2 int) (entities.Merchant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMerchant", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entities.Merchant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMerchant indicates an expected call of CreateMerchant.
+func (mr *MockStorageIntMockRecorder) CreateMerchant(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMerchant", reflect.TypeOf((*MockStorageInt)(nil).CreateMerchant), arg0, arg1, arg2)
+}
+
+// CreatePasswordResetToken mocks base method.
+func (m *MockStorageInt) CreatePasswordResetToken(arg0 context.Context, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordResetToken", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordResetToken indicates an expected call of CreatePasswordResetToken.
+func (mr *MockStorageIntMockRecorder) CreatePasswordResetToken(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordResetToken", reflect.TypeOf((*MockStorageInt)(nil).CreatePasswordResetToken), arg0, arg1, arg2, arg3)
 }
 
 // GetBalance mocks base method.
@@ -64,19 +125,79 @@ func (mr *MockStorageIntMockRecorder) GetBalance(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStorageInt)(nil).GetBalance), arg0, arg1)
 }
 
+// GetBalanceAt mocks base method.
+func (m *MockStorageInt) GetBalanceAt(arg0 context.Context, arg1 int, arg2 time.Time) (entities.BalanceData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entities.BalanceData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceAt indicates an expected call of GetBalanceAt.
+func (mr *MockStorageIntMockRecorder) GetBalanceAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceAt", reflect.TypeOf((*MockStorageInt)(nil).GetBalanceAt), arg0, arg1, arg2)
+}
+
+// GetBalanceEvents mocks base method.
+func (m *MockStorageInt) GetBalanceEvents(arg0 context.Context, arg1 int, arg2, arg3 time.Time) ([]entities.BalanceEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBalanceEvents", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]entities.BalanceEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBalanceEvents indicates an expected call of GetBalanceEvents.
+func (mr *MockStorageIntMockRecorder) GetBalanceEvents(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalanceEvents", reflect.TypeOf((*MockStorageInt)(nil).GetBalanceEvents), arg0, arg1, arg2, arg3)
+}
+
+// GetLinkedMerchants mocks base method.
+func (m *MockStorageInt) GetLinkedMerchants(arg0 context.Context, arg1 int) ([]entities.MerchantLink, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkedMerchants", arg0, arg1)
+	ret0, _ := ret[0].([]entities.MerchantLink)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkedMerchants indicates an expected call of GetLinkedMerchants.
+func (mr *MockStorageIntMockRecorder) GetLinkedMerchants(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkedMerchants", reflect.TypeOf((*MockStorageInt)(nil).GetLinkedMerchants), arg0, arg1)
+}
+
 // GetOrdersList mocks base method.
-func (m *MockStorageInt) GetOrdersList(arg0 context.Context, arg1 int) ([]entities.OrderData, error) {
+func (m *MockStorageInt) GetOrdersList(arg0 context.Context, arg1 int, arg2 entities.ListFilter) ([]entities.OrderData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrdersList", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetOrdersList", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]entities.OrderData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOrdersList indicates an expected call of GetOrdersList.
-func (mr *MockStorageIntMockRecorder) GetOrdersList(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageIntMockRecorder) GetOrdersList(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersList", reflect.TypeOf((*MockStorageInt)(nil).GetOrdersList), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersList", reflect.TypeOf((*MockStorageInt)(nil).GetOrdersList), arg0, arg1, arg2)
+}
+
+// GetUserByLogin mocks base method.
+func (m *MockStorageInt) GetUserByLogin(arg0 context.Context, arg1 string) (entities.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByLogin", arg0, arg1)
+	ret0, _ := ret[0].(entities.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByLogin indicates an expected call of GetUserByLogin.
+func (mr *MockStorageIntMockRecorder) GetUserByLogin(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByLogin", reflect.TypeOf((*MockStorageInt)(nil).GetUserByLogin), arg0, arg1)
 }
 
 // GetUserIDWithCheck mocks base method.
@@ -94,19 +215,164 @@ func (mr *MockStorageIntMockRecorder) GetUserIDWithCheck(arg0, arg1, arg2 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIDWithCheck", reflect.TypeOf((*MockStorageInt)(nil).GetUserIDWithCheck), arg0, arg1, arg2)
 }
 
+// GetUserRoles mocks base method.
+func (m *MockStorageInt) GetUserRoles(arg0 context.Context, arg1 int) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserRoles", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserRoles indicates an expected call of GetUserRoles.
+func (mr *MockStorageIntMockRecorder) GetUserRoles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserRoles", reflect.TypeOf((*MockStorageInt)(nil).GetUserRoles), arg0, arg1)
+}
+
 // GetWithdrawals mocks base method.
-func (m *MockStorageInt) GetWithdrawals(arg0 context.Context, arg1 int) ([]entities.WithdrawalData, error) {
+func (m *MockStorageInt) GetWithdrawals(arg0 context.Context, arg1 int, arg2 entities.ListFilter) ([]entities.WithdrawalData, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWithdrawals", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetWithdrawals", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]entities.WithdrawalData)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetWithdrawals indicates an expected call of GetWithdrawals.
-func (mr *MockStorageIntMockRecorder) GetWithdrawals(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStorageIntMockRecorder) GetWithdrawals(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStorageInt)(nil).GetWithdrawals), arg0, arg1, arg2)
+}
+
+// IsMerchantLinked mocks base method.
+func (m *MockStorageInt) IsMerchantLinked(arg0 context.Context, arg1, arg2 int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsMerchantLinked", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsMerchantLinked indicates an expected call of IsMerchantLinked.
+func (mr *MockStorageIntMockRecorder) IsMerchantLinked(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsMerchantLinked", reflect.TypeOf((*MockStorageInt)(nil).IsMerchantLinked), arg0, arg1, arg2)
+}
+
+// LinkMerchant mocks base method.
+func (m *MockStorageInt) LinkMerchant(arg0 context.Context, arg1, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkMerchant", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkMerchant indicates an expected call of LinkMerchant.
+func (mr *MockStorageIntMockRecorder) LinkMerchant(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkMerchant", reflect.TypeOf((*MockStorageInt)(nil).LinkMerchant), arg0, arg1, arg2)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockStorageInt) RequeueOrder(arg0 context.Context, arg1 string, arg2 int) (entities.OrderData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entities.OrderData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockStorageIntMockRecorder) RequeueOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockStorageInt)(nil).RequeueOrder), arg0, arg1, arg2)
+}
+
+// ResetPassword mocks base method.
+func (m *MockStorageInt) ResetPassword(arg0 context.Context, arg1, arg2 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockStorageIntMockRecorder) ResetPassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockStorageInt)(nil).ResetPassword), arg0, arg1, arg2)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockStorageInt) RevokeAPIKey(arg0 context.Context, arg1, arg2, arg3 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockStorageIntMockRecorder) RevokeAPIKey(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockStorageInt)(nil).RevokeAPIKey), arg0, arg1, arg2, arg3)
+}
+
+// RevokeAccessToken mocks base method.
+func (m *MockStorageInt) RevokeAccessToken(arg0 context.Context, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAccessToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAccessToken indicates an expected call of RevokeAccessToken.
+func (mr *MockStorageIntMockRecorder) RevokeAccessToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAccessToken", reflect.TypeOf((*MockStorageInt)(nil).RevokeAccessToken), arg0, arg1, arg2)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockStorageInt) RevokeRefreshTokenFamily(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockStorageIntMockRecorder) RevokeRefreshTokenFamily(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockStorageInt)(nil).RevokeRefreshTokenFamily), arg0, arg1)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockStorageInt) RotateRefreshToken(arg0 context.Context, arg1 string, arg2 entities.RefreshToken) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockStorageIntMockRecorder) RotateRefreshToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockStorageInt)(nil).RotateRefreshToken), arg0, arg1, arg2)
+}
+
+// SaveAdminAuditRecord mocks base method.
+func (m *MockStorageInt) SaveAdminAuditRecord(arg0 context.Context, arg1 entities.AdminAuditRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAdminAuditRecord", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAdminAuditRecord indicates an expected call of SaveAdminAuditRecord.
+func (mr *MockStorageIntMockRecorder) SaveAdminAuditRecord(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStorageInt)(nil).GetWithdrawals), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAdminAuditRecord", reflect.TypeOf((*MockStorageInt)(nil).SaveAdminAuditRecord), arg0, arg1)
 }
 
 // SaveNewOrder mocks base method.
@@ -123,6 +389,20 @@ func (mr *MockStorageIntMockRecorder) SaveNewOrder(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveNewOrder", reflect.TypeOf((*MockStorageInt)(nil).SaveNewOrder), arg0, arg1)
 }
 
+// SaveRefreshToken mocks base method.
+func (m *MockStorageInt) SaveRefreshToken(arg0 context.Context, arg1 entities.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRefreshToken indicates an expected call of SaveRefreshToken.
+func (mr *MockStorageIntMockRecorder) SaveRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefreshToken", reflect.TypeOf((*MockStorageInt)(nil).SaveRefreshToken), arg0, arg1)
+}
+
 // SaveUser mocks base method.
 func (m *MockStorageInt) SaveUser(arg0 context.Context, arg1, arg2, arg3 string) (int, error) {
 	m.ctrl.T.Helper()
@@ -138,6 +418,20 @@ func (mr *MockStorageIntMockRecorder) SaveUser(arg0, arg1, arg2, arg3 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUser", reflect.TypeOf((*MockStorageInt)(nil).SaveUser), arg0, arg1, arg2, arg3)
 }
 
+// UnlinkMerchant mocks base method.
+func (m *MockStorageInt) UnlinkMerchant(arg0 context.Context, arg1, arg2 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlinkMerchant", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlinkMerchant indicates an expected call of UnlinkMerchant.
+func (mr *MockStorageIntMockRecorder) UnlinkMerchant(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlinkMerchant", reflect.TypeOf((*MockStorageInt)(nil).UnlinkMerchant), arg0, arg1, arg2)
+}
+
 // UpdateOrder mocks base method.
 func (m *MockStorageInt) UpdateOrder(arg0 context.Context, arg1 entities.OrderData) error {
 	m.ctrl.T.Helper()
@@ -153,17 +447,17 @@ func (mr *MockStorageIntMockRecorder) UpdateOrder(arg0, arg1 interface{}) *gomoc
 }
 
 // WithdrawFromBalance mocks base method.
-func (m *MockStorageInt) WithdrawFromBalance(arg0 context.Context, arg1 int, arg2 string, arg3 float64) error {
+func (m *MockStorageInt) WithdrawFromBalance(arg0 context.Context, arg1 int, arg2 string, arg3 float64, arg4 int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "WithdrawFromBalance", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "WithdrawFromBalance", arg0, arg1, arg2, arg3, arg4)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // WithdrawFromBalance indicates an expected call of WithdrawFromBalance.
-func (mr *MockStorageIntMockRecorder) WithdrawFromBalance(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockStorageIntMockRecorder) WithdrawFromBalance(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithdrawFromBalance", reflect.TypeOf((*MockStorageInt)(nil).WithdrawFromBalance), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithdrawFromBalance", reflect.TypeOf((*MockStorageInt)(nil).WithdrawFromBalance), arg0, arg1, arg2, arg3, arg4)
 }
 
 // MockJWTHelperInt is a mock of JWTHelperInt interface.
@@ -190,31 +484,238 @@ func (m *MockJWTHelperInt) EXPECT() *MockJWTHelperIntMockRecorder {
 }
 
 // BuildNewJWTString mocks base method.
-func (m *MockJWTHelperInt) BuildNewJWTString(arg0 int) (string, error) {
+func (m *MockJWTHelperInt) BuildNewJWTString(arg0 int, arg1 []string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuildNewJWTString", arg0)
+	ret := m.ctrl.Call(m, "BuildNewJWTString", arg0, arg1)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // BuildNewJWTString indicates an expected call of BuildNewJWTString.
-func (mr *MockJWTHelperIntMockRecorder) BuildNewJWTString(arg0 interface{}) *gomock.Call {
+func (mr *MockJWTHelperIntMockRecorder) BuildNewJWTString(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildNewJWTString", reflect.TypeOf((*MockJWTHelperInt)(nil).BuildNewJWTString), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuildNewJWTString", reflect.TypeOf((*MockJWTHelperInt)(nil).BuildNewJWTString), arg0, arg1)
 }
 
-// GetUserID mocks base method.
-func (m *MockJWTHelperInt) GetUserID(arg0 string) (int, error) {
+// JWKS mocks base method.
+func (m *MockJWTHelperInt) JWKS() security.JWKSet {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserID", arg0)
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "JWKS")
+	ret0, _ := ret[0].(security.JWKSet)
+	return ret0
+}
+
+// JWKS indicates an expected call of JWKS.
+func (mr *MockJWTHelperIntMockRecorder) JWKS() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JWKS", reflect.TypeOf((*MockJWTHelperInt)(nil).JWKS))
+}
+
+// ParseToken mocks base method.
+func (m *MockJWTHelperInt) ParseToken(arg0 string) (security.TokenClaims, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ParseToken", arg0)
+	ret0, _ := ret[0].(security.TokenClaims)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserID indicates an expected call of GetUserID.
-func (mr *MockJWTHelperIntMockRecorder) GetUserID(arg0 interface{}) *gomock.Call {
+// ParseToken indicates an expected call of ParseToken.
+func (mr *MockJWTHelperIntMockRecorder) ParseToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseToken", reflect.TypeOf((*MockJWTHelperInt)(nil).ParseToken), arg0)
+}
+
+// MockHealthCheckerInt is a mock of HealthCheckerInt interface.
+type MockHealthCheckerInt struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthCheckerIntMockRecorder
+}
+
+// MockHealthCheckerIntMockRecorder is the mock recorder for MockHealthCheckerInt.
+type MockHealthCheckerIntMockRecorder struct {
+	mock *MockHealthCheckerInt
+}
+
+// NewMockHealthCheckerInt creates a new mock instance.
+func NewMockHealthCheckerInt(ctrl *gomock.Controller) *MockHealthCheckerInt {
+	mock := &MockHealthCheckerInt{ctrl: ctrl}
+	mock.recorder = &MockHealthCheckerIntMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHealthCheckerInt) EXPECT() *MockHealthCheckerIntMockRecorder {
+	return m.recorder
+}
+
+// Healthy mocks base method.
+func (m *MockHealthCheckerInt) Healthy() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Healthy")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Healthy indicates an expected call of Healthy.
+func (mr *MockHealthCheckerIntMockRecorder) Healthy() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Healthy", reflect.TypeOf((*MockHealthCheckerInt)(nil).Healthy))
+}
+
+// MockPasswordHasherInt is a mock of PasswordHasherInt interface.
+type MockPasswordHasherInt struct {
+	ctrl     *gomock.Controller
+	recorder *MockPasswordHasherIntMockRecorder
+}
+
+// MockPasswordHasherIntMockRecorder is the mock recorder for MockPasswordHasherInt.
+type MockPasswordHasherIntMockRecorder struct {
+	mock *MockPasswordHasherInt
+}
+
+// NewMockPasswordHasherInt creates a new mock instance.
+func NewMockPasswordHasherInt(ctrl *gomock.Controller) *MockPasswordHasherInt {
+	mock := &MockPasswordHasherInt{ctrl: ctrl}
+	mock.recorder = &MockPasswordHasherIntMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPasswordHasherInt) EXPECT() *MockPasswordHasherIntMockRecorder {
+	return m.recorder
+}
+
+// Hash mocks base method.
+func (m *MockPasswordHasherInt) Hash(arg0 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Hash", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Hash indicates an expected call of Hash.
+func (mr *MockPasswordHasherIntMockRecorder) Hash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Hash", reflect.TypeOf((*MockPasswordHasherInt)(nil).Hash), arg0)
+}
+
+// MockLoginGuardInt is a mock of LoginGuardInt interface.
+type MockLoginGuardInt struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginGuardIntMockRecorder
+}
+
+// MockLoginGuardIntMockRecorder is the mock recorder for MockLoginGuardInt.
+type MockLoginGuardIntMockRecorder struct {
+	mock *MockLoginGuardInt
+}
+
+// NewMockLoginGuardInt creates a new mock instance.
+func NewMockLoginGuardInt(ctrl *gomock.Controller) *MockLoginGuardInt {
+	mock := &MockLoginGuardInt{ctrl: ctrl}
+	mock.recorder = &MockLoginGuardIntMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginGuardInt) EXPECT() *MockLoginGuardIntMockRecorder {
+	return m.recorder
+}
+
+// Failure mocks base method.
+func (m *MockLoginGuardInt) Failure(arg0 context.Context, arg1 entities.LoginAttempt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Failure", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Failure indicates an expected call of Failure.
+func (mr *MockLoginGuardIntMockRecorder) Failure(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Failure", reflect.TypeOf((*MockLoginGuardInt)(nil).Failure), arg0, arg1)
+}
+
+// Reserve mocks base method.
+func (m *MockLoginGuardInt) Reserve(arg0 context.Context, arg1, arg2 string) (entities.LoginAttempt, time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reserve", arg0, arg1, arg2)
+	ret0, _ := ret[0].(entities.LoginAttempt)
+	ret1, _ := ret[1].(time.Duration)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Reserve indicates an expected call of Reserve.
+func (mr *MockLoginGuardIntMockRecorder) Reserve(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reserve", reflect.TypeOf((*MockLoginGuardInt)(nil).Reserve), arg0, arg1, arg2)
+}
+
+// Success mocks base method.
+func (m *MockLoginGuardInt) Success(arg0 context.Context, arg1 entities.LoginAttempt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Success", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Success indicates an expected call of Success.
+func (mr *MockLoginGuardIntMockRecorder) Success(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Success", reflect.TypeOf((*MockLoginGuardInt)(nil).Success), arg0, arg1)
+}
+
+// Unlock mocks base method.
+func (m *MockLoginGuardInt) Unlock(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unlock", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock.
+func (mr *MockLoginGuardIntMockRecorder) Unlock(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockLoginGuardInt)(nil).Unlock), arg0, arg1)
+}
+
+// MockPasswordResetNotifierInt is a mock of PasswordResetNotifierInt interface.
+type MockPasswordResetNotifierInt struct {
+	ctrl     *gomock.Controller
+	recorder *MockPasswordResetNotifierIntMockRecorder
+}
+
+// MockPasswordResetNotifierIntMockRecorder is the mock recorder for MockPasswordResetNotifierInt.
+type MockPasswordResetNotifierIntMockRecorder struct {
+	mock *MockPasswordResetNotifierInt
+}
+
+// NewMockPasswordResetNotifierInt creates a new mock instance.
+func NewMockPasswordResetNotifierInt(ctrl *gomock.Controller) *MockPasswordResetNotifierInt {
+	mock := &MockPasswordResetNotifierInt{ctrl: ctrl}
+	mock.recorder = &MockPasswordResetNotifierIntMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPasswordResetNotifierInt) EXPECT() *MockPasswordResetNotifierIntMockRecorder {
+	return m.recorder
+}
+
+// NotifyPasswordReset mocks base method.
+func (m *MockPasswordResetNotifierInt) NotifyPasswordReset(arg0 context.Context, arg1 entities.PasswordResetNotice) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NotifyPasswordReset", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NotifyPasswordReset indicates an expected call of NotifyPasswordReset.
+func (mr *MockPasswordResetNotifierIntMockRecorder) NotifyPasswordReset(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserID", reflect.TypeOf((*MockJWTHelperInt)(nil).GetUserID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotifyPasswordReset", reflect.TypeOf((*MockPasswordResetNotifierInt)(nil).NotifyPasswordReset), arg0, arg1)
 }
@@ -13,6 +13,9 @@ import (
 )
 
 func checkWithLuna(num string) (bool, error) {
+	if len(num) == 0 {
+		return false, nil
+	}
 	sum := 0
 	double := false
 
@@ -83,6 +86,7 @@ func (h *Handler) OrderUploadHandler(w http.ResponseWriter, r *http.Request) {
 	//save new order
 	newOrder := entities.OrderData{
 		UserID:     userIDInt,
+		MerchantID: merchantIDFromCtx(r),
 		Number:     orderNum,
 		Status:     entities.OrderStatusNew,
 		Accrual:    0,
@@ -98,6 +102,12 @@ func (h *Handler) OrderUploadHandler(w http.ResponseWriter, r *http.Request) {
 		h.Logger.Infof("user has alrdeady uploaded this order")
 		w.WriteHeader(http.StatusOK)
 		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant save an order, err: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	//return
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
 )
 
 func (h *Handler) OrdersListHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,16 +24,37 @@ func (h *Handler) OrdersListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//get page params
+	filter, err := parseListFilter(r.URL.Query(), true)
+	if err != nil {
+		h.Logger.Debugf("wrong list params: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := filter.Limit
+	if limit > 0 {
+		//one more row tells us if there is a next page
+		filter.Limit = limit + 1
+	}
+
 	//todo: context первым
 	//getting orders from db
-	orders, err := h.Storage.GetOrdersList(r.Context(), userIDInt)
-	if err != nil {
+	orders, err := h.Storage.GetOrdersList(r.Context(), userIDInt, filter)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
 		h.Logger.Errorf("error while getting orders list from db: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	h.Logger.Infof("orders amout from db: %d, orders - %#v", len(orders), orders)
 
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+		last := orders[limit-1]
+		setNextPageHeaders(w, r, entities.ListCursor{Time: last.UploadedAt.Time, ID: last.ID})
+	}
+
 	//return
 	if len(orders) == 0 {
 		w.WriteHeader(http.StatusNoContent)
@@ -56,11 +56,12 @@ func TestHandler_OrdersListHandler(t *testing.T) {
 		r *http.Request
 	}
 	tests := []struct {
-		name       string
-		fields     fields
-		args       args
-		statusWant int
-		checkBody  bool
+		name         string
+		fields       fields
+		args         args
+		statusWant   int
+		checkBody    bool
+		nextPageWant bool
 	}{
 		{
 			name: "normal",
@@ -68,7 +69,7 @@ func TestHandler_OrdersListHandler(t *testing.T) {
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().GetOrdersList(gomock.Any(), 1).Return(correctOrdersList, nil)
+					storage.EXPECT().GetOrdersList(gomock.Any(), 1, entities.ListFilter{}).Return(correctOrdersList, nil)
 					return storage
 				}(),
 			},
@@ -85,7 +86,7 @@ func TestHandler_OrdersListHandler(t *testing.T) {
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().GetOrdersList(gomock.Any(), 1).Return(make([]entities.OrderData, 0), nil)
+					storage.EXPECT().GetOrdersList(gomock.Any(), 1, entities.ListFilter{}).Return(make([]entities.OrderData, 0), nil)
 					return storage
 				}(),
 			},
@@ -96,6 +97,40 @@ func TestHandler_OrdersListHandler(t *testing.T) {
 			statusWant: http.StatusNoContent,
 			checkBody:  false,
 		},
+		{
+			name: "first page",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().GetOrdersList(gomock.Any(), 1, entities.ListFilter{Limit: 2, Statuses: []string{entities.OrderStatusNew}}).Return(correctOrdersList, nil)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/api/user/orders?limit=1&status=NEW", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant:   http.StatusOK,
+			checkBody:    false,
+			nextPageWant: true,
+		},
+		{
+			name: "wrong cursor",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					return storage
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodGet, "/api/user/orders?cursor=wrong", nil).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusBadRequest,
+			checkBody:  false,
+		},
 		{
 			name: "no user ID",
 			fields: fields{
@@ -129,6 +164,12 @@ func TestHandler_OrdersListHandler(t *testing.T) {
 
 				assert.Equal(t, ordersListJSON, tt.args.w.Body.Bytes())
 			}
+
+			if tt.nextPageWant {
+				nextCursor := entities.ListCursor{Time: correctOrdersList[0].UploadedAt.Time, ID: correctOrdersList[0].ID}.Encode()
+				assert.Equal(t, nextCursor, tt.args.w.Header().Get(nextCursorHeader))
+				assert.Contains(t, tt.args.w.Header().Get("Link"), `rel="next"`)
+			}
 		})
 	}
 }
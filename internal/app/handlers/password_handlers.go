@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	g_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type passwordResetRequest struct {
+	Login string `json:"login"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePasswordHandler replaces a password of a user, who knows the current one. Other sessions of a user
+// are revoked, the current one gets new tokens.
+func (h *Handler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middlewares.UserIDContextKey).(int)
+	if !ok {
+		h.Logger.Debugf("user id wasn`t found in ctx")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	request := changePasswordRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	if request.CurrentPassword == "" {
+		h.Logger.Debugf("no current password in a request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	//wrong current passwords are counted like failed logins, so a stolen session can`t be used to guess a password
+	passwordHash, ok := h.checkAndHashPassword(w, request.NewPassword)
+	if !ok {
+		return
+	}
+	attempt, ok := h.reserveLoginAttempt(w, r, userGuardLogin(userID), clientIP(r))
+	if !ok {
+		return
+	}
+
+	err := h.Storage.ChangePassword(r.Context(), userID, request.CurrentPassword, passwordHash)
+	if errors.Is(err, g_errors.MakeErrWrongLoginOrPassword()) {
+		h.Logger.Warnf("wrong current password of user %d", userID)
+		h.countLoginFailure(r, attempt)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant change a password: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.resetLoginFailures(r, attempt)
+
+	tokens, err := h.issueTokens(r.Context(), userID)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant issue tokens: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("password of user %d was changed", userID)
+	h.writeTokens(w, tokens)
+}
+
+// RequestPasswordResetHandler sends a single-use reset token to a user. It responds 202 for unknown logins too
+// and a notice is sent in the background, so it can`t be used to find out which logins exist.
+// Requests are limited per login and per IP.
+func (h *Handler) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	request := passwordResetRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	if request.Login == "" {
+		h.Logger.Debugf("no login in a password reset request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	//limits don`t depend on whether a login exists
+	if !h.allowRequest(w, h.ResetLoginLimiter, strings.ToLower(request.Login)) || !h.allowRequest(w, h.ResetIPLimiter, clientIP(r)) {
+		return
+	}
+
+	token, tokenHash, err := security.NewPasswordResetToken()
+	if err != nil {
+		h.Logger.Errorf("cant make a password reset token: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(h.Auth.PasswordResetTokenTTL)
+	err = h.Storage.CreatePasswordResetToken(r.Context(), request.Login, tokenHash, expiresAt)
+	if errors.Is(err, g_errors.MakeErrUserNotFound()) {
+		h.Logger.Debugf("password reset of an unknown login `%s`", request.Login)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant save a password reset token: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	//a failed delivery isn`t shown to a client, otherwise it would tell that a login exists
+	err = h.Notifier.NotifyPasswordReset(r.Context(), entities.PasswordResetNotice{
+		Login:     request.Login,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		h.Logger.Errorf("cant send a password reset token: %v", err.Error())
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// allowRequest counts a request of a key, responds with 429 and "Retry-After" if a key is limited.
+// A nil limiter allows everything.
+func (h *Handler) allowRequest(w http.ResponseWriter, limiter RequestLimiterInt, key string) bool {
+	if limiter == nil {
+		return true
+	}
+	ok, wait := limiter.Allow(key)
+	if ok {
+		return true
+	}
+	h.Logger.Warnf("too many requests of `%s`", key)
+	//rounded up, so a client doesn`t retry a bit too early
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	return false
+}
+
+// ConfirmPasswordResetHandler sets a new password by a reset token. All sessions of a user are revoked,
+// so a user logs in again with the new password.
+func (h *Handler) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	request := passwordResetConfirmRequest{}
+	if !h.readJSON(w, r, &request) {
+		return
+	}
+	if request.Token == "" {
+		h.Logger.Debugf("no token in a password reset confirmation")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	passwordHash, ok := h.checkAndHashPassword(w, request.NewPassword)
+	if !ok {
+		return
+	}
+
+	userID, err := h.Storage.ResetPassword(r.Context(), security.HashPasswordResetToken(request.Token), passwordHash)
+	if errors.Is(err, g_errors.MakeErrPasswordResetTokenNotValid()) {
+		h.Logger.Debugf("password reset token is not valid")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant reset a password: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Infof("password of user %d was reset", userID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// readJSON reads a request body into v, responds with 400 if it can`t.
+func (h *Handler) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.Logger.Errorf("error while reading body: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	r.Body.Close()
+	err = json.Unmarshal(bodyBytes, v)
+	if err != nil {
+		h.Logger.Debugf("unmarshal err: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkAndHashPassword checks password rules and hashes a new password. Responds by itself if it fails.
+func (h *Handler) checkAndHashPassword(w http.ResponseWriter, password string) (string, bool) {
+	if h.Credentials != nil {
+		err := h.Credentials.CheckPassword(password)
+		var policyErr *g_errors.CredentialsPolicyError
+		if errors.As(err, &policyErr) {
+			h.Logger.Debugf("password rule is broken: %v", err.Error())
+			h.writePolicyError(w, policyErr)
+			return "", false
+		} else if err != nil {
+			h.Logger.Errorf("cant check a password: %v", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return "", false
+		}
+	} else if password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return "", false
+	}
+
+	passwordHash, err := h.Hasher.Hash(password)
+	if err != nil {
+		h.Logger.Errorf("cant hash a password: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", false
+	}
+	return passwordHash, true
+}
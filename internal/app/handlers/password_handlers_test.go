@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+func TestHandler_ChangePasswordHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	userID := 1
+	newPassword := "correct horse battery staple"
+	newPasswordHash := "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"
+	correctJWTString := "someTestJWT"
+	credentialsPolicy, err := security.NewCredentialsPolicy(security.DefaultCredentialsPolicySettings)
+	require.NoError(t, err, "cant make a credentials policy")
+	newRequest := func(currentPassword string, newPassword string) *http.Request {
+		body, err := json.Marshal(changePasswordRequest{CurrentPassword: currentPassword, NewPassword: newPassword})
+		require.NoError(t, err, "cant marshal test data")
+		return httptest.NewRequest(http.MethodPost, "/api/user/password", bytes.NewReader(body)).
+			WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, userID))
+	}
+
+	//tests set
+	type fields struct {
+		Logger      zap.SugaredLogger
+		Storage     StorageInt
+		JWTH        JWTHelperInt
+		Hasher      PasswordHasherInt
+		Credentials CredentialsPolicyInt
+		LoginGuard  LoginGuardInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ChangePassword(gomock.Any(), userID, "old password", newPasswordHash).Return(nil)
+					storage.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+					storage.EXPECT().GetUserRoles(gomock.Any(), userID).Return(nil, nil)
+					return storage
+				}(),
+				JWTH: func() JWTHelperInt {
+					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+					JWTH.EXPECT().BuildNewJWTString(userID, nil).Return(correctJWTString, nil)
+					return JWTH
+				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("old password", newPassword),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "wrong current password",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ChangePassword(gomock.Any(), userID, "wrong password", newPasswordHash).Return(gophermarterrors.MakeErrWrongLoginOrPassword())
+					return storage
+				}(),
+				JWTH: mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("wrong password", newPassword),
+			},
+			statusWant: http.StatusForbidden,
+		},
+		{
+			name: "wrong current password is counted by a login guard",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ChangePassword(gomock.Any(), userID, "wrong password", newPasswordHash).Return(gophermarterrors.MakeErrWrongLoginOrPassword())
+					return storage
+				}(),
+				JWTH: mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+				Credentials: credentialsPolicy,
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					attempt := entities.LoginAttempt{Login: "#1", LoginFailures: 1}
+					guard.EXPECT().Reserve(gomock.Any(), "#1", gomock.Any()).Return(attempt, time.Duration(0), nil)
+					guard.EXPECT().Failure(gomock.Any(), attempt).Return(nil)
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("wrong password", newPassword),
+			},
+			statusWant: http.StatusForbidden,
+		},
+		{
+			name: "locked after wrong current passwords",
+			fields: fields{
+				Logger:  *sugarLogger,
+				Storage: mock_handlers.NewMockStorageInt(controller),
+				JWTH:    mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+				Credentials: credentialsPolicy,
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Reserve(gomock.Any(), "#1", gomock.Any()).Return(entities.LoginAttempt{Login: "#1"}, time.Minute, nil)
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("old password", newPassword),
+			},
+			statusWant: http.StatusTooManyRequests,
+		},
+		{
+			name: "weak new password",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("old password", "123"),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "no user in ctx",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/password", nil),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:      tt.fields.Logger,
+				Storage:     tt.fields.Storage,
+				JWTH:        tt.fields.JWTH,
+				Hasher:      tt.fields.Hasher,
+				Credentials: tt.fields.Credentials,
+				LoginGuard:  tt.fields.LoginGuard,
+				Auth: AuthSettings{
+					AccessTokenTTL:  time.Minute,
+					RefreshTokenTTL: time.Hour,
+				},
+			}
+			h.ChangePasswordHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			if tt.args.w.Code == http.StatusOK {
+				assert.Equal(t, "Bearer "+correctJWTString, tt.args.w.Header().Get("Authorization"), "new tokens weren`t issued")
+			}
+		})
+	}
+}
+
+func TestHandler_RequestPasswordResetHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	usedUpLimiter := func(key string) RequestLimiterInt {
+		limiter := middlewares.NewRequestLimiter(1, time.Hour)
+		limiter.Allow(key)
+		return limiter
+	}
+	newRequest := func(login string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewReader([]byte(`{"login":"`+login+`"}`)))
+		r.RemoteAddr = "192.0.2.1:1234"
+		return r
+	}
+
+	//tests set
+	type fields struct {
+		Logger       zap.SugaredLogger
+		Storage      StorageInt
+		Notifier     PasswordResetNotifierInt
+		LoginLimiter RequestLimiterInt
+		IPLimiter    RequestLimiterInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreatePasswordResetToken(gomock.Any(), "login", gomock.Any(), gomock.Any()).Return(nil)
+					return storage
+				}(),
+				Notifier: func() PasswordResetNotifierInt {
+					notifier := mock_handlers.NewMockPasswordResetNotifierInt(controller)
+					notifier.EXPECT().NotifyPasswordReset(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, notice entities.PasswordResetNotice) error {
+						assert.Equal(t, "login", notice.Login, "notice of a wrong login")
+						assert.NotEmpty(t, notice.Token, "notice without a token")
+						return nil
+					})
+					return notifier
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewReader([]byte(`{"login":"login"}`))),
+			},
+			statusWant: http.StatusAccepted,
+		},
+		{
+			name: "unknown login",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreatePasswordResetToken(gomock.Any(), "unknown", gomock.Any(), gomock.Any()).Return(gophermarterrors.MakeErrUserNotFound())
+					return storage
+				}(),
+				Notifier: mock_handlers.NewMockPasswordResetNotifierInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewReader([]byte(`{"login":"unknown"}`))),
+			},
+			statusWant: http.StatusAccepted,
+		},
+		{
+			name: "notifier error isn`t shown",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().CreatePasswordResetToken(gomock.Any(), "login", gomock.Any(), gomock.Any()).Return(nil)
+					return storage
+				}(),
+				Notifier: func() PasswordResetNotifierInt {
+					notifier := mock_handlers.NewMockPasswordResetNotifierInt(controller)
+					notifier.EXPECT().NotifyPasswordReset(gomock.Any(), gomock.Any()).Return(errors.New("some test error"))
+					return notifier
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("login"),
+			},
+			statusWant: http.StatusAccepted,
+		},
+		{
+			name: "too many requests of a login",
+			fields: fields{
+				Logger:       *sugarLogger,
+				Storage:      mock_handlers.NewMockStorageInt(controller),
+				Notifier:     mock_handlers.NewMockPasswordResetNotifierInt(controller),
+				LoginLimiter: usedUpLimiter("login"),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("LOGIN"),
+			},
+			statusWant: http.StatusTooManyRequests,
+		},
+		{
+			name: "too many requests from an ip",
+			fields: fields{
+				Logger:    *sugarLogger,
+				Storage:   mock_handlers.NewMockStorageInt(controller),
+				Notifier:  mock_handlers.NewMockPasswordResetNotifierInt(controller),
+				IPLimiter: usedUpLimiter("192.0.2.1"),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("other"),
+			},
+			statusWant: http.StatusTooManyRequests,
+		},
+		{
+			name: "bad request",
+			fields: fields{
+				Logger:   *sugarLogger,
+				Storage:  mock_handlers.NewMockStorageInt(controller),
+				Notifier: mock_handlers.NewMockPasswordResetNotifierInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewReader([]byte(`{"login":`))),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:   tt.fields.Logger,
+				Storage:  tt.fields.Storage,
+				Notifier: tt.fields.Notifier,
+				Auth: AuthSettings{
+					PasswordResetTokenTTL: time.Minute * 30,
+				},
+				ResetLoginLimiter: tt.fields.LoginLimiter,
+				ResetIPLimiter:    tt.fields.IPLimiter,
+			}
+			h.RequestPasswordResetHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+			if tt.statusWant == http.StatusTooManyRequests {
+				assert.NotEmpty(t, tt.args.w.Header().Get("Retry-After"), "no retry delay")
+			}
+		})
+	}
+}
+
+func TestHandler_ConfirmPasswordResetHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	resetToken := "someResetToken"
+	newPassword := "correct horse battery staple"
+	newPasswordHash := "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"
+	newRequest := func(token string) *http.Request {
+		body, err := json.Marshal(passwordResetConfirmRequest{Token: token, NewPassword: newPassword})
+		require.NoError(t, err, "cant marshal test data")
+		return httptest.NewRequest(http.MethodPost, "/api/user/password/reset/confirm", bytes.NewReader(body))
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+		Hasher  PasswordHasherInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ResetPassword(gomock.Any(), security.HashPasswordResetToken(resetToken), newPasswordHash).Return(1, nil)
+					return storage
+				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(resetToken),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "used or expired token",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ResetPassword(gomock.Any(), security.HashPasswordResetToken(resetToken), newPasswordHash).Return(0, gophermarterrors.MakeErrPasswordResetTokenNotValid())
+					return storage
+				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(resetToken),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "no token",
+			fields: fields{
+				Logger:  *sugarLogger,
+				Storage: mock_handlers.NewMockStorageInt(controller),
+				Hasher:  mock_handlers.NewMockPasswordHasherInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(""),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "db error (internal server error)",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().ResetPassword(gomock.Any(), gomock.Any(), newPasswordHash).Return(0, errors.New("some test error"))
+					return storage
+				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(newPassword).Return(newPasswordHash, nil)
+					return hasher
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(resetToken),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+				Hasher:  tt.fields.Hasher,
+			}
+			h.ConfirmPasswordResetHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
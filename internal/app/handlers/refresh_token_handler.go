@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+	g_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// RefreshTokenHandler replaces a refresh token with a new one and gives a new access token.
+// A used refresh token can`t be used again, its reuse revokes all tokens of its family.
+func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	oldToken, err := refreshTokenFromRequest(r)
+	if err != nil {
+		h.Logger.Debugf("wrong refresh token request, err: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	} else if oldToken == "" {
+		h.Logger.Debugf("cant find a refresh token in a request")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	newToken, newTokenHash, err := security.NewRefreshToken()
+	if err != nil {
+		h.Logger.Errorf("cant make a refresh token: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	userID, err := h.Storage.RotateRefreshToken(r.Context(), security.HashRefreshToken(oldToken), entities.RefreshToken{
+		Hash:      newTokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.Auth.RefreshTokenTTL),
+	})
+	if errors.Is(err, g_errors.MakeErrRefreshTokenReused()) {
+		h.Logger.Warnf("refresh token reuse, its family is revoked")
+		h.clearTokenCookies(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, g_errors.MakeErrRefreshTokenNotFound()) || errors.Is(err, g_errors.MakeErrRefreshTokenExpired()) {
+		h.Logger.Debugf("refresh token is not valid: %v", err.Error())
+		h.clearTokenCookies(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant rotate a refresh token: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.makeTokensResponse(r.Context(), userID, newToken)
+	if err != nil {
+		h.Logger.Errorf("jwt err: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, tokens)
+}
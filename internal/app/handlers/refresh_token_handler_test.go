@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+func TestHandler_RefreshTokenHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	//data set
+	correctUserID := 1
+	correctJWTString := "someTestJWT"
+	oldRefreshToken := "oldRefreshToken"
+	newRequest := func(withCookie bool) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", http.NoBody)
+		if withCookie {
+			r.AddCookie(&http.Cookie{Name: security.RefreshTokenCookieName, Value: oldRefreshToken})
+		}
+		return r
+	}
+
+	//tests set
+	type fields struct {
+		Logger  zap.SugaredLogger
+		Storage StorageInt
+		JWTH    JWTHelperInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name             string
+		fields           fields
+		args             args
+		statusWant       int
+		newRefreshWanted bool
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RotateRefreshToken(gomock.Any(), security.HashRefreshToken(oldRefreshToken), gomock.Any()).Return(correctUserID, nil)
+					storage.EXPECT().GetUserRoles(gomock.Any(), correctUserID).Return(nil, nil)
+					return storage
+				}(),
+				JWTH: func() JWTHelperInt {
+					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+					JWTH.EXPECT().BuildNewJWTString(correctUserID, nil).Return(correctJWTString, nil)
+					return JWTH
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(true),
+			},
+			statusWant:       http.StatusOK,
+			newRefreshWanted: true,
+		},
+		{
+			name: "refresh token in a body",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RotateRefreshToken(gomock.Any(), security.HashRefreshToken(oldRefreshToken), gomock.Any()).Return(correctUserID, nil)
+					storage.EXPECT().GetUserRoles(gomock.Any(), correctUserID).Return(nil, nil)
+					return storage
+				}(),
+				JWTH: func() JWTHelperInt {
+					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+					JWTH.EXPECT().BuildNewJWTString(correctUserID, nil).Return(correctJWTString, nil)
+					return JWTH
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", strings.NewReader(`{"refresh_token":"`+oldRefreshToken+`"}`)),
+			},
+			statusWant:       http.StatusOK,
+			newRefreshWanted: true,
+		},
+		{
+			name: "wrong body",
+			fields: fields{
+				Logger:  *sugarLogger,
+				Storage: mock_handlers.NewMockStorageInt(controller),
+				JWTH:    mock_handlers.NewMockJWTHelperInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", strings.NewReader(`{"refresh_token":`)),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "no refresh token",
+			fields: fields{
+				Logger:  *sugarLogger,
+				Storage: mock_handlers.NewMockStorageInt(controller),
+				JWTH:    mock_handlers.NewMockJWTHelperInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(false),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "expired refresh token",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, gophermarterrors.MakeErrRefreshTokenExpired())
+					return storage
+				}(),
+				JWTH: mock_handlers.NewMockJWTHelperInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(true),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "reused refresh token",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, gophermarterrors.MakeErrRefreshTokenReused())
+					return storage
+				}(),
+				JWTH: mock_handlers.NewMockJWTHelperInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(true),
+			},
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name: "db error (internal server error)",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(0, errors.New("some test error"))
+					return storage
+				}(),
+				JWTH: mock_handlers.NewMockJWTHelperInt(controller),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(true),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:  tt.fields.Logger,
+				Storage: tt.fields.Storage,
+				JWTH:    tt.fields.JWTH,
+				Auth: AuthSettings{
+					AccessTokenTTL:  time.Minute,
+					RefreshTokenTTL: time.Hour,
+				},
+			}
+			h.RefreshTokenHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+
+			res := tt.args.w.Result()
+			defer res.Body.Close()
+			wasNewRefreshFound := false
+			for _, cookie := range res.Cookies() {
+				if cookie.Name == security.RefreshTokenCookieName && cookie.MaxAge > 0 {
+					wasNewRefreshFound = true
+					assert.NotEqual(t, oldRefreshToken, cookie.Value, "refresh token wasn`t rotated")
+				}
+			}
+			assert.Equal(t, tt.newRefreshWanted, wasNewRefreshFound, "wrong refresh token cookie")
+		})
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"yandex_gophermart/internal/app/middlewares"
 	"yandex_gophermart/pkg/entities"
 	g_errors "yandex_gophermart/pkg/errors"
-	"yandex_gophermart/pkg/security"
 )
 
 func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
@@ -27,14 +27,29 @@ func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//creating user
-	passwordSalt, err := security.GenPasswordSalt()
+	//checking registration rules
+	if h.Credentials != nil {
+		err = h.Credentials.Check(uData.Login, uData.Password)
+		var policyErr *g_errors.CredentialsPolicyError
+		if errors.As(err, &policyErr) {
+			h.Logger.Debugf("registration rule is broken: %v", err.Error())
+			h.writePolicyError(w, policyErr)
+			return
+		} else if err != nil {
+			h.Logger.Errorf("cant check credentials: %v", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	//creating user (a salt is a part of a hash)
+	passwordHash, err := h.Hasher.Hash(uData.Password)
 	if err != nil {
-		h.Logger.Errorf("cant generate a password salt: %v", err.Error())
+		h.Logger.Errorf("cant hash a password: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	uID, err := h.Storage.SaveUser(r.Context(), uData.Login, security.HashPassword(uData.Password, passwordSalt), passwordSalt)
+	uID, err := h.Storage.SaveUser(r.Context(), uData.Login, passwordHash, "")
 	if errors.Is(err, g_errors.MakeErrUserAlreadyExists()) {
 		h.Logger.Warnf("user create error: %v", err.Error())
 		w.WriteHeader(http.StatusConflict)
@@ -44,25 +59,45 @@ func (h *Handler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
 	} else if err != nil {
 		h.Logger.Errorf("cant save user in db: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	//creating and setting jwt token
-	jwtString, err := h.JWTH.BuildNewJWTString(uID)
-	if err != nil {
-		h.Logger.Errorf("jwt err: %v", err.Error())
+	//creating tokens
+	tokens, err := h.issueTokens(r.Context(), uID)
+	if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
+	} else if err != nil {
+		h.Logger.Errorf("cant issue tokens: %v", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:  security.JWTCookieName,
-		Value: jwtString,
-	})
-
 	//return
-	w.WriteHeader(http.StatusOK)
+	h.writeTokens(w, tokens)
+}
+
+// policyErrorResponse tells a client which registration rule was broken.
+type policyErrorResponse struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (h *Handler) writePolicyError(w http.ResponseWriter, policyErr *g_errors.CredentialsPolicyError) {
+	jsonToRet, err := json.Marshal(policyErrorResponse{Rule: policyErr.Rule, Message: policyErr.Message})
+	if err != nil {
+		h.Logger.Errorf("error while marshalling a policy error: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, err = w.Write(jsonToRet)
+	if err != nil {
+		h.Logger.Errorf("response write err: %v", err.Error())
+	}
 }
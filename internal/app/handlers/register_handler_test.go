@@ -36,6 +36,15 @@ func TestHandler_RegisterUser(t *testing.T) {
 	require.NoError(t, err, "cant marshal test data")
 
 	correctJWTString := "someTestJWT"
+	testPasswordHash := "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"
+
+	credentialsPolicy, err := security.NewCredentialsPolicy(security.DefaultCredentialsPolicySettings)
+	require.NoError(t, err, "cant make a credentials policy")
+	makeRequestData := func(login string, password string) []byte {
+		data, err := json.Marshal(entities.UserData{Login: login, Password: password})
+		require.NoError(t, err, "cant marshal test data")
+		return data
+	}
 
 	//logger set
 	logger := zaptest.NewLogger(t)
@@ -45,9 +54,11 @@ func TestHandler_RegisterUser(t *testing.T) {
 	controller := gomock.NewController(t)
 
 	type fields struct {
-		Logger  zap.SugaredLogger
-		Storage StorageInt
-		JWTH    JWTHelperInt
+		Logger      zap.SugaredLogger
+		Storage     StorageInt
+		JWTH        JWTHelperInt
+		Hasher      PasswordHasherInt
+		Credentials CredentialsPolicyInt
 	}
 	type args struct {
 		w *httptest.ResponseRecorder
@@ -58,6 +69,7 @@ func TestHandler_RegisterUser(t *testing.T) {
 		fields     fields
 		args       args
 		statusWant int
+		ruleWant   string
 	}{
 		{
 			name: "normal",
@@ -65,14 +77,21 @@ func TestHandler_RegisterUser(t *testing.T) {
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, gomock.Any(), gomock.Any()).Return(testUser.ID, nil)
+					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, testPasswordHash, "").Return(testUser.ID, nil)
+					storage.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+					storage.EXPECT().GetUserRoles(gomock.Any(), testUser.ID).Return(nil, nil)
 					return storage
 				}(),
 				JWTH: func() JWTHelperInt {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
-					JWTH.EXPECT().BuildNewJWTString(testUser.ID).Return(correctJWTString, nil)
+					JWTH.EXPECT().BuildNewJWTString(testUser.ID, nil).Return(correctJWTString, nil)
 					return JWTH
 				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(testUser.Password).Return(testPasswordHash, nil)
+					return hasher
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -86,13 +105,18 @@ func TestHandler_RegisterUser(t *testing.T) {
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, gomock.Any(), gomock.Any()).Return(0, gophermarterrors.MakeErrUserAlreadyExists())
+					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, testPasswordHash, "").Return(0, gophermarterrors.MakeErrUserAlreadyExists())
 					return storage
 				}(),
 				JWTH: func() JWTHelperInt {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
 					return JWTH
 				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(testUser.Password).Return(testPasswordHash, nil)
+					return hasher
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -112,6 +136,10 @@ func TestHandler_RegisterUser(t *testing.T) {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
 					return JWTH
 				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					return hasher
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -125,13 +153,42 @@ func TestHandler_RegisterUser(t *testing.T) {
 				Logger: *sugarLogger,
 				Storage: func() StorageInt {
 					storage := mock_handlers.NewMockStorageInt(controller)
-					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, gomock.Any(), gomock.Any()).Return(0, errors.New("some test error"))
+					storage.EXPECT().SaveUser(gomock.Any(), testUser.Login, testPasswordHash, "").Return(0, errors.New("some test error"))
+					return storage
+				}(),
+				JWTH: func() JWTHelperInt {
+					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
+					return JWTH
+				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(testUser.Password).Return(testPasswordHash, nil)
+					return hasher
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(JSONTestUserData)),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+		{
+			name: "hashing error (internal server error)",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
 					return storage
 				}(),
 				JWTH: func() JWTHelperInt {
 					JWTH := mock_handlers.NewMockJWTHelperInt(controller)
 					return JWTH
 				}(),
+				Hasher: func() PasswordHasherInt {
+					hasher := mock_handlers.NewMockPasswordHasherInt(controller)
+					hasher.EXPECT().Hash(testUser.Password).Return("", errors.New("some test error"))
+					return hasher
+				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
@@ -139,13 +196,79 @@ func TestHandler_RegisterUser(t *testing.T) {
 			},
 			statusWant: http.StatusInternalServerError,
 		},
+		{
+			name: "short password",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(makeRequestData("login", "123"))),
+			},
+			statusWant: http.StatusBadRequest,
+			ruleWant:   security.RulePasswordMinLength,
+		},
+		{
+			name: "common password",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(makeRequestData("login", "Password123"))),
+			},
+			statusWant: http.StatusBadRequest,
+			ruleWant:   security.RulePasswordCommon,
+		},
+		{
+			name: "empty login",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(makeRequestData("", "correct horse battery staple"))),
+			},
+			statusWant: http.StatusBadRequest,
+			ruleWant:   security.RuleLoginLength,
+		},
+		{
+			name: "wrong login characters",
+			fields: fields{
+				Logger:      *sugarLogger,
+				Storage:     mock_handlers.NewMockStorageInt(controller),
+				JWTH:        mock_handlers.NewMockJWTHelperInt(controller),
+				Hasher:      mock_handlers.NewMockPasswordHasherInt(controller),
+				Credentials: credentialsPolicy,
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/register", bytes.NewReader(makeRequestData("log in", "correct horse battery staple"))),
+			},
+			statusWant: http.StatusBadRequest,
+			ruleWant:   security.RuleLoginCharset,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &Handler{
-				Logger:  tt.fields.Logger,
-				Storage: tt.fields.Storage,
-				JWTH:    tt.fields.JWTH,
+				Logger:      tt.fields.Logger,
+				Storage:     tt.fields.Storage,
+				JWTH:        tt.fields.JWTH,
+				Hasher:      tt.fields.Hasher,
+				Credentials: tt.fields.Credentials,
 			}
 
 			h.RegisterUser(tt.args.w, tt.args.r)
@@ -153,6 +276,7 @@ func TestHandler_RegisterUser(t *testing.T) {
 			if assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code") {
 				if tt.args.w.Code == http.StatusOK {
 					wasJWTFound := false
+					wasRefreshTokenFound := false
 					res := tt.args.w.Result()
 					cookies := res.Cookies()
 					for _, cookie := range cookies {
@@ -160,9 +284,20 @@ func TestHandler_RegisterUser(t *testing.T) {
 							wasJWTFound = true
 							assert.Equal(t, correctJWTString, cookie.Value)
 						}
+						if cookie.Name == security.RefreshTokenCookieName {
+							wasRefreshTokenFound = true
+							assert.True(t, cookie.HttpOnly, "refresh token cookie should be http only")
+						}
 					}
 					res.Body.Close()
 					assert.Equal(t, true, wasJWTFound, "JWT cookie wasn`t found")
+					assert.Equal(t, true, wasRefreshTokenFound, "refresh token cookie wasn`t found")
+				}
+				if tt.ruleWant != "" {
+					policyErr := policyErrorResponse{}
+					err := json.Unmarshal(tt.args.w.Body.Bytes(), &policyErr)
+					assert.NoError(t, err, "cant unmarshal a policy error")
+					assert.Equal(t, tt.ruleWant, policyErr.Rule, "wrong broken rule")
 				}
 
 			}
@@ -2,24 +2,81 @@ package handlers
 
 import (
 	"context"
+	"time"
 	"yandex_gophermart/pkg/entities"
+	"yandex_gophermart/pkg/security"
 )
 
-//go:generate mockgen -destination=mocks/mock_interfaces.go yandex_gophermart/internal/app/handlers StorageInt,JWTHelperInt
+//go:generate mockgen -destination=mocks/mock_interfaces.go yandex_gophermart/internal/app/handlers StorageInt,JWTHelperInt,HealthCheckerInt,PasswordHasherInt,LoginGuardInt,PasswordResetNotifierInt
 
 type StorageInt interface {
 	SaveUser(ctx context.Context, login string, passwordHash string, passwordSalt string) (int, error) //int - ID
 	GetUserIDWithCheck(ctx context.Context, login string, passwordHash string) (int, error)            //int - ID
 	SaveNewOrder(ctx context.Context, orderData entities.OrderData) error
 	UpdateOrder(ctx context.Context, orderData entities.OrderData) error
-	GetOrdersList(ctx context.Context, userID int) ([]entities.OrderData, error)
+	GetOrdersList(ctx context.Context, userID int, filter entities.ListFilter) ([]entities.OrderData, error)
 	GetBalance(ctx context.Context, userID int) (entities.BalanceData, error)
+	GetBalanceAt(ctx context.Context, userID int, at time.Time) (entities.BalanceData, error)
+	GetBalanceEvents(ctx context.Context, userID int, from time.Time, to time.Time) ([]entities.BalanceEvent, error) //(from, to], oldest first
 	//AddToBalance(ctx context.Context, userID int, amount float64) error
-	WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64) error
-	GetWithdrawals(ctx context.Context, userID int) (withdrawals []entities.WithdrawalData, err error)
+	WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) error //merchantID is 0 if a user withdraws points on their own
+	GetWithdrawals(ctx context.Context, userID int, filter entities.ListFilter) (withdrawals []entities.WithdrawalData, err error)
+	SaveRefreshToken(ctx context.Context, token entities.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, oldHash string, newToken entities.RefreshToken) (int, error) //int - user ID
+	RevokeRefreshTokenFamily(ctx context.Context, hash string) error
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	ChangePassword(ctx context.Context, userID int, currentPassword string, newPasswordHash string) error
+	CreatePasswordResetToken(ctx context.Context, login string, tokenHash string, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string) (int, error) //int - user ID
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	GetUserByLogin(ctx context.Context, login string) (entities.UserInfo, error)
+	AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (entities.BalanceData, error) //a new balance
+	RequeueOrder(ctx context.Context, orderNumber string, adminID int) (entities.OrderData, error)
+	SaveAdminAuditRecord(ctx context.Context, record entities.AdminAuditRecord) error
+	CreateMerchant(ctx context.Context, name string, adminID int) (entities.Merchant, error)
+	CreateAPIKey(ctx context.Context, key entities.APIKey, adminID int) (entities.APIKey, error)
+	RevokeAPIKey(ctx context.Context, merchantID int, keyID int, adminID int) error
+	LinkMerchant(ctx context.Context, userID int, merchantID int) error
+	UnlinkMerchant(ctx context.Context, userID int, merchantID int) error
+	GetLinkedMerchants(ctx context.Context, userID int) ([]entities.MerchantLink, error)
+	IsMerchantLinked(ctx context.Context, merchantID int, userID int) (bool, error)
+}
+
+type PasswordHasherInt interface {
+	Hash(password string) (string, error)
+}
+
+// LoginGuardInt limits failed logins. Reserve counts an attempt before a password is checked and returns how long
+// a client should wait before the next attempt, an allowed attempt ends with Failure or Success.
+type LoginGuardInt interface {
+	Reserve(ctx context.Context, login string, ip string) (entities.LoginAttempt, time.Duration, error)
+	Failure(ctx context.Context, attempt entities.LoginAttempt) error
+	Success(ctx context.Context, attempt entities.LoginAttempt) error
+	Unlock(ctx context.Context, login string) error
+}
+
+// CredentialsPolicyInt checks registration rules, a broken rule is *gophermart_errors.CredentialsPolicyError.
+type CredentialsPolicyInt interface {
+	Check(login string, password string) error
+	CheckPassword(password string) error
+}
+
+// PasswordResetNotifierInt delivers password reset tokens to users.
+type PasswordResetNotifierInt interface {
+	NotifyPasswordReset(ctx context.Context, notice entities.PasswordResetNotice) error
+}
+
+// RequestLimiterInt counts requests of a key (a login or an IP), it returns how long to wait if a key is limited.
+type RequestLimiterInt interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+type HealthCheckerInt interface {
+	Healthy() bool
 }
 
 type JWTHelperInt interface {
-	BuildNewJWTString(userID int) (string, error)
-	GetUserID(token string) (int, error)
+	BuildNewJWTString(userID int, roles []string) (string, error)
+	ParseToken(token string) (security.TokenClaims, error)
+	JWKS() security.JWKSet
 }
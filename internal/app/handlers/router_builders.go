@@ -4,31 +4,111 @@ import (
 	"github.com/go-chi/chi"
 	"go.uber.org/zap"
 	"yandex_gophermart/internal/app/middlewares"
-	"yandex_gophermart/pkg/security"
+	"yandex_gophermart/pkg/entities"
 )
 
-func NewRouter(logger zap.SugaredLogger, storage StorageInt, accrualSystemAddress string) chi.Router {
+// RouterStorageInt is a storage of all routes: handlers, token revocation checks and merchant API keys.
+type RouterStorageInt interface {
+	StorageInt
+	middlewares.RevokedTokensStorageInt
+	middlewares.APIKeyStorageInt
+}
+
+// RouterDeps are dependencies of NewRouter.
+type RouterDeps struct {
+	Logger  zap.SugaredLogger
+	Storage RouterStorageInt
+	//idempotency keys are kept apart from cached and retried storage calls
+	IdempotencyStorage middlewares.IdempotencyStorageInt
+	Health             HealthCheckerInt
+	Hasher             PasswordHasherInt
+	Credentials        CredentialsPolicyInt
+	LoginGuard         LoginGuardInt
+	//nil disables password reset routes
+	Notifier             PasswordResetNotifierInt
+	JWTHelper            JWTHelperInt
+	AccrualSystemAddress string
+	Idempotency          middlewares.IdempotencySettings
+	Auth                 AuthSettings
+}
+
+func NewRouter(deps RouterDeps) chi.Router {
+	logger, storage, health, auth := deps.Logger, deps.Storage, deps.Health, deps.Auth
+
 	//configure
 	r := chi.NewRouter()
 	handler := Handler{
 		Logger:               logger,
 		Storage:              storage,
-		JWTH:                 security.NewJWTHelper(),
-		AccrualSystemAddress: accrualSystemAddress,
+		JWTH:                 deps.JWTHelper,
+		Hasher:               deps.Hasher,
+		Credentials:          deps.Credentials,
+		AccrualSystemAddress: deps.AccrualSystemAddress,
+		Auth:                 auth,
+		Health:               health,
+		LoginGuard:           deps.LoginGuard,
+		Notifier:             deps.Notifier,
+	}
+	if limits := auth.PasswordResetLimits; limits.PerLogin > 0 {
+		handler.ResetLoginLimiter = middlewares.NewRequestLimiter(limits.PerLogin, limits.Window)
+	}
+	if limits := auth.PasswordResetLimits; limits.PerIP > 0 {
+		handler.ResetIPLimiter = middlewares.NewRequestLimiter(limits.PerIP, limits.Window)
 	}
 
 	//middlewares
-	r.Use(middlewares.AuthMW(logger))
+	r.Use(middlewares.AuthMW(logger, deps.JWTHelper, storage, health))
 	//r.Use(middlewares.LoggerMW(logger))
 
 	//handlers
-	r.Post("/api/user/register", handler.RegisterUser)
-	r.Post("/api/user/login", handler.AuthUser)
-	r.Post("/api/user/orders", handler.OrderUploadHandler)
+	storageHealthMW := middlewares.StorageHealthMW(logger, health)
+	r.With(storageHealthMW).Post("/api/user/register", handler.RegisterUser)
+	//a login counts attempts and saves a refresh token, so it writes too
+	r.With(storageHealthMW).Post("/api/user/login", handler.AuthUser)
+	r.With(storageHealthMW).Post("/api/user/token/refresh", handler.RefreshTokenHandler)
+	r.With(storageHealthMW).Post("/api/user/logout", handler.LogoutHandler)
+	r.With(storageHealthMW).Post("/api/user/password", handler.ChangePasswordHandler)
+	if deps.Notifier != nil {
+		r.With(storageHealthMW).Post("/api/user/password/reset", handler.RequestPasswordResetHandler)
+		r.With(storageHealthMW).Post("/api/user/password/reset/confirm", handler.ConfirmPasswordResetHandler)
+	}
+	idempotencyMW := middlewares.IdempotencyMW(logger, deps.IdempotencyStorage, deps.Idempotency)
+	r.With(storageHealthMW, idempotencyMW).Post("/api/user/orders", handler.OrderUploadHandler)
 	r.Get("/api/user/orders", handler.OrdersListHandler)
 	r.Get("/api/user/balance", handler.GetBalanceHandler)
-	r.Post("/api/user/balance/withdraw", handler.WithdrawHandler)
+	r.Get("/api/user/balance/history", handler.GetBalanceHistoryHandler)
+	r.With(storageHealthMW, idempotencyMW).Post("/api/user/balance/withdraw", handler.WithdrawHandler)
 	r.Get("/api/user/withdrawals", handler.GetWithdrawals)
+	r.Get("/api/user/merchants", handler.LinkedMerchantsHandler)
+	r.With(storageHealthMW).Put("/api/user/merchants/{merchantID}", handler.LinkMerchantHandler)
+	r.With(storageHealthMW).Delete("/api/user/merchants/{merchantID}", handler.UnlinkMerchantHandler)
+
+	//admin, every action is audited
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(middlewares.RequireRole(logger, storage, entities.RoleAdmin))
+		r.Get("/users/{login}", handler.AdminGetUserHandler)
+		r.With(storageHealthMW).Post("/users/{login}/balance", handler.AdminAdjustBalanceHandler)
+		r.With(storageHealthMW).Post("/users/{login}/unlock", handler.UnlockLoginHandler)
+		r.With(storageHealthMW).Post("/orders/{number}/requeue", handler.AdminRequeueOrderHandler)
+		r.With(storageHealthMW).Post("/merchants", handler.AdminCreateMerchantHandler)
+		r.With(storageHealthMW).Post("/merchants/{merchantID}/keys", handler.AdminCreateAPIKeyHandler)
+		r.With(storageHealthMW).Delete("/merchants/{merchantID}/keys/{keyID}", handler.AdminRevokeAPIKeyHandler)
+	})
+
+	//merchants, they act on behalf of users, who linked them, by api keys with scopes
+	r.Route("/api/merchant/users/{login}", func(r chi.Router) {
+		r.Use(middlewares.APIKeyMW(logger, storage, middlewares.NewKeyRateLimiter()))
+		r.With(middlewares.RequireScope(logger, entities.ScopeOrdersSubmit), handler.ActAsUserMW, storageHealthMW, idempotencyMW).Post("/orders", handler.OrderUploadHandler)
+		r.With(middlewares.RequireScope(logger, entities.ScopeBalanceRead), handler.ActAsUserMW).Get("/balance", handler.GetBalanceHandler)
+		r.With(middlewares.RequireScope(logger, entities.ScopePointsRedeem), handler.ActAsUserMW, storageHealthMW, idempotencyMW).Post("/balance/withdraw", handler.WithdrawHandler)
+	})
+
+	//public keys for other services
+	r.Get("/.well-known/jwks.json", handler.JWKSHandler)
+
+	//health
+	r.Get("/healthz", handler.LivenessHandler)
+	r.Get("/readyz", handler.ReadinessHandler)
 
 	return r
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+)
+
+// testRouterStorage is a handlers storage mock, token revocation and api keys aren`t used by tests
+type testRouterStorage struct {
+	*mock_handlers.MockStorageInt
+	middlewares.RevokedTokensStorageInt
+	middlewares.APIKeyStorageInt
+}
+
+// TestNewRouter_StorageOutage checks, that requests, which write, fail fast with 503 while a storage is down
+func TestNewRouter_StorageOutage(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set, a storage is never called while it is down
+	controller := gomock.NewController(t)
+	health := mock_handlers.NewMockHealthCheckerInt(controller)
+	health.EXPECT().Healthy().Return(false).AnyTimes()
+	storage := testRouterStorage{MockStorageInt: mock_handlers.NewMockStorageInt(controller)}
+
+	router := NewRouter(RouterDeps{Logger: *sugarLogger, Storage: storage, Health: health})
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "register", path: "/api/user/register"},
+		{name: "login", path: "/api/user/login"},
+		{name: "token refresh", path: "/api/user/token/refresh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"login":"user","password":"password"}`)))
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, "wrong status code")
+			assert.NotEmpty(t, res.Header.Get("Retry-After"), "no retry after")
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	"yandex_gophermart/pkg/security"
+)
+
+// refreshTokenCookiePath limits a refresh cookie to user endpoints, it is needed by refresh and logout only.
+const refreshTokenCookiePath = "/api/user"
+
+// CookieSettings are attributes of auth cookies.
+type CookieSettings struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+// AuthSettings are token lifetimes, auth cookie attributes and a default rate limit of merchant API keys.
+type AuthSettings struct {
+	AccessTokenTTL        time.Duration
+	RefreshTokenTTL       time.Duration
+	PasswordResetTokenTTL time.Duration
+	Cookies               CookieSettings
+	APIKeyRateLimit       int //requests per minute of a new key, if a rate limit isn`t given
+	PasswordResetLimits   RequestLimits
+}
+
+// RequestLimits are requests per login and per IP in a window, zero disables a limit.
+type RequestLimits struct {
+	PerLogin int
+	PerIP    int
+	Window   time.Duration
+}
+
+// tokensResponse gives tokens to API clients, which don`t use cookies.
+type tokensResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` //seconds
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens makes an access token and a refresh token of a new family (a new login).
+func (h *Handler) issueTokens(ctx context.Context, userID int) (tokensResponse, error) {
+	familyID, err := security.NewTokenID()
+	if err != nil {
+		return tokensResponse{}, err
+	}
+	refreshToken, refreshTokenHash, err := security.NewRefreshToken()
+	if err != nil {
+		return tokensResponse{}, err
+	}
+	now := time.Now()
+	err = h.Storage.SaveRefreshToken(ctx, entities.RefreshToken{
+		Hash:      refreshTokenHash,
+		FamilyID:  familyID,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.Auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return tokensResponse{}, err
+	}
+
+	return h.makeTokensResponse(ctx, userID, refreshToken)
+}
+
+// makeTokensResponse makes an access token with current roles of a user, so a granted role works after a refresh.
+func (h *Handler) makeTokensResponse(ctx context.Context, userID int, refreshToken string) (tokensResponse, error) {
+	roles, err := h.Storage.GetUserRoles(ctx, userID)
+	if err != nil {
+		return tokensResponse{}, err
+	}
+	jwtString, err := h.JWTH.BuildNewJWTString(userID, roles)
+	if err != nil {
+		return tokensResponse{}, err
+	}
+	return tokensResponse{
+		AccessToken:  jwtString,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.Auth.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// writeTokens sets tokens in cookies and in an "Authorization" header and writes them in a body with status 200.
+func (h *Handler) writeTokens(w http.ResponseWriter, tokens tokensResponse) {
+	jsonToRet, err := json.Marshal(tokens)
+	if err != nil {
+		h.Logger.Errorf("error while marshalling tokens: %v", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, h.authCookie(security.JWTCookieName, tokens.AccessToken, "/", h.Auth.AccessTokenTTL))
+	http.SetCookie(w, h.authCookie(security.RefreshTokenCookieName, tokens.RefreshToken, refreshTokenCookiePath, h.Auth.RefreshTokenTTL))
+	w.Header().Set("Authorization", "Bearer "+tokens.AccessToken)
+	//tokens mustn`t be cached by proxies
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonToRet)
+}
+
+func (h *Handler) authCookie(name string, value string, path string, ttl time.Duration) *http.Cookie {
+	maxAge := int(ttl.Seconds())
+	if value == "" {
+		maxAge = -1
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.Auth.Cookies.Domain,
+		MaxAge:   maxAge,
+		Secure:   h.Auth.Cookies.Secure,
+		HttpOnly: true,
+		SameSite: h.Auth.Cookies.SameSite,
+	}
+}
+
+func (h *Handler) clearTokenCookies(w http.ResponseWriter) {
+	http.SetCookie(w, h.authCookie(security.JWTCookieName, "", "/", 0))
+	http.SetCookie(w, h.authCookie(security.RefreshTokenCookieName, "", refreshTokenCookiePath, 0))
+}
+
+// refreshTokenFromRequest takes a refresh token from a cookie or, for API clients, from a JSON body.
+// Returns an empty string if there is no token.
+func refreshTokenFromRequest(r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(security.RefreshTokenCookieName); err == nil {
+		return cookie.Value, nil
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body.Close()
+	if len(bodyBytes) == 0 {
+		return "", nil
+	}
+	request := refreshTokenRequest{}
+	err = json.Unmarshal(bodyBytes, &request)
+	if err != nil {
+		return "", errors.Join(errors.New("cant unmarshal a refresh token request"), err)
+	}
+	return request.RefreshToken, nil
+}
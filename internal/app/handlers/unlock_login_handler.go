@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/go-chi/chi"
+	"net/http"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+)
+
+// UnlockLoginHandler removes a lockout and failed attempts of a login, so a user can log in at once.
+// A login is unlocked even if there is no such user, an attacker could lock it anyway.
+func (h *Handler) UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := h.adminID(w, r)
+	if !ok {
+		return
+	}
+	login := chi.URLParam(r, "login")
+	if login == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if h.LoginGuard == nil {
+		h.Logger.Debugf("login guard is not used, nothing to unlock")
+	} else {
+		err := h.LoginGuard.Unlock(r.Context(), login)
+		if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+			return
+		} else if err != nil {
+			h.Logger.Errorf("cant unlock login `%s`, err: %v", login, err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !h.audit(w, r, entities.AdminAuditRecord{
+		AdminID: adminID,
+		Action:  entities.AuditActionLoginUnlock,
+		Details: map[string]string{"login": login},
+	}) {
+		return
+	}
+
+	h.Logger.Infof("login `%s` was unlocked by admin %d", login, adminID)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
+	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
+)
+
+func TestHandler_UnlockLoginHandler(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//mocks set
+	controller := gomock.NewController(t)
+
+	adminID := 7
+
+	//request of an admin with a login in a route
+	newRequest := func(login string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/admin/users/"+login+"/unlock", nil)
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("login", login)
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeCtx)
+		return r.WithContext(context.WithValue(ctx, middlewares.UserIDContextKey, adminID))
+	}
+
+	//tests set
+	type fields struct {
+		Logger     zap.SugaredLogger
+		Storage    StorageInt
+		LoginGuard LoginGuardInt
+	}
+	type args struct {
+		w *httptest.ResponseRecorder
+		r *http.Request
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		args       args
+		statusWant int
+	}{
+		{
+			name: "normal",
+			fields: fields{
+				Logger: *sugarLogger,
+				Storage: func() StorageInt {
+					storage := mock_handlers.NewMockStorageInt(controller)
+					storage.EXPECT().SaveAdminAuditRecord(gomock.Any(), entities.AdminAuditRecord{
+						AdminID: adminID,
+						Action:  entities.AuditActionLoginUnlock,
+						Details: map[string]string{"login": "login"},
+					}).Return(nil)
+					return storage
+				}(),
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Unlock(gomock.Any(), "login").Return(nil)
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("login"),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "no login",
+			fields: fields{
+				Logger: *sugarLogger,
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest(""),
+			},
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name: "storage error",
+			fields: fields{
+				Logger: *sugarLogger,
+				LoginGuard: func() LoginGuardInt {
+					guard := mock_handlers.NewMockLoginGuardInt(controller)
+					guard.EXPECT().Unlock(gomock.Any(), "login").Return(errors.New("some test error"))
+					return guard
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: newRequest("login"),
+			},
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Logger:     tt.fields.Logger,
+				Storage:    tt.fields.Storage,
+				LoginGuard: tt.fields.LoginGuard,
+			}
+			h.UnlockLoginHandler(tt.args.w, tt.args.r)
+
+			assert.Equal(t, tt.statusWant, tt.args.w.Code, "wrong status code")
+		})
+	}
+}
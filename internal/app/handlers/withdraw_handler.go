@@ -40,13 +40,26 @@ func (h *Handler) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err = json.Unmarshal(bodyBytes, &data)
 	if err != nil {
-		h.Logger.Errorf("cant unmarshal request body: %v", err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		h.Logger.Debugf("cant unmarshal request body: %v", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	//check data (order num is checked with Luna`s alg, like uploaded orders)
+	ok, err = checkWithLuna(data.OrderNum)
+	if err != nil || !ok {
+		h.Logger.Debugf("order num `%s` is incorrect", data.OrderNum)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if data.Sum <= 0 {
+		h.Logger.Debugf("withdrawal sum should be positive, got %v", data.Sum)
+		w.WriteHeader(http.StatusUnprocessableEntity)
 		return
 	}
 
 	//withdraw from db
-	err = h.Storage.WithdrawFromBalance(r.Context(), userIDInt, data.OrderNum, data.Sum)
+	err = h.Storage.WithdrawFromBalance(r.Context(), userIDInt, data.OrderNum, data.Sum, merchantIDFromCtx(r))
 	if errors.Is(err, gophermarterrors.MakeErrNotEnoughPoints()) {
 		h.Logger.Debugf("Not enough money, err: %v", err)
 		w.WriteHeader(http.StatusPaymentRequired)
@@ -55,6 +68,12 @@ func (h *Handler) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 		h.Logger.Debugf("Order not found, err: %v", err)
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		return
+	} else if errors.Is(err, gophermarterrors.MakeErrWithdrawalAlreadyExists()) {
+		h.Logger.Debugf("Order was already paid with points, err: %v", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	} else if middlewares.WriteStorageUnavailable(h.Logger, w, err) {
+		return
 	} else if err != nil {
 		h.Logger.Errorf("cant withdraw points, err: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
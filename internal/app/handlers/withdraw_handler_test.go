@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,6 +16,7 @@ import (
 	"testing"
 	mock_handlers "yandex_gophermart/internal/app/handlers/mocks"
 	"yandex_gophermart/internal/app/middlewares"
+	"yandex_gophermart/pkg/entities"
 	gophermarterrors "yandex_gophermart/pkg/errors"
 )
 
@@ -31,13 +33,14 @@ func TestHandler_WithdrawHandler(t *testing.T) {
 	correctUserID := 1
 	correctOrderID := "2377225624"
 	correctSum := 750.0
-	makeRequestBody := func() io.Reader {
+	wrongOrderID := "2377225625"
+	makeRequestBody := func(order string, sum float64) io.Reader {
 		data := struct {
 			Order string
 			Sum   float64
 		}{
-			Order: correctOrderID,
-			Sum:   correctSum,
+			Order: order,
+			Sum:   sum,
 		}
 		jsonData, err := json.Marshal(data)
 		if err != nil {
@@ -66,13 +69,30 @@ func TestHandler_WithdrawHandler(t *testing.T) {
 				Logger: sugar,
 				Storage: func() StorageInt {
 					store := mock_handlers.NewMockStorageInt(controller)
-					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum).Return(nil)
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 0).Return(nil)
 					return store
 				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
-				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody()).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusOK,
+		},
+		{
+			name: "on behalf of a merchant",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 3).Return(nil)
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/merchant/users/login/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(
+					context.WithValue(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID), middlewares.APIKeyContextKey, entities.APIKey{ID: 1, MerchantID: 3})),
 			},
 			statusWant: http.StatusOK,
 		},
@@ -87,7 +107,7 @@ func TestHandler_WithdrawHandler(t *testing.T) {
 			},
 			args: args{
 				w: httptest.NewRecorder(),
-				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody()),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)),
 			},
 			statusWant: http.StatusUnauthorized,
 		},
@@ -97,13 +117,13 @@ func TestHandler_WithdrawHandler(t *testing.T) {
 				Logger: sugar,
 				Storage: func() StorageInt {
 					store := mock_handlers.NewMockStorageInt(controller)
-					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum).Return(gophermarterrors.MakeErrNotEnoughPoints())
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 0).Return(gophermarterrors.MakeErrNotEnoughPoints())
 					return store
 				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
-				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody()).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
 			},
 			statusWant: http.StatusPaymentRequired,
 		},
@@ -113,16 +133,93 @@ func TestHandler_WithdrawHandler(t *testing.T) {
 				Logger: sugar,
 				Storage: func() StorageInt {
 					store := mock_handlers.NewMockStorageInt(controller)
-					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum).Return(gophermarterrors.MakeErrOrderNotFound())
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 0).Return(gophermarterrors.MakeErrOrderNotFound())
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "wrong order number",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
 					return store
 				}(),
 			},
 			args: args{
 				w: httptest.NewRecorder(),
-				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody()).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(wrongOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
 			},
 			statusWant: http.StatusUnprocessableEntity,
 		},
+		{
+			name: "negative sum",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, -correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "order was already paid with points",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 0).Return(gophermarterrors.MakeErrWithdrawalAlreadyExists())
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusConflict,
+		},
+		{
+			name: "too many concurrent changes",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
+					store.EXPECT().WithdrawFromBalance(gomock.Any(), correctUserID, correctOrderID, correctSum, 0).Return(errors.Join(gophermarterrors.MakeErrTxRetriesExhausted(), errors.New("serialization failure")))
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", makeRequestBody(correctOrderID, correctSum)).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusServiceUnavailable,
+		},
+		{
+			name: "bad request",
+			fields: fields{
+				Logger: sugar,
+				Storage: func() StorageInt {
+					store := mock_handlers.NewMockStorageInt(controller)
+					return store
+				}(),
+			},
+			args: args{
+				w: httptest.NewRecorder(),
+				r: httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewReader([]byte("{\"order\":"))).WithContext(context.WithValue(context.Background(), middlewares.UserIDContextKey, correctUserID)),
+			},
+			statusWant: http.StatusBadRequest,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
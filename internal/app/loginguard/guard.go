@@ -0,0 +1,182 @@
+package loginguard
+
+import (
+	"context"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// maxDelayShift limits a delay growth, so a shift doesn`t overflow.
+const maxDelayShift = 30
+
+type StorageInt interface {
+	// AddLoginFailure counts a failure and returns an amount of failures in a row. A counter starts again
+	// if the previous failure was more than window ago.
+	AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	LockLoginAttempts(ctx context.Context, key string, until time.Time) error
+	// GetLoginLock returns a time, until which attempts are locked (zero time if they are not).
+	GetLoginLock(ctx context.Context, key string) (time.Time, error)
+	// ReleaseLoginFailure takes back one failure of a key.
+	ReleaseLoginFailure(ctx context.Context, key string) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+	DeleteExpiredLoginAttempts(ctx context.Context, olderThan time.Time) (int64, error)
+}
+
+// Policy limits failed logins by one key (a login or an IP). After every failure next attempts are delayed
+// for BaseDelay, 2*BaseDelay and so on up to MaxDelay. After Threshold failures in a row attempts are locked for Lockout.
+// Failures are in a row if there is less than Window between them. Zero Threshold disables a policy.
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+	Window    time.Duration
+}
+
+// lockFor returns how long attempts are locked after a failure.
+func (p Policy) lockFor(failures int) time.Duration {
+	if failures >= p.Threshold {
+		return p.Lockout
+	}
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	shift := min(failures-1, maxDelayShift)
+	delay := p.BaseDelay << shift
+	//a long base delay may overflow even with a limited shift, then it is as long as a lockout
+	if delay>>shift != p.BaseDelay {
+		delay = p.Lockout
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Guard counts failed logins per login and per IP. Every attempt is counted before a password is checked
+// and a successful one is taken back.
+type Guard struct {
+	storage     StorageInt
+	loginPolicy Policy
+	ipPolicy    Policy
+}
+
+func NewGuard(storage StorageInt, loginPolicy Policy, ipPolicy Policy) *Guard {
+	return &Guard{
+		storage:     storage,
+		loginPolicy: loginPolicy,
+		ipPolicy:    ipPolicy,
+	}
+}
+
+func loginKey(login string) string {
+	return "login:" + strings.ToLower(login)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Reserve counts an attempt as a failure before a password is checked, so concurrent attempts can`t get over
+// a threshold: every one of them gets its own count. It returns how long a client should wait before the next
+// attempt, zero means an attempt is allowed. An allowed attempt should end with Failure or Success.
+func (g *Guard) Reserve(ctx context.Context, login string, ip string) (entities.LoginAttempt, time.Duration, error) {
+	attempt := entities.LoginAttempt{Login: login, IP: ip}
+	keys := g.keys(login, ip)
+
+	var retryAfter time.Duration
+	for _, key := range keys {
+		lockedUntil, err := g.storage.GetLoginLock(ctx, key.key)
+		if err != nil {
+			return attempt, 0, err
+		}
+		retryAfter = max(retryAfter, time.Until(lockedUntil))
+	}
+	if retryAfter > 0 {
+		return attempt, retryAfter, nil
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		failures, err := g.storage.AddLoginFailure(ctx, key.key, now, key.policy.Window)
+		if err != nil {
+			return attempt, 0, err
+		}
+		if key.ip {
+			attempt.IPFailures = failures
+		} else {
+			attempt.LoginFailures = failures
+		}
+		//other attempts used up a threshold while this one was on its way
+		if failures > key.policy.Threshold {
+			err = g.storage.LockLoginAttempts(ctx, key.key, now.Add(key.policy.Lockout))
+			if err != nil {
+				return attempt, 0, err
+			}
+			retryAfter = max(retryAfter, key.policy.Lockout)
+		}
+	}
+	return attempt, retryAfter, nil
+}
+
+// Failure locks next attempts if it is needed, a failure itself was counted by Reserve.
+func (g *Guard) Failure(ctx context.Context, attempt entities.LoginAttempt) error {
+	now := time.Now()
+	for _, key := range g.keys(attempt.Login, attempt.IP) {
+		failures := attempt.LoginFailures
+		if key.ip {
+			failures = attempt.IPFailures
+		}
+		if lock := key.policy.lockFor(failures); lock > 0 {
+			err := g.storage.LockLoginAttempts(ctx, key.key, now.Add(lock))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Success resets a login counter and takes back an IP failure, counted by Reserve. An IP counter isn`t reset,
+// otherwise an attacker with one account could reset it.
+func (g *Guard) Success(ctx context.Context, attempt entities.LoginAttempt) error {
+	if g.loginPolicy.Threshold > 0 {
+		err := g.storage.ResetLoginAttempts(ctx, loginKey(attempt.Login))
+		if err != nil {
+			return err
+		}
+	}
+	if g.ipPolicy.Threshold > 0 && attempt.IPFailures > 0 {
+		return g.storage.ReleaseLoginFailure(ctx, ipKey(attempt.IP))
+	}
+	return nil
+}
+
+// Unlock removes a login lockout and its failures (used by admins).
+func (g *Guard) Unlock(ctx context.Context, login string) error {
+	return g.storage.ResetLoginAttempts(ctx, loginKey(login))
+}
+
+// DeleteExpired removes counters, which are neither locked nor can be continued.
+func (g *Guard) DeleteExpired(ctx context.Context) (int64, error) {
+	keep := max(g.loginPolicy.Window, g.ipPolicy.Window)
+	return g.storage.DeleteExpiredLoginAttempts(ctx, time.Now().Add(-keep))
+}
+
+type policyKey struct {
+	key    string
+	policy Policy
+	ip     bool
+}
+
+func (g *Guard) keys(login string, ip string) []policyKey {
+	keys := make([]policyKey, 0, 2)
+	if g.loginPolicy.Threshold > 0 {
+		keys = append(keys, policyKey{key: loginKey(login), policy: g.loginPolicy})
+	}
+	if g.ipPolicy.Threshold > 0 && ip != "" {
+		keys = append(keys, policyKey{key: ipKey(ip), policy: g.ipPolicy, ip: true})
+	}
+	return keys
+}
@@ -0,0 +1,126 @@
+package loginguard
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolicy_lockFor(t *testing.T) {
+	policy := Policy{Threshold: 5, BaseDelay: time.Second, MaxDelay: time.Second * 10, Lockout: time.Hour}
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", policy: policy, failures: 1, want: time.Second},
+		{name: "delay is doubled", policy: policy, failures: 3, want: time.Second * 4},
+		{name: "delay is capped", policy: policy, failures: 4, want: time.Second * 8},
+		{name: "threshold", policy: policy, failures: 5, want: time.Hour},
+		{name: "over threshold", policy: policy, failures: 6, want: time.Hour},
+		{name: "no delays", policy: Policy{Threshold: 5, Lockout: time.Hour}, failures: 2, want: 0},
+		{name: "max delay reached", policy: Policy{Threshold: 100, BaseDelay: time.Second, MaxDelay: time.Second * 10, Lockout: time.Hour}, failures: 5, want: time.Second * 10},
+		//a shift is limited, so a delay doesn`t overflow to a negative one
+		{name: "huge shift is capped", policy: Policy{Threshold: 1000, BaseDelay: time.Second, MaxDelay: time.Hour, Lockout: time.Hour}, failures: 200, want: time.Hour},
+		{name: "overflow without max delay", policy: Policy{Threshold: 1000, BaseDelay: time.Hour, Lockout: time.Hour * 24}, failures: 200, want: time.Hour * 24},
+		{name: "no overflow without max delay", policy: Policy{Threshold: 1000, BaseDelay: time.Millisecond, Lockout: time.Hour * 24}, failures: 200, want: time.Millisecond << maxDelayShift},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.lockFor(tt.failures)
+			assert.Equal(t, tt.want, got, "wrong lock")
+			assert.GreaterOrEqual(t, got, time.Duration(0), "negative lock")
+		})
+	}
+}
+
+func TestGuard_ReserveAndFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	guard := NewGuard(storage,
+		Policy{Threshold: 3, Lockout: time.Hour, Window: time.Hour},
+		Policy{Threshold: 10, Lockout: time.Hour, Window: time.Hour})
+
+	for i := 1; i <= 3; i++ {
+		attempt, retryAfter, err := guard.Reserve(ctx, "Login", "192.0.2.1")
+		require.NoError(t, err, "cant reserve an attempt")
+		assert.Zero(t, retryAfter, "attempt %d is locked", i)
+		assert.Equal(t, i, attempt.LoginFailures, "wrong login failures")
+		assert.Equal(t, i, attempt.IPFailures, "wrong ip failures")
+		require.NoError(t, guard.Failure(ctx, attempt), "cant count a failure")
+	}
+
+	//a login is locked after a threshold, in any case
+	_, retryAfter, err := guard.Reserve(ctx, "login", "192.0.2.2")
+	require.NoError(t, err, "cant reserve an attempt")
+	assert.InDelta(t, time.Hour, retryAfter, float64(time.Second), "login isn`t locked")
+
+	//an admin unlocks a login
+	require.NoError(t, guard.Unlock(ctx, "login"), "cant unlock a login")
+	_, retryAfter, err = guard.Reserve(ctx, "login", "192.0.2.2")
+	require.NoError(t, err, "cant reserve an attempt")
+	assert.Zero(t, retryAfter, "login is locked after an unlock")
+}
+
+func TestGuard_Success(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	guard := NewGuard(storage,
+		Policy{Threshold: 3, Lockout: time.Hour, Window: time.Hour},
+		Policy{Threshold: 3, Lockout: time.Hour, Window: time.Hour})
+
+	attempt, _, err := guard.Reserve(ctx, "login", "192.0.2.1")
+	require.NoError(t, err, "cant reserve an attempt")
+	require.NoError(t, guard.Failure(ctx, attempt), "cant count a failure")
+	attempt, _, err = guard.Reserve(ctx, "login", "192.0.2.1")
+	require.NoError(t, err, "cant reserve an attempt")
+	require.NoError(t, guard.Success(ctx, attempt), "cant count a success")
+
+	//a login counter is reset, a successful attempt is taken back from an ip counter, a failure stays
+	attempt, _, err = guard.Reserve(ctx, "login", "192.0.2.1")
+	require.NoError(t, err, "cant reserve an attempt")
+	assert.Equal(t, 1, attempt.LoginFailures, "login counter isn`t reset")
+	assert.Equal(t, 2, attempt.IPFailures, "wrong ip failures")
+}
+
+func TestGuard_ConcurrentReserve(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemoryStorage(), Policy{Threshold: 3, Lockout: time.Hour, Window: time.Hour}, Policy{})
+
+	//attempts, which are checked at the same time, get their own counts, so only a threshold of them is allowed
+	var allowed int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, retryAfter, err := guard.Reserve(ctx, "login", "192.0.2.1")
+			assert.NoError(t, err, "cant reserve an attempt")
+			if retryAfter == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, allowed, "wrong amount of allowed attempts")
+}
+
+func TestGuard_DisabledPolicies(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemoryStorage(), Policy{}, Policy{})
+
+	for i := 0; i < 10; i++ {
+		attempt, retryAfter, err := guard.Reserve(ctx, "login", "192.0.2.1")
+		require.NoError(t, err, "cant reserve an attempt")
+		assert.Zero(t, retryAfter, "attempt is locked by a disabled policy")
+		assert.Zero(t, attempt.LoginFailures, "failures are counted by a disabled policy")
+		require.NoError(t, guard.Failure(ctx, attempt), "cant count a failure")
+	}
+}
@@ -0,0 +1,95 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type attempts struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// MemoryStorage keeps counters of one instance of the service. It is lost on a restart.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	attempts map[string]*attempts
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		attempts: make(map[string]*attempts),
+	}
+}
+
+func (m *MemoryStorage) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		a = &attempts{}
+		m.attempts[key] = a
+	}
+	if a.lastFailureAt.Before(now.Add(-window)) {
+		a.failures = 0
+	}
+	a.failures++
+	a.lastFailureAt = now
+	return a.failures, nil
+}
+
+func (m *MemoryStorage) ReleaseLoginFailure(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok && a.failures > 0 {
+		a.failures--
+	}
+	return nil
+}
+
+func (m *MemoryStorage) LockLoginAttempts(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok {
+		a.lockedUntil = until
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetLoginLock(ctx context.Context, key string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok {
+		return a.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (m *MemoryStorage) ResetLoginAttempts(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteExpiredLoginAttempts(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for key, a := range m.attempts {
+		if a.lastFailureAt.Before(olderThan) && a.lockedUntil.Before(now) {
+			delete(m.attempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
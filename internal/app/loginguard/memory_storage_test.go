@@ -0,0 +1,85 @@
+package loginguard
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage_AddLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	now := time.Now()
+
+	failures, err := storage.AddLoginFailure(ctx, "login:a", now, time.Minute)
+	require.NoError(t, err, "cant add a failure")
+	assert.Equal(t, 1, failures, "wrong failures")
+	failures, _ = storage.AddLoginFailure(ctx, "login:a", now.Add(time.Second*30), time.Minute)
+	assert.Equal(t, 2, failures, "failures in a row aren`t counted")
+	failures, _ = storage.AddLoginFailure(ctx, "login:b", now, time.Minute)
+	assert.Equal(t, 1, failures, "keys aren`t counted separately")
+
+	//a counter starts again after a window
+	failures, _ = storage.AddLoginFailure(ctx, "login:a", now.Add(time.Minute*2), time.Minute)
+	assert.Equal(t, 1, failures, "counter isn`t started again after a window")
+}
+
+func TestMemoryStorage_ReleaseLoginFailure(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	now := time.Now()
+
+	storage.AddLoginFailure(ctx, "ip:a", now, time.Minute)
+	storage.AddLoginFailure(ctx, "ip:a", now, time.Minute)
+	require.NoError(t, storage.ReleaseLoginFailure(ctx, "ip:a"), "cant release a failure")
+	failures, _ := storage.AddLoginFailure(ctx, "ip:a", now, time.Minute)
+	assert.Equal(t, 2, failures, "failure isn`t released")
+
+	//a counter doesn`t go below zero and an unknown key is fine
+	storage.ReleaseLoginFailure(ctx, "ip:a")
+	storage.ReleaseLoginFailure(ctx, "ip:a")
+	storage.ReleaseLoginFailure(ctx, "ip:a")
+	failures, _ = storage.AddLoginFailure(ctx, "ip:a", now, time.Minute)
+	assert.Equal(t, 1, failures, "counter went below zero")
+	assert.NoError(t, storage.ReleaseLoginFailure(ctx, "ip:unknown"), "unknown key is an error")
+}
+
+func TestMemoryStorage_Locks(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	now := time.Now()
+
+	lockedUntil, err := storage.GetLoginLock(ctx, "login:a")
+	require.NoError(t, err, "cant get a lock")
+	assert.True(t, lockedUntil.IsZero(), "unknown key is locked")
+
+	storage.AddLoginFailure(ctx, "login:a", now, time.Minute)
+	require.NoError(t, storage.LockLoginAttempts(ctx, "login:a", now.Add(time.Hour)), "cant lock a key")
+	lockedUntil, _ = storage.GetLoginLock(ctx, "login:a")
+	assert.Equal(t, now.Add(time.Hour), lockedUntil, "wrong lock")
+
+	require.NoError(t, storage.ResetLoginAttempts(ctx, "login:a"), "cant reset a key")
+	lockedUntil, _ = storage.GetLoginLock(ctx, "login:a")
+	assert.True(t, lockedUntil.IsZero(), "key is locked after a reset")
+}
+
+func TestMemoryStorage_DeleteExpiredLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage()
+	now := time.Now()
+
+	storage.AddLoginFailure(ctx, "login:old", now.Add(-time.Hour), time.Minute)
+	storage.AddLoginFailure(ctx, "login:locked", now.Add(-time.Hour), time.Minute)
+	storage.LockLoginAttempts(ctx, "login:locked", now.Add(time.Hour))
+	storage.AddLoginFailure(ctx, "login:fresh", now, time.Minute)
+
+	deleted, err := storage.DeleteExpiredLoginAttempts(ctx, now.Add(-time.Minute))
+	require.NoError(t, err, "cant delete expired attempts")
+	assert.Equal(t, int64(1), deleted, "wrong amount of deleted counters")
+	lockedUntil, _ := storage.GetLoginLock(ctx, "login:locked")
+	assert.False(t, lockedUntil.IsZero(), "locked counter is deleted")
+	failures, _ := storage.AddLoginFailure(ctx, "login:fresh", now, time.Minute)
+	assert.Equal(t, 2, failures, "fresh counter is deleted")
+}
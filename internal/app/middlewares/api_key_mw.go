@@ -0,0 +1,124 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+const (
+	APIKeyHeader                      = "X-API-Key"
+	APIKeyContextKey ContextKeyString = "apiKey"
+)
+
+// APIKeyStorageInt finds active keys of merchants.
+type APIKeyStorageInt interface {
+	GetAPIKey(ctx context.Context, hash string) (entities.APIKey, error)
+}
+
+// KeyRateLimiter is a token bucket per API key: a key may send RateLimit requests at once,
+// then one request per 1/RateLimit of a minute. Buckets are kept in memory, so every instance
+// of the service limits keys on its own.
+type KeyRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[int]*tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewKeyRateLimiter() *KeyRateLimiter {
+	return &KeyRateLimiter{
+		buckets: make(map[int]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token of a key. If there is no token, it returns false and how long to wait for one.
+func (l *KeyRateLimiter) Allow(key entities.APIKey) (bool, time.Duration) {
+	perSecond := float64(key.RateLimit) / 60
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key.ID]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(key.RateLimit), updated: now}
+		l.buckets[key.ID] = bucket
+	}
+	bucket.tokens = math.Min(float64(key.RateLimit), bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// APIKeyMW authenticates merchants by a key in the X-API-Key header and limits their requests.
+// It is used instead of AuthMW for merchant routes, a key is put in request.ctx.
+func APIKeyMW(logger zap.SugaredLogger, keys APIKeyStorageInt, limiter *KeyRateLimiter) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get(APIKeyHeader)
+			if header == "" {
+				logger.Debugf("no api key in a request, path - %s", r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			key, err := keys.GetAPIKey(r.Context(), security.HashAPIKey(header))
+			if errors.Is(err, gophermarterrors.MakeErrAPIKeyNotFound()) {
+				logger.Warnf("unknown or revoked api key `%s`, path - %s", security.APIKeyPrefix(header), r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				logger.Errorf("cant check an api key, err: %v", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if ok, wait := limiter.Allow(key); !ok {
+				logger.Debugf("api key %d of merchant %d is rate limited", key.ID, key.MerchantID)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key)))
+		})
+	}
+}
+
+// RequireScope lets a request through only if its API key has a scope. It should be used after APIKeyMW.
+func RequireScope(logger zap.SugaredLogger, scope string) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(APIKeyContextKey).(entities.APIKey)
+			if !ok {
+				logger.Debugf("api key wasn`t found in ctx, path - %s", r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(key.Scopes, scope) {
+				logger.Warnf("api key %d has no scope `%s`, path - %s", key.ID, scope, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// testAPIKeys is a key storage for tests, it returns err if it is set.
+type testAPIKeys struct {
+	byHash map[string]entities.APIKey
+	err    error
+}
+
+func (k testAPIKeys) GetAPIKey(ctx context.Context, hash string) (entities.APIKey, error) {
+	if k.err != nil {
+		return entities.APIKey{}, k.err
+	}
+	key, ok := k.byHash[hash]
+	if !ok {
+		return entities.APIKey{}, gophermarterrors.MakeErrAPIKeyNotFound()
+	}
+	return key, nil
+}
+
+// fakeClock is a time source of a limiter, which moves only when a test moves it.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter() (*KeyRateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewKeyRateLimiter()
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestAPIKeyMW(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//data set
+	key, keyHash, err := security.NewAPIKey()
+	assert.NoError(t, err, "cant make an api key")
+	testKey := entities.APIKey{ID: 1, MerchantID: 3, Scopes: []string{entities.ScopeBalanceRead}, RateLimit: 60}
+
+	newRequest := func(key string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/merchant/users/login/balance", nil)
+		if key != "" {
+			r.Header.Set(APIKeyHeader, key)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		keys       testAPIKeys
+		r          *http.Request
+		statusWant int
+	}{
+		{
+			name:       "normal",
+			keys:       testAPIKeys{byHash: map[string]entities.APIKey{keyHash: testKey}},
+			r:          newRequest(key),
+			statusWant: http.StatusOK,
+		},
+		{
+			name:       "unknown key",
+			keys:       testAPIKeys{byHash: map[string]entities.APIKey{keyHash: testKey}},
+			r:          newRequest("gm_unknown"),
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name:       "no key",
+			keys:       testAPIKeys{byHash: map[string]entities.APIKey{keyHash: testKey}},
+			r:          newRequest(""),
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name:       "storage error",
+			keys:       testAPIKeys{err: errors.New("some test error")},
+			r:          newRequest(key),
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, _ := newTestLimiter()
+			w := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, testKey, r.Context().Value(APIKeyContextKey), "wrong key in ctx")
+				w.WriteHeader(http.StatusOK)
+			})
+			APIKeyMW(*sugarLogger, tt.keys, limiter)(next).ServeHTTP(w, tt.r)
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+		})
+	}
+}
+
+func TestAPIKeyMW_RateLimit(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//data set
+	key, keyHash, err := security.NewAPIKey()
+	assert.NoError(t, err, "cant make an api key")
+	keys := testAPIKeys{byHash: map[string]entities.APIKey{keyHash: {ID: 1, MerchantID: 3, RateLimit: 2}}}
+	limiter, clock := newTestLimiter()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := APIKeyMW(*sugarLogger, keys, limiter)(next)
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/merchant/users/login/balance", nil)
+		r.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request().Code, "first request is limited")
+	assert.Equal(t, http.StatusOK, request().Code, "second request is limited")
+	w := request()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "third request isn`t limited")
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "wrong retry delay")
+
+	//a token is back after 1/RateLimit of a minute
+	clock.now = clock.now.Add(time.Second * 30)
+	assert.Equal(t, http.StatusOK, request().Code, "request after a delay is limited")
+}
+
+func TestKeyRateLimiter_Allow(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	key := entities.APIKey{ID: 1, RateLimit: 3}
+	otherKey := entities.APIKey{ID: 2, RateLimit: 1}
+
+	//a burst of RateLimit requests
+	for i := 0; i < key.RateLimit; i++ {
+		ok, _ := limiter.Allow(key)
+		assert.True(t, ok, "request %d of a burst is limited", i)
+	}
+	ok, wait := limiter.Allow(key)
+	assert.False(t, ok, "request after a burst isn`t limited")
+	assert.Equal(t, time.Second*20, wait, "wrong wait for a token")
+
+	//keys have their own buckets
+	ok, _ = limiter.Allow(otherKey)
+	assert.True(t, ok, "other key is limited")
+
+	//half of a token isn`t enough
+	clock.now = clock.now.Add(time.Second * 10)
+	ok, wait = limiter.Allow(key)
+	assert.False(t, ok, "request with half of a token isn`t limited")
+	assert.Equal(t, time.Second*10, wait, "wrong wait for the rest of a token")
+
+	clock.now = clock.now.Add(time.Second * 10)
+	ok, _ = limiter.Allow(key)
+	assert.True(t, ok, "request with a token is limited")
+
+	//a bucket isn`t filled over its capacity after a long pause
+	clock.now = clock.now.Add(time.Hour)
+	for i := 0; i < key.RateLimit; i++ {
+		ok, _ := limiter.Allow(key)
+		assert.True(t, ok, "request %d after a pause is limited", i)
+	}
+	ok, _ = limiter.Allow(key)
+	assert.False(t, ok, "bucket has more tokens than its capacity")
+}
+
+func TestRequireScope(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	withKey := func(key entities.APIKey) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/merchant/users/login/orders", nil)
+		return r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key))
+	}
+
+	tests := []struct {
+		name       string
+		r          *http.Request
+		statusWant int
+	}{
+		{
+			name:       "key with a scope",
+			r:          withKey(entities.APIKey{ID: 1, Scopes: []string{entities.ScopeBalanceRead, entities.ScopeOrdersSubmit}}),
+			statusWant: http.StatusOK,
+		},
+		{
+			name:       "key without a scope",
+			r:          withKey(entities.APIKey{ID: 1, Scopes: []string{entities.ScopeBalanceRead}}),
+			statusWant: http.StatusForbidden,
+		},
+		{
+			name:       "no key",
+			r:          httptest.NewRequest(http.MethodPost, "/api/merchant/users/login/orders", nil),
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			RequireScope(*sugarLogger, entities.ScopeOrdersSubmit)(next).ServeHTTP(w, tt.r)
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+		})
+	}
+}
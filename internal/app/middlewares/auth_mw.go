@@ -6,17 +6,38 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
 	gophermarterrors "yandex_gophermart/pkg/errors"
 	"yandex_gophermart/pkg/security"
 )
 
 type ContextKeyString string
 
-const UserIDContextKey ContextKeyString = "userID"
+const (
+	UserIDContextKey      ContextKeyString = "userID"
+	TokenClaimsContextKey ContextKeyString = "tokenClaims"
+)
+
+type JWTParserInt interface {
+	ParseToken(token string) (security.TokenClaims, error)
+}
 
-func AuthMW(logger zap.SugaredLogger) func(handler http.Handler) http.Handler {
+// RevokedTokensStorageInt says if a token was revoked by a logout or by a password change of its user.
+type RevokedTokensStorageInt interface {
+	IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (bool, error)
+}
+
+// AuthMW puts a user id and token claims of a valid access token in request.ctx. If the revoked tokens storage
+// is unavailable, a request gets 503 and "Retry-After" instead of 500, so a client retries it later.
+func AuthMW(logger zap.SugaredLogger, jwtParser JWTParserInt, revokedTokens RevokedTokensStorageInt, health HealthCheckerInt) func(handler http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			//merchant routes are checked by an api key
+			if strings.HasPrefix(r.URL.Path, "/api/merchant/") {
+				logger.Debugf("no user auth needed, serving requst: %s", r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
 			switch r.URL.Path {
 			case "/api/user/register":
 				{
@@ -24,7 +45,13 @@ func AuthMW(logger zap.SugaredLogger) func(handler http.Handler) http.Handler {
 					next.ServeHTTP(w, r)
 					return
 				}
-			case "/api/user/login":
+			case "/api/user/login", "/api/user/token/refresh", "/api/user/password/reset", "/api/user/password/reset/confirm":
+				{
+					logger.Debugf("no auth needed, serving requst: %s", r.URL.Path)
+					next.ServeHTTP(w, r)
+					return
+				}
+			case "/healthz", "/readyz", "/.well-known/jwks.json":
 				{
 					logger.Debugf("no auth needed, serving requst: %s", r.URL.Path)
 					next.ServeHTTP(w, r)
@@ -32,26 +59,22 @@ func AuthMW(logger zap.SugaredLogger) func(handler http.Handler) http.Handler {
 				}
 			default:
 				{
-					//Get JWT cookie
-					JWTCookie, err := r.Cookie(security.JWTCookieName)
-					if errors.Is(err, http.ErrNoCookie) {
-						logger.Debugf("cant find any JWT in cookies, err: %v", err.Error())
+					//Get JWT from a header or a cookie
+					token, err := tokenFromRequest(r)
+					if err != nil {
+						logger.Debugf("cant find JWT in a request, err: %v", err.Error())
 						w.WriteHeader(http.StatusUnauthorized)
 						return
-					} else if err != nil {
-						logger.Errorf("error while trying to get JWT from cookies, err: %v", err.Error())
-						w.WriteHeader(http.StatusInternalServerError)
-						return
 					}
 
 					//Get userID from JWT
-					JWTHelper := security.NewJWTHelper()
-					userID, err := JWTHelper.GetUserID(JWTCookie.Value)
-					if errors.Is(err, gophermarterrors.MakeErrJWTTokenIsNotValid()) {
+					claims, err := jwtParser.ParseToken(token)
+					if errors.Is(err, jwt.ErrTokenExpired) {
+						logger.Debugf("JWT token expired, err: %v", err.Error())
 						w.WriteHeader(http.StatusUnauthorized)
 						return
-					} else if errors.Is(err, jwt.ErrTokenExpired) {
-						logger.Errorf("JWT token expired, err: %v", err.Error())
+					} else if errors.Is(err, gophermarterrors.MakeErrJWTTokenIsNotValid()) {
+						logger.Debugf("JWT token is not valid, err: %v", err.Error())
 						w.WriteHeader(http.StatusUnauthorized)
 						return
 					} else if err != nil {
@@ -60,12 +83,50 @@ func AuthMW(logger zap.SugaredLogger) func(handler http.Handler) http.Handler {
 						return
 					}
 
-					//Put userID in request.ctx
+					//Check if a token was revoked by a logout or a password change
+					revoked, err := revokedTokens.IsAccessTokenRevoked(r.Context(), claims)
+					if WriteStorageUnavailable(logger, w, err) {
+						return
+					} else if err != nil && health != nil && !health.Healthy() {
+						logger.Warnf("storage is unavailable, cant check if JWT token was revoked, err: %v", err.Error())
+						w.Header().Set("Retry-After", storageDownRetryAfter)
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					} else if err != nil {
+						logger.Errorf("cant check if JWT token was revoked, err: %v", err.Error())
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					} else if revoked {
+						logger.Debugf("JWT token was revoked")
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+
+					//Put userID and token claims in request.ctx
 					logger.Debugf("user was authenticated, path - %s", r.URL.Path)
-					ctxWithUserID := context.WithValue(r.Context(), UserIDContextKey, userID)
+					ctxWithUserID := context.WithValue(r.Context(), UserIDContextKey, claims.UserID)
+					ctxWithUserID = context.WithValue(ctxWithUserID, TokenClaimsContextKey, claims)
 					next.ServeHTTP(w, r.WithContext(ctxWithUserID))
 				}
 			}
 		})
 	}
 }
+
+// tokenFromRequest takes a token from an "Authorization: Bearer" header (API clients) or from a cookie (browsers).
+// A header is preferred, a malformed header is an error even if there is a cookie.
+func tokenFromRequest(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", errors.New("authorization header should look like `Bearer <token>`")
+		}
+		return strings.TrimSpace(token), nil
+	}
+
+	cookie, err := r.Cookie(security.JWTCookieName)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// testJWTParser accepts only its own token.
+type testJWTParser struct {
+	token  string
+	claims security.TokenClaims
+}
+
+func (p testJWTParser) ParseToken(token string) (security.TokenClaims, error) {
+	if token != p.token {
+		return security.TokenClaims{}, gophermarterrors.MakeErrJWTTokenIsNotValid()
+	}
+	return p.claims, nil
+}
+
+// testRevokedTokens answers every check with revoked and err.
+type testRevokedTokens struct {
+	revoked bool
+	err     error
+}
+
+func (s testRevokedTokens) IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (bool, error) {
+	return s.revoked, s.err
+}
+
+type testHealth bool
+
+func (h testHealth) Healthy() bool {
+	return bool(h)
+}
+
+func TestAuthMW(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	//data set
+	parser := testJWTParser{token: "someTestJWT", claims: security.TokenClaims{UserID: 1, ID: "tokenID"}}
+	newRequest := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name           string
+		revokedTokens  testRevokedTokens
+		health         testHealth
+		r              *http.Request
+		statusWant     int
+		retryAfterWant string
+	}{
+		{
+			name:       "normal",
+			health:     true,
+			r:          newRequest("someTestJWT"),
+			statusWant: http.StatusOK,
+		},
+		{
+			name:       "no token",
+			health:     true,
+			r:          newRequest(""),
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			health:     true,
+			r:          newRequest("otherJWT"),
+			statusWant: http.StatusUnauthorized,
+		},
+		{
+			name:          "revoked token",
+			revokedTokens: testRevokedTokens{revoked: true},
+			health:        true,
+			r:             newRequest("someTestJWT"),
+			statusWant:    http.StatusUnauthorized,
+		},
+		{
+			name:           "storage timeout",
+			revokedTokens:  testRevokedTokens{err: errors.Join(gophermarterrors.MakeErrQueryTimeout(), errors.New("deadline exceeded"))},
+			health:         true,
+			r:              newRequest("someTestJWT"),
+			statusWant:     http.StatusServiceUnavailable,
+			retryAfterWant: StorageBusyRetryAfter,
+		},
+		{
+			name:           "storage is down",
+			revokedTokens:  testRevokedTokens{err: errors.New("connection refused")},
+			health:         false,
+			r:              newRequest("someTestJWT"),
+			statusWant:     http.StatusServiceUnavailable,
+			retryAfterWant: storageDownRetryAfter,
+		},
+		{
+			name:          "storage error",
+			revokedTokens: testRevokedTokens{err: errors.New("some test error")},
+			health:        true,
+			r:             newRequest("someTestJWT"),
+			statusWant:    http.StatusInternalServerError,
+		},
+		{
+			name:       "no auth needed",
+			health:     true,
+			r:          httptest.NewRequest(http.MethodPost, "/api/user/login", nil),
+			statusWant: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			AuthMW(*sugarLogger, parser, tt.revokedTokens, tt.health)(next).ServeHTTP(w, tt.r)
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+			assert.Equal(t, tt.retryAfterWant, w.Header().Get("Retry-After"), "wrong retry delay")
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+type IdempotencyStorageInt interface {
+	ReserveIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord, ttl time.Duration, lease time.Duration) (entities.IdempotencyRecord, bool, error)
+	SaveIdempotentResponse(ctx context.Context, record entities.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord) error
+}
+
+// responseRecorder passes a response through and keeps a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// IdempotencySettings sets how long responses are kept (TTL) and how long a request in progress holds its key (Lease).
+// A key of a request, which crashed before its response was saved, can be used again after Lease.
+type IdempotencySettings struct {
+	TTL   time.Duration
+	Lease time.Duration
+}
+
+// IdempotencyMW replays a saved response if a request is repeated with the same "Idempotency-Key" header.
+// Should be used after AuthMW, keys are unique per user.
+func IdempotencyMW(logger zap.SugaredLogger, storage IdempotencyStorageInt, settings IdempotencySettings) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				logger.Debugf("idempotency key is too long")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			//get userID
+			userID, ok := r.Context().Value(UserIDContextKey).(int)
+			if !ok {
+				logger.Debugf("user id wasn`t found in ctx, idempotency key is ignored")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			//make a request fingerprint
+			bodyBytes, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Errorf("error while reading body: %v", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			hasher := sha256.New()
+			hasher.Write([]byte(r.Method + "\n" + r.URL.Path + "\n"))
+			hasher.Write(bodyBytes)
+			fingerprint := hex.EncodeToString(hasher.Sum(nil))
+
+			//reserve a key
+			record, reserved, err := storage.ReserveIdempotencyKey(r.Context(), entities.IdempotencyRecord{
+				UserID:      userID,
+				Key:         key,
+				Fingerprint: fingerprint,
+			}, settings.TTL, settings.Lease)
+			if WriteStorageUnavailable(logger, w, err) {
+				return
+			} else if err != nil {
+				logger.Errorf("cant reserve an idempotency key, err: %v", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case record.Fingerprint != fingerprint:
+					logger.Debugf("idempotency key `%s` was used with a different request", key)
+					w.WriteHeader(http.StatusUnprocessableEntity)
+				case record.StatusCode == 0:
+					logger.Debugf("request with idempotency key `%s` is still in progress", key)
+					//a key is free after a lease, if a request in progress crashed
+					retryAfter := max(time.Until(record.CreatedAt.Add(settings.Lease)), time.Second)
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+					w.WriteHeader(http.StatusConflict)
+				default:
+					logger.Debugf("replaying a response for idempotency key `%s`", key)
+					if record.ContentType != "" {
+						w.Header().Set("Content-Type", record.ContentType)
+					}
+					w.Header().Set(IdempotentReplayedHeader, "true")
+					w.WriteHeader(record.StatusCode)
+					w.Write(record.Body)
+				}
+				return
+			}
+
+			//serve and save a response
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if recorder.statusCode == 0 {
+				recorder.statusCode = http.StatusOK
+			}
+
+			saveCtx := context.WithoutCancel(r.Context())
+			if recorder.statusCode >= http.StatusInternalServerError {
+				//server errors are not saved, so a client can retry
+				err = storage.DeleteIdempotencyKey(saveCtx, record)
+				if errors.Is(err, gophermarterrors.MakeErrIdempotencyLeaseLost()) {
+					logger.Warnf("idempotency key `%s` was taken over by a retry, it isn`t released", key)
+				} else if err != nil {
+					logger.Errorf("cant release an idempotency key, err: %v", err.Error())
+				}
+				return
+			}
+			record.StatusCode = recorder.statusCode
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.Body = recorder.body.Bytes()
+			err = storage.SaveIdempotentResponse(saveCtx, record)
+			if errors.Is(err, gophermarterrors.MakeErrIdempotencyLeaseLost()) {
+				//a retry owns the key now, its response is kept
+				logger.Warnf("idempotency key `%s` was taken over by a retry, a response isn`t saved", key)
+			} else if err != nil {
+				logger.Errorf("cant save an idempotent response, err: %v", err.Error())
+			}
+		})
+	}
+}
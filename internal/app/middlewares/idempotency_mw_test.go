@@ -0,0 +1,187 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+)
+
+// testIdempotencyStorage is an idempotency storage for tests. A key is reserved if there is no existing record.
+type testIdempotencyStorage struct {
+	existing   *entities.IdempotencyRecord
+	reserveErr error
+	saveErr    error
+	saved      *entities.IdempotencyRecord
+	deleted    bool
+}
+
+func (s *testIdempotencyStorage) ReserveIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord, ttl time.Duration, lease time.Duration) (entities.IdempotencyRecord, bool, error) {
+	if s.reserveErr != nil {
+		return entities.IdempotencyRecord{}, false, s.reserveErr
+	}
+	if s.existing != nil {
+		return *s.existing, false, nil
+	}
+	return record, true, nil
+}
+
+func (s *testIdempotencyStorage) SaveIdempotentResponse(ctx context.Context, record entities.IdempotencyRecord) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.saved = &record
+	return nil
+}
+
+func (s *testIdempotencyStorage) DeleteIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord) error {
+	s.deleted = true
+	return nil
+}
+
+func TestIdempotencyMW(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+	settings := IdempotencySettings{TTL: time.Hour, Lease: time.Minute}
+
+	const body = `{"order":"2377225624","sum":10}`
+	newRequest := func(key string, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		return r.WithContext(context.WithValue(r.Context(), UserIDContextKey, 1))
+	}
+	//fingerprint of the request above, made by the first request
+	probe := &testIdempotencyStorage{}
+	IdempotencyMW(*sugarLogger, probe, settings)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), newRequest("key", body))
+	require.NotNil(t, probe.saved, "response of a new key isn`t saved")
+	fingerprint := probe.saved.Fingerprint
+
+	tests := []struct {
+		name           string
+		storage        *testIdempotencyStorage
+		r              *http.Request
+		handlerStatus  int
+		statusWant     int
+		wantCalled     bool
+		wantSaved      bool
+		wantDeleted    bool
+		wantReplayed   bool
+		wantRetryAfter string
+	}{
+		{
+			name:          "no key",
+			storage:       &testIdempotencyStorage{},
+			r:             newRequest("", body),
+			handlerStatus: http.StatusOK,
+			statusWant:    http.StatusOK,
+			wantCalled:    true,
+		},
+		{
+			name:       "too long key",
+			storage:    &testIdempotencyStorage{},
+			r:          newRequest(strings.Repeat("k", maxIdempotencyKeyLength+1), body),
+			statusWant: http.StatusBadRequest,
+		},
+		{
+			name:          "new key",
+			storage:       &testIdempotencyStorage{},
+			r:             newRequest("key", body),
+			handlerStatus: http.StatusOK,
+			statusWant:    http.StatusOK,
+			wantCalled:    true,
+			wantSaved:     true,
+		},
+		{
+			//a retry took the key over after a lease, a client still gets its response
+			name:          "lost lease",
+			storage:       &testIdempotencyStorage{saveErr: gophermarterrors.MakeErrIdempotencyLeaseLost()},
+			r:             newRequest("key", body),
+			handlerStatus: http.StatusOK,
+			statusWant:    http.StatusOK,
+			wantCalled:    true,
+		},
+		{
+			name:          "server error releases a key",
+			storage:       &testIdempotencyStorage{},
+			r:             newRequest("key", body),
+			handlerStatus: http.StatusInternalServerError,
+			statusWant:    http.StatusInternalServerError,
+			wantCalled:    true,
+			wantDeleted:   true,
+		},
+		{
+			name: "saved response",
+			storage: &testIdempotencyStorage{existing: &entities.IdempotencyRecord{
+				Fingerprint: fingerprint, StatusCode: http.StatusOK, ContentType: "application/json", Body: []byte(`{}`), CreatedAt: time.Now(),
+			}},
+			r:            newRequest("key", body),
+			statusWant:   http.StatusOK,
+			wantReplayed: true,
+		},
+		{
+			name: "key of other request",
+			storage: &testIdempotencyStorage{existing: &entities.IdempotencyRecord{
+				Fingerprint: "other", StatusCode: http.StatusOK, CreatedAt: time.Now(),
+			}},
+			r:          newRequest("key", body),
+			statusWant: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "request in progress",
+			storage: &testIdempotencyStorage{existing: &entities.IdempotencyRecord{
+				Fingerprint: fingerprint, CreatedAt: time.Now().Add(-time.Second * 30),
+			}},
+			r:              newRequest("key", body),
+			statusWant:     http.StatusConflict,
+			wantRetryAfter: "30",
+		},
+		{
+			name:           "storage is busy",
+			storage:        &testIdempotencyStorage{reserveErr: errors.Join(gophermarterrors.MakeErrQueryTimeout(), errors.New("deadline exceeded"))},
+			r:              newRequest("key", body),
+			statusWant:     http.StatusServiceUnavailable,
+			wantRetryAfter: StorageBusyRetryAfter,
+		},
+		{
+			name:       "storage error",
+			storage:    &testIdempotencyStorage{reserveErr: errors.New("some test error")},
+			r:          newRequest("key", body),
+			statusWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := IdempotencyMW(*sugarLogger, tt.storage, settings)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(tt.handlerStatus)
+			}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.r)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.statusWant, res.StatusCode, "wrong status code")
+			assert.Equal(t, tt.wantCalled, called, "wrong handler call")
+			assert.Equal(t, tt.wantSaved, tt.storage.saved != nil, "wrong saved response")
+			assert.Equal(t, tt.wantDeleted, tt.storage.deleted, "wrong key release")
+			assert.Equal(t, tt.wantReplayed, res.Header.Get(IdempotentReplayedHeader) == "true", "wrong replay header")
+			if tt.wantRetryAfter != "" {
+				assert.Equal(t, tt.wantRetryAfter, res.Header.Get("Retry-After"), "wrong retry after")
+			}
+		})
+	}
+}
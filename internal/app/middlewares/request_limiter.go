@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"sync"
+	"time"
+)
+
+// requestLimiterSize is how many keys a RequestLimiter keeps. An evicted key starts its window over,
+// so a flood of new keys can`t use up memory.
+const requestLimiterSize = 100000
+
+// RequestLimiter allows Max requests per key (a login or an IP) in a fixed window. Counters are kept in memory,
+// so every instance of the service limits keys on its own.
+type RequestLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	counters *expirable.LRU[string, *requestWindow]
+	now      func() time.Time
+}
+
+type requestWindow struct {
+	started  time.Time
+	requests int
+}
+
+func NewRequestLimiter(max int, window time.Duration) *RequestLimiter {
+	return &RequestLimiter{
+		max:      max,
+		window:   window,
+		counters: expirable.NewLRU[string, *requestWindow](requestLimiterSize, nil, window),
+		now:      time.Now,
+	}
+}
+
+// Allow counts a request of a key. If a key used up its window, it returns false and how long to wait for the next one.
+func (l *RequestLimiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counter, ok := l.counters.Get(key)
+	if !ok || now.Sub(counter.started) >= l.window {
+		l.counters.Add(key, &requestWindow{started: now, requests: 1})
+		return true, 0
+	}
+	if counter.requests >= l.max {
+		return false, counter.started.Add(l.window).Sub(now)
+	}
+	counter.requests++
+	return true, 0
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter_Allow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewRequestLimiter(2, time.Hour)
+	limiter.now = clock.Now
+
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.Allow("login:alice")
+		assert.True(t, ok, "request %d of a window is limited", i)
+	}
+	ok, wait := limiter.Allow("login:alice")
+	assert.False(t, ok, "request over a limit isn`t limited")
+	assert.Equal(t, time.Hour, wait, "wrong wait for the next window")
+
+	//keys are counted separately
+	ok, _ = limiter.Allow("login:bob")
+	assert.True(t, ok, "other key is limited")
+
+	clock.now = clock.now.Add(time.Minute * 45)
+	ok, wait = limiter.Allow("login:alice")
+	assert.False(t, ok, "request in the same window isn`t limited")
+	assert.Equal(t, time.Minute*15, wait, "wrong wait for the rest of a window")
+
+	//a new window starts over
+	clock.now = clock.now.Add(time.Minute * 15)
+	ok, _ = limiter.Allow("login:alice")
+	assert.True(t, ok, "request of a new window is limited")
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"yandex_gophermart/pkg/security"
+)
+
+type RoleStorageInt interface {
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+}
+
+// RequireRole lets a request through only if a user has a role. It should be used after AuthMW,
+// which puts token claims in request.ctx. A token without a role is rejected at once, otherwise roles are
+// read from a storage, so a revoked role stops working before a token expires.
+func RequireRole(logger zap.SugaredLogger, roles RoleStorageInt, role string) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(TokenClaimsContextKey).(security.TokenClaims)
+			if !ok {
+				logger.Debugf("token claims weren`t found in ctx, path - %s", r.URL.Path)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasRole(role) {
+				logger.Warnf("user %d has no role `%s` in a token, path - %s", claims.UserID, role, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			//a role could be revoked after a token was issued
+			userRoles, err := roles.GetUserRoles(r.Context(), claims.UserID)
+			if WriteStorageUnavailable(logger, w, err) {
+				return
+			} else if err != nil {
+				logger.Errorf("cant get roles of user %d, err: %v", claims.UserID, err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !slices.Contains(userRoles, role) {
+				logger.Warnf("user %d has no role `%s` anymore, path - %s", claims.UserID, role, r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yandex_gophermart/pkg/entities"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// testRoles is a role storage for tests, it returns err if it is set.
+type testRoles struct {
+	byUserID map[int][]string
+	err      error
+}
+
+func (s testRoles) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.byUserID[userID], nil
+}
+
+func TestRequireRole(t *testing.T) {
+
+	//logger set
+	logger := zaptest.NewLogger(t)
+	sugarLogger := logger.Sugar()
+
+	withClaims := func(claims security.TokenClaims) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/admin/users/login", nil)
+		return r.WithContext(context.WithValue(r.Context(), TokenClaimsContextKey, claims))
+	}
+	admin := security.TokenClaims{UserID: 1, Roles: []string{entities.RoleAdmin}}
+	roles := testRoles{byUserID: map[int][]string{1: {entities.RoleAdmin}}}
+
+	tests := []struct {
+		name       string
+		roles      testRoles
+		r          *http.Request
+		statusWant int
+	}{
+		{
+			name:       "admin",
+			roles:      roles,
+			r:          withClaims(admin),
+			statusWant: http.StatusOK,
+		},
+		{
+			name:       "user without a role",
+			roles:      roles,
+			r:          withClaims(security.TokenClaims{UserID: 2}),
+			statusWant: http.StatusForbidden,
+		},
+		{
+			name:       "role revoked after a token was issued",
+			roles:      testRoles{byUserID: map[int][]string{}},
+			r:          withClaims(admin),
+			statusWant: http.StatusForbidden,
+		},
+		{
+			name:       "storage is busy",
+			roles:      testRoles{err: errors.Join(gophermarterrors.MakeErrQueryTimeout(), errors.New("deadline exceeded"))},
+			r:          withClaims(admin),
+			statusWant: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "storage error",
+			roles:      testRoles{err: errors.New("some test error")},
+			r:          withClaims(admin),
+			statusWant: http.StatusInternalServerError,
+		},
+		{
+			name:       "no token",
+			roles:      roles,
+			r:          httptest.NewRequest(http.MethodGet, "/api/admin/users/login", nil),
+			statusWant: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			RequireRole(*sugarLogger, tt.roles, entities.RoleAdmin)(next).ServeHTTP(w, tt.r)
+
+			assert.Equal(t, tt.statusWant, w.Code, "wrong status code")
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	gophermarterrors "yandex_gophermart/pkg/errors"
+)
+
+// StorageBusyRetryAfter is a delay (in seconds), after which a client may retry a request, failed because of a busy storage.
+const StorageBusyRetryAfter = "1"
+
+// WriteStorageUnavailable responds with 503 and "Retry-After" if a storage error is temporary: a storage call
+// timed out or a transaction couldn`t get through concurrent changes. Returns false for other errors.
+// It is used by handlers too, so every route answers a busy storage the same way.
+func WriteStorageUnavailable(logger zap.SugaredLogger, w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, gophermarterrors.MakeErrQueryTimeout()) && !errors.Is(err, gophermarterrors.MakeErrTxRetriesExhausted()) {
+		return false
+	}
+	logger.Warnf("storage is temporarily unavailable, err: %v", err)
+	w.Header().Set("Retry-After", StorageBusyRetryAfter)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	return true
+}
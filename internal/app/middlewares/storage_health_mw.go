@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// storageDownRetryAfter is a delay (in seconds), after which a client may retry a request, rejected because of a storage outage.
+const storageDownRetryAfter = "5"
+
+type HealthCheckerInt interface {
+	Healthy() bool
+}
+
+// StorageHealthMW rejects requests with 503 while a storage is unavailable. It is used for requests,
+// which change data, so they fail fast instead of waiting for a storage timeout.
+func StorageHealthMW(logger zap.SugaredLogger, health HealthCheckerInt) func(handler http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !health.Healthy() {
+				logger.Warnf("storage is unavailable, request is rejected: %s", r.URL.Path)
+				w.Header().Set("Retry-After", storageDownRetryAfter)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// asyncSendTimeout limits one delivery, so a stuck notifier doesn`t stop the queue.
+const asyncSendTimeout = time.Second * 10
+
+// AsyncNotifier queues notices and delivers them by another notifier in the background. A request doesn`t wait
+// for a delivery, so its time and status don`t show if a login exists. Delivery errors are only logged.
+type AsyncNotifier struct {
+	next   Notifier
+	logger *zap.SugaredLogger
+	queue  chan entities.PasswordResetNotice
+}
+
+func NewAsyncNotifier(next Notifier, logger *zap.SugaredLogger, queueSize int) *AsyncNotifier {
+	return &AsyncNotifier{
+		next:   next,
+		logger: logger,
+		queue:  make(chan entities.PasswordResetNotice, queueSize),
+	}
+}
+
+// NotifyPasswordReset queues a notice. It fails only if the queue is full.
+func (n *AsyncNotifier) NotifyPasswordReset(ctx context.Context, notice entities.PasswordResetNotice) error {
+	select {
+	case n.queue <- notice:
+		return nil
+	default:
+		return errors.New("notifications queue is full")
+	}
+}
+
+// Run delivers queued notices until ctx is cancelled.
+func (n *AsyncNotifier) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notice := <-n.queue:
+			sendCtx, cancel := context.WithTimeout(ctx, asyncSendTimeout)
+			err := n.next.NotifyPasswordReset(sendCtx, notice)
+			cancel()
+			if err != nil {
+				n.logger.Errorf("cant send a password reset notice to `%s`, err: %v", notice.Login, err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// Notifier delivers messages to users. Log and file notifiers are for local use and tests,
+// a real one (an email or a messenger) is plugged in the same way.
+type Notifier interface {
+	NotifyPasswordReset(ctx context.Context, notice entities.PasswordResetNotice) error
+}
+
+// LogNotifier writes notices to a log. A reset token is a secret, so it mustn`t be used where logs are shared.
+type LogNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+func NewLogNotifier(logger *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) NotifyPasswordReset(ctx context.Context, notice entities.PasswordResetNotice) error {
+	n.logger.Infof("password reset for `%s`: token %s, expires at %s", notice.Login, notice.Token, notice.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// FileNotifier appends notices to a file, one JSON object per line.
+type FileNotifier struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cant open a notifications file, err: %w", err)
+	}
+	return &FileNotifier{file: file}, nil
+}
+
+func (n *FileNotifier) NotifyPasswordReset(ctx context.Context, notice entities.PasswordResetNotice) error {
+	line, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("cant marshal a notice, err: %w", err)
+	}
+	line = append(line, '\n')
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err = n.file.Write(line); err != nil {
+		return fmt.Errorf("cant write a notice, err: %w", err)
+	}
+	return n.file.Sync()
+}
+
+func (n *FileNotifier) Close() error {
+	return n.file.Close()
+}
@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+type OutboxStorageInt interface {
+	GetUnpublishedEvents(ctx context.Context, limit int) ([]entities.OutboxEvent, error)
+	MarkEventsPublished(ctx context.Context, ids []int64) error
+}
+
+// Sink delivers events to other services. Publish can be called several times for the same event
+// (delivery is "at least once"), so receivers should deduplicate events by ID.
+type Sink interface {
+	Publish(ctx context.Context, event entities.OutboxEvent) error
+}
+
+// RelayDaemon publishes saved events through a sink. An event is marked as published only after it was
+// published successfully, failed events are retried on the next iteration.
+func RelayDaemon(ctx context.Context, logger *zap.SugaredLogger, storage OutboxStorageInt, sink Sink, pollInterval time.Duration, batchSize int, wg *sync.WaitGroup) {
+	defer wg.Done()
+	logger.Infof("Outbox relay started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			//publish until there is nothing to publish or an error occurred
+			for {
+				published, err := relayBatch(ctx, storage, sink, batchSize)
+				if err != nil {
+					logger.Errorf("outbox relay error: %v", err.Error())
+					break
+				}
+				if published < batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// relayBatch publishes one batch of events, returns an amount of published events.
+func relayBatch(ctx context.Context, storage OutboxStorageInt, sink Sink, batchSize int) (int, error) {
+	events, err := storage.GetUnpublishedEvents(ctx, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := make([]int64, 0, len(events))
+	var publishErr error
+	for _, event := range events {
+		publishErr = sink.Publish(ctx, event)
+		if publishErr != nil {
+			//keep an order of events, next ones will be published after this one
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		err = storage.MarkEventsPublished(ctx, published)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(published), publishErr
+}
@@ -0,0 +1,79 @@
+package storagemw
+
+import (
+	"context"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"sync"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// BalanceCache keeps recently read balances in memory. A balance is invalidated after every write,
+// which can change it, so all writes should go through the cache. Other instances of the service
+// don`t know about these writes, so they may return a stale balance until its TTL expires.
+type BalanceCache struct {
+	StorageInt
+	balances *expirable.LRU[int, entities.BalanceData]
+
+	mu sync.Mutex
+	//changed on every invalidation, so a balance read before a write isn`t cached after it
+	generation uint64
+}
+
+func NewBalanceCache(storage StorageInt, size int, ttl time.Duration) *BalanceCache {
+	return &BalanceCache{
+		StorageInt: storage,
+		balances:   expirable.NewLRU[int, entities.BalanceData](size, nil, ttl),
+	}
+}
+
+func (c *BalanceCache) GetBalance(ctx context.Context, userID int) (entities.BalanceData, error) {
+	if balance, ok := c.balances.Get(userID); ok {
+		return balance, nil
+	}
+
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	balance, err := c.StorageInt.GetBalance(ctx, userID)
+	if err != nil {
+		return balance, err
+	}
+
+	c.mu.Lock()
+	if generation == c.generation {
+		c.balances.Add(userID, balance)
+	}
+	c.mu.Unlock()
+	return balance, nil
+}
+
+// UpdateOrder invalidates a balance if an order becomes processed (points are accrued).
+func (c *BalanceCache) UpdateOrder(ctx context.Context, orderData entities.OrderData) error {
+	err := c.StorageInt.UpdateOrder(ctx, orderData)
+	if orderData.Status == entities.OrderStatusProcessed {
+		c.invalidate(orderData.UserID)
+	}
+	return err
+}
+
+func (c *BalanceCache) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) error {
+	err := c.StorageInt.WithdrawFromBalance(ctx, userID, orderNum, amount, merchantID)
+	c.invalidate(userID)
+	return err
+}
+
+func (c *BalanceCache) AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (entities.BalanceData, error) {
+	balance, err := c.StorageInt.AdjustBalance(ctx, adjustment)
+	c.invalidate(adjustment.UserID)
+	return balance, err
+}
+
+// invalidate is called even if a write failed, because it could be committed anyway (a timeout for example).
+func (c *BalanceCache) invalidate(userID int) {
+	c.mu.Lock()
+	c.generation++
+	c.balances.Remove(userID)
+	c.mu.Unlock()
+}
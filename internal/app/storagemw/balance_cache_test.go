@@ -0,0 +1,194 @@
+package storagemw
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// testBalanceStorage keeps one balance. If started is set, GetBalance reports it was called and waits for release,
+// so a write can happen while a balance is being read.
+type testBalanceStorage struct {
+	nilStorage
+	mu         sync.Mutex
+	balance    entities.BalanceData
+	balanceErr error
+	writeErr   error
+	reads      int
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *testBalanceStorage) GetBalance(ctx context.Context, userID int) (entities.BalanceData, error) {
+	s.mu.Lock()
+	s.reads++
+	balance, err := s.balance, s.balanceErr
+	started, release := s.started, s.release
+	s.started = nil
+	s.mu.Unlock()
+
+	if started != nil {
+		close(started)
+		<-release
+	}
+	return balance, err
+}
+
+func (s *testBalanceStorage) write(amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	s.balance.Current += amount
+	return nil
+}
+
+func (s *testBalanceStorage) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) error {
+	return s.write(-amount)
+}
+
+func (s *testBalanceStorage) UpdateOrder(ctx context.Context, orderData entities.OrderData) error {
+	return s.write(orderData.Accrual)
+}
+
+func (s *testBalanceStorage) AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (entities.BalanceData, error) {
+	err := s.write(adjustment.Amount)
+	return s.balance, err
+}
+
+func (s *testBalanceStorage) readsCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+var balanceWrites = []struct {
+	name  string
+	write func(ctx context.Context, cache *BalanceCache) error
+	want  float64
+}{
+	{
+		name: "withdrawal",
+		write: func(ctx context.Context, cache *BalanceCache) error {
+			return cache.WithdrawFromBalance(ctx, 1, "2377225624", 10, 0)
+		},
+		want: 90,
+	},
+	{
+		name: "processed order",
+		write: func(ctx context.Context, cache *BalanceCache) error {
+			return cache.UpdateOrder(ctx, entities.OrderData{UserID: 1, Number: "2377225624", Status: entities.OrderStatusProcessed, Accrual: 10})
+		},
+		want: 110,
+	},
+	{
+		name: "adjustment",
+		write: func(ctx context.Context, cache *BalanceCache) error {
+			_, err := cache.AdjustBalance(ctx, entities.BalanceAdjustment{UserID: 1, Amount: 5, Reason: "bonus"})
+			return err
+		},
+		want: 105,
+	},
+}
+
+func TestBalanceCache_Writes(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range balanceWrites {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testBalanceStorage{balance: entities.BalanceData{Current: 100}}
+			cache := NewBalanceCache(storage, 10, time.Hour)
+
+			balance, err := cache.GetBalance(ctx, 1)
+			require.NoError(t, err, "cant get a balance")
+			assert.Equal(t, 100.0, balance.Current, "wrong balance")
+			_, err = cache.GetBalance(ctx, 1)
+			require.NoError(t, err, "cant get a balance")
+			assert.Equal(t, 1, storage.readsCount(), "balance isn`t cached")
+
+			require.NoError(t, tt.write(ctx, cache), "cant write")
+			balance, err = cache.GetBalance(ctx, 1)
+			require.NoError(t, err, "cant get a balance")
+			assert.Equal(t, tt.want, balance.Current, "balance isn`t invalidated by a write")
+		})
+	}
+}
+
+// TestBalanceCache_StaleRead checks, that a balance read before a write isn`t cached after the write
+func TestBalanceCache_StaleRead(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range balanceWrites {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &testBalanceStorage{
+				balance: entities.BalanceData{Current: 100},
+				started: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			cache := NewBalanceCache(storage, 10, time.Hour)
+
+			started := storage.started
+			read := make(chan entities.BalanceData)
+			go func() {
+				balance, _ := cache.GetBalance(ctx, 1)
+				read <- balance
+			}()
+			<-started
+			require.NoError(t, tt.write(ctx, cache), "cant write")
+			close(storage.release)
+			assert.Equal(t, 100.0, (<-read).Current, "wrong balance of a read before a write")
+
+			balance, err := cache.GetBalance(ctx, 1)
+			require.NoError(t, err, "cant get a balance")
+			assert.Equal(t, tt.want, balance.Current, "stale balance is cached")
+			assert.Equal(t, 2, storage.readsCount(), "balance after a write isn`t read from a storage")
+		})
+	}
+}
+
+func TestBalanceCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	storage := &testBalanceStorage{balance: entities.BalanceData{Current: 100}}
+	cache := NewBalanceCache(storage, 10, time.Millisecond*20)
+
+	_, err := cache.GetBalance(ctx, 1)
+	require.NoError(t, err, "cant get a balance")
+	//another instance of the service changes a balance
+	storage.balance.Current = 50
+	balance, err := cache.GetBalance(ctx, 1)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 100.0, balance.Current, "balance isn`t cached")
+
+	time.Sleep(time.Millisecond * 50)
+	balance, err = cache.GetBalance(ctx, 1)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 50.0, balance.Current, "balance is cached longer than ttl")
+}
+
+func TestBalanceCache_Errors(t *testing.T) {
+	ctx := context.Background()
+	storage := &testBalanceStorage{balanceErr: errors.New("some test error")}
+	cache := NewBalanceCache(storage, 10, time.Hour)
+
+	_, err := cache.GetBalance(ctx, 1)
+	assert.Error(t, err, "error is lost")
+	storage.balanceErr = nil
+	storage.balance.Current = 100
+	balance, err := cache.GetBalance(ctx, 1)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 100.0, balance.Current, "failed read is cached")
+
+	//a failed write could be committed anyway, so it invalidates a balance too
+	storage.writeErr = errors.New("timeout")
+	storage.balance.Current = 90
+	err = cache.WithdrawFromBalance(ctx, 1, "2377225624", 10, 0)
+	assert.Error(t, err, "error is lost")
+	balance, err = cache.GetBalance(ctx, 1)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 90.0, balance.Current, "balance isn`t invalidated by a failed write")
+}
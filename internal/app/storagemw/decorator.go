@@ -0,0 +1,310 @@
+package storagemw
+
+import (
+	"context"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	"yandex_gophermart/pkg/security"
+)
+
+// Interceptor wraps every storage call. method is a name of a StorageInt method, call makes the call
+// (or passes it to the next interceptor) and may be called several times.
+type Interceptor func(ctx context.Context, method string, call func(ctx context.Context) error) error
+
+// Decorated is a storage, which passes all calls through interceptors. Every StorageInt method has to be wrapped here,
+// a promoted method of the embedded storage skips interceptors (TestDecorated_WrapsAllMethods checks it).
+type Decorated struct {
+	StorageInt
+	interceptors []Interceptor
+}
+
+// Decorate wraps a storage with interceptors. The first interceptor is the outermost one.
+func Decorate(storage StorageInt, interceptors ...Interceptor) *Decorated {
+	return &Decorated{
+		StorageInt:   storage,
+		interceptors: interceptors,
+	}
+}
+
+func (d *Decorated) intercept(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	next := call
+	for i := len(d.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := d.interceptors[i], next
+		next = func(ctx context.Context) error {
+			return interceptor(ctx, method, inner)
+		}
+	}
+	return next(ctx)
+}
+
+func (d *Decorated) SaveUser(ctx context.Context, login string, passwordHash string, passwordSalt string) (int, error) {
+	var userID int
+	err := d.intercept(ctx, "SaveUser", func(ctx context.Context) error {
+		var err error
+		userID, err = d.StorageInt.SaveUser(ctx, login, passwordHash, passwordSalt)
+		return err
+	})
+	return userID, err
+}
+
+func (d *Decorated) GetUserIDWithCheck(ctx context.Context, login string, password string) (int, error) {
+	var userID int
+	err := d.intercept(ctx, "GetUserIDWithCheck", func(ctx context.Context) error {
+		var err error
+		userID, err = d.StorageInt.GetUserIDWithCheck(ctx, login, password)
+		return err
+	})
+	return userID, err
+}
+
+func (d *Decorated) SaveNewOrder(ctx context.Context, orderData entities.OrderData) error {
+	return d.intercept(ctx, "SaveNewOrder", func(ctx context.Context) error {
+		return d.StorageInt.SaveNewOrder(ctx, orderData)
+	})
+}
+
+func (d *Decorated) UpdateOrder(ctx context.Context, orderData entities.OrderData) error {
+	return d.intercept(ctx, "UpdateOrder", func(ctx context.Context) error {
+		return d.StorageInt.UpdateOrder(ctx, orderData)
+	})
+}
+
+func (d *Decorated) GetOrdersList(ctx context.Context, userID int, filter entities.ListFilter) ([]entities.OrderData, error) {
+	var orders []entities.OrderData
+	err := d.intercept(ctx, "GetOrdersList", func(ctx context.Context) error {
+		var err error
+		orders, err = d.StorageInt.GetOrdersList(ctx, userID, filter)
+		return err
+	})
+	return orders, err
+}
+
+func (d *Decorated) GetUnfinishedOrdersList(ctx context.Context) ([]entities.OrderData, error) {
+	var orders []entities.OrderData
+	err := d.intercept(ctx, "GetUnfinishedOrdersList", func(ctx context.Context) error {
+		var err error
+		orders, err = d.StorageInt.GetUnfinishedOrdersList(ctx)
+		return err
+	})
+	return orders, err
+}
+
+func (d *Decorated) GetBalance(ctx context.Context, userID int) (entities.BalanceData, error) {
+	var balance entities.BalanceData
+	err := d.intercept(ctx, "GetBalance", func(ctx context.Context) error {
+		var err error
+		balance, err = d.StorageInt.GetBalance(ctx, userID)
+		return err
+	})
+	return balance, err
+}
+
+func (d *Decorated) GetBalanceAt(ctx context.Context, userID int, at time.Time) (entities.BalanceData, error) {
+	var balance entities.BalanceData
+	err := d.intercept(ctx, "GetBalanceAt", func(ctx context.Context) error {
+		var err error
+		balance, err = d.StorageInt.GetBalanceAt(ctx, userID, at)
+		return err
+	})
+	return balance, err
+}
+
+func (d *Decorated) GetBalanceEvents(ctx context.Context, userID int, from time.Time, to time.Time) ([]entities.BalanceEvent, error) {
+	var events []entities.BalanceEvent
+	err := d.intercept(ctx, "GetBalanceEvents", func(ctx context.Context) error {
+		var err error
+		events, err = d.StorageInt.GetBalanceEvents(ctx, userID, from, to)
+		return err
+	})
+	return events, err
+}
+
+func (d *Decorated) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) error {
+	return d.intercept(ctx, "WithdrawFromBalance", func(ctx context.Context) error {
+		return d.StorageInt.WithdrawFromBalance(ctx, userID, orderNum, amount, merchantID)
+	})
+}
+
+func (d *Decorated) GetWithdrawals(ctx context.Context, userID int, filter entities.ListFilter) ([]entities.WithdrawalData, error) {
+	var withdrawals []entities.WithdrawalData
+	err := d.intercept(ctx, "GetWithdrawals", func(ctx context.Context) error {
+		var err error
+		withdrawals, err = d.StorageInt.GetWithdrawals(ctx, userID, filter)
+		return err
+	})
+	return withdrawals, err
+}
+
+func (d *Decorated) SaveRefreshToken(ctx context.Context, token entities.RefreshToken) error {
+	return d.intercept(ctx, "SaveRefreshToken", func(ctx context.Context) error {
+		return d.StorageInt.SaveRefreshToken(ctx, token)
+	})
+}
+
+func (d *Decorated) RotateRefreshToken(ctx context.Context, oldHash string, newToken entities.RefreshToken) (int, error) {
+	var userID int
+	err := d.intercept(ctx, "RotateRefreshToken", func(ctx context.Context) error {
+		var err error
+		userID, err = d.StorageInt.RotateRefreshToken(ctx, oldHash, newToken)
+		return err
+	})
+	return userID, err
+}
+
+func (d *Decorated) RevokeRefreshTokenFamily(ctx context.Context, hash string) error {
+	return d.intercept(ctx, "RevokeRefreshTokenFamily", func(ctx context.Context) error {
+		return d.StorageInt.RevokeRefreshTokenFamily(ctx, hash)
+	})
+}
+
+func (d *Decorated) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return d.intercept(ctx, "RevokeAccessToken", func(ctx context.Context) error {
+		return d.StorageInt.RevokeAccessToken(ctx, tokenID, expiresAt)
+	})
+}
+
+func (d *Decorated) IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (bool, error) {
+	var revoked bool
+	err := d.intercept(ctx, "IsAccessTokenRevoked", func(ctx context.Context) error {
+		var err error
+		revoked, err = d.StorageInt.IsAccessTokenRevoked(ctx, claims)
+		return err
+	})
+	return revoked, err
+}
+
+func (d *Decorated) ChangePassword(ctx context.Context, userID int, currentPassword string, newPasswordHash string) error {
+	return d.intercept(ctx, "ChangePassword", func(ctx context.Context) error {
+		return d.StorageInt.ChangePassword(ctx, userID, currentPassword, newPasswordHash)
+	})
+}
+
+func (d *Decorated) CreatePasswordResetToken(ctx context.Context, login string, tokenHash string, expiresAt time.Time) error {
+	return d.intercept(ctx, "CreatePasswordResetToken", func(ctx context.Context) error {
+		return d.StorageInt.CreatePasswordResetToken(ctx, login, tokenHash, expiresAt)
+	})
+}
+
+func (d *Decorated) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string) (int, error) {
+	var userID int
+	err := d.intercept(ctx, "ResetPassword", func(ctx context.Context) error {
+		var err error
+		userID, err = d.StorageInt.ResetPassword(ctx, tokenHash, newPasswordHash)
+		return err
+	})
+	return userID, err
+}
+
+func (d *Decorated) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	var roles []string
+	err := d.intercept(ctx, "GetUserRoles", func(ctx context.Context) error {
+		var err error
+		roles, err = d.StorageInt.GetUserRoles(ctx, userID)
+		return err
+	})
+	return roles, err
+}
+
+func (d *Decorated) GetUserByLogin(ctx context.Context, login string) (entities.UserInfo, error) {
+	var user entities.UserInfo
+	err := d.intercept(ctx, "GetUserByLogin", func(ctx context.Context) error {
+		var err error
+		user, err = d.StorageInt.GetUserByLogin(ctx, login)
+		return err
+	})
+	return user, err
+}
+
+func (d *Decorated) AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (entities.BalanceData, error) {
+	var balance entities.BalanceData
+	err := d.intercept(ctx, "AdjustBalance", func(ctx context.Context) error {
+		var err error
+		balance, err = d.StorageInt.AdjustBalance(ctx, adjustment)
+		return err
+	})
+	return balance, err
+}
+
+func (d *Decorated) RequeueOrder(ctx context.Context, orderNumber string, adminID int) (entities.OrderData, error) {
+	var order entities.OrderData
+	err := d.intercept(ctx, "RequeueOrder", func(ctx context.Context) error {
+		var err error
+		order, err = d.StorageInt.RequeueOrder(ctx, orderNumber, adminID)
+		return err
+	})
+	return order, err
+}
+
+func (d *Decorated) SaveAdminAuditRecord(ctx context.Context, record entities.AdminAuditRecord) error {
+	return d.intercept(ctx, "SaveAdminAuditRecord", func(ctx context.Context) error {
+		return d.StorageInt.SaveAdminAuditRecord(ctx, record)
+	})
+}
+
+func (d *Decorated) CreateMerchant(ctx context.Context, name string, adminID int) (entities.Merchant, error) {
+	var merchant entities.Merchant
+	err := d.intercept(ctx, "CreateMerchant", func(ctx context.Context) error {
+		var err error
+		merchant, err = d.StorageInt.CreateMerchant(ctx, name, adminID)
+		return err
+	})
+	return merchant, err
+}
+
+func (d *Decorated) CreateAPIKey(ctx context.Context, key entities.APIKey, adminID int) (entities.APIKey, error) {
+	var saved entities.APIKey
+	err := d.intercept(ctx, "CreateAPIKey", func(ctx context.Context) error {
+		var err error
+		saved, err = d.StorageInt.CreateAPIKey(ctx, key, adminID)
+		return err
+	})
+	return saved, err
+}
+
+func (d *Decorated) RevokeAPIKey(ctx context.Context, merchantID int, keyID int, adminID int) error {
+	return d.intercept(ctx, "RevokeAPIKey", func(ctx context.Context) error {
+		return d.StorageInt.RevokeAPIKey(ctx, merchantID, keyID, adminID)
+	})
+}
+
+func (d *Decorated) GetAPIKey(ctx context.Context, hash string) (entities.APIKey, error) {
+	var key entities.APIKey
+	err := d.intercept(ctx, "GetAPIKey", func(ctx context.Context) error {
+		var err error
+		key, err = d.StorageInt.GetAPIKey(ctx, hash)
+		return err
+	})
+	return key, err
+}
+
+func (d *Decorated) LinkMerchant(ctx context.Context, userID int, merchantID int) error {
+	return d.intercept(ctx, "LinkMerchant", func(ctx context.Context) error {
+		return d.StorageInt.LinkMerchant(ctx, userID, merchantID)
+	})
+}
+
+func (d *Decorated) UnlinkMerchant(ctx context.Context, userID int, merchantID int) error {
+	return d.intercept(ctx, "UnlinkMerchant", func(ctx context.Context) error {
+		return d.StorageInt.UnlinkMerchant(ctx, userID, merchantID)
+	})
+}
+
+func (d *Decorated) GetLinkedMerchants(ctx context.Context, userID int) ([]entities.MerchantLink, error) {
+	var links []entities.MerchantLink
+	err := d.intercept(ctx, "GetLinkedMerchants", func(ctx context.Context) error {
+		var err error
+		links, err = d.StorageInt.GetLinkedMerchants(ctx, userID)
+		return err
+	})
+	return links, err
+}
+
+func (d *Decorated) IsMerchantLinked(ctx context.Context, merchantID int, userID int) (bool, error) {
+	var linked bool
+	err := d.intercept(ctx, "IsMerchantLinked", func(ctx context.Context) error {
+		var err error
+		linked, err = d.StorageInt.IsMerchantLinked(ctx, merchantID, userID)
+		return err
+	})
+	return linked, err
+}
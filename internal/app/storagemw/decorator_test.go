@@ -0,0 +1,157 @@
+package storagemw
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"reflect"
+	"testing"
+	"time"
+	"yandex_gophermart/pkg/databases"
+)
+
+// nilStorage panics on every call, a call of a decorated storage has to pass interceptors before it
+type nilStorage struct {
+	StorageInt
+}
+
+// TestDecorated_WrapsAllMethods fails if a StorageInt method is promoted from the embedded storage
+// instead of being wrapped, such a call would skip retries, metrics, slow log and tracing.
+func TestDecorated_WrapsAllMethods(t *testing.T) {
+	var intercepted string
+	decorated := reflect.ValueOf(Decorate(nilStorage{}, func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		intercepted = method
+		return nil
+	}))
+
+	storageType := reflect.TypeOf((*StorageInt)(nil)).Elem()
+	for i := 0; i < storageType.NumMethod(); i++ {
+		method := storageType.Method(i)
+		t.Run(method.Name, func(t *testing.T) {
+			intercepted = ""
+			args := make([]reflect.Value, method.Type.NumIn())
+			for j := range args {
+				args[j] = reflect.Zero(method.Type.In(j))
+			}
+			func() {
+				defer func() {
+					//an unwrapped method reaches nilStorage
+					_ = recover()
+				}()
+				decorated.MethodByName(method.Name).Call(args)
+			}()
+			assert.Equal(t, method.Name, intercepted, "method isn`t wrapped by interceptors")
+		})
+	}
+}
+
+func TestDecorated_InterceptorsOrder(t *testing.T) {
+	var calls []string
+	interceptor := func(name string) Interceptor {
+		return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+			calls = append(calls, name+" before "+method)
+			err := call(ctx)
+			calls = append(calls, name+" after "+method)
+			return err
+		}
+	}
+	storage := Decorate(nilStorage{}, interceptor("outer"), interceptor("inner"))
+
+	err := storage.intercept(context.Background(), "GetBalance", func(ctx context.Context) error {
+		calls = append(calls, "call")
+		return nil
+	})
+	require.NoError(t, err, "unexpected error")
+	assert.Equal(t, []string{
+		"outer before GetBalance",
+		"inner before GetBalance",
+		"call",
+		"inner after GetBalance",
+		"outer after GetBalance",
+	}, calls, "wrong order of interceptors")
+}
+
+func TestRetry(t *testing.T) {
+	transientErr := errors.New("connection reset")
+	isTransient := func(err error) bool {
+		return errors.Is(err, transientErr)
+	}
+
+	tests := []struct {
+		name         string
+		errs         []error //errors of attempts, the last one repeats
+		isTransient  func(err error) bool
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "success", errs: []error{nil}, isTransient: isTransient, wantAttempts: 1},
+		{name: "transient error once", errs: []error{transientErr, nil}, isTransient: isTransient, wantAttempts: 2},
+		{name: "transient error every time", errs: []error{transientErr}, isTransient: isTransient, wantAttempts: 4, wantErr: transientErr},
+		{name: "other error", errs: []error{errors.New("unique violation")}, isTransient: isTransient, wantAttempts: 1},
+		{name: "deadline exceeded", errs: []error{context.DeadlineExceeded}, isTransient: databases.IsTransientError, wantAttempts: 1, wantErr: context.DeadlineExceeded},
+		{name: "canceled", errs: []error{context.Canceled}, isTransient: databases.IsTransientError, wantAttempts: 1, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := Retry(3, time.Millisecond, tt.isTransient)(context.Background(), "GetBalance", func(ctx context.Context) error {
+				err := tt.errs[min(attempts, len(tt.errs)-1)]
+				attempts++
+				return err
+			})
+			assert.Equal(t, tt.wantAttempts, attempts, "wrong amount of attempts")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "wrong error")
+			} else if tt.errs[len(tt.errs)-1] == nil {
+				assert.NoError(t, err, "unexpected error")
+			} else {
+				assert.Error(t, err, "error is lost")
+			}
+		})
+	}
+}
+
+func TestRetry_StopsOnDoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	start := time.Now()
+	err := Retry(3, time.Hour, func(err error) bool { return true })(ctx, "GetBalance", func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return errors.New("connection reset")
+	})
+	assert.Error(t, err, "error is lost")
+	assert.Equal(t, 1, attempts, "call is retried after a context is done")
+	assert.Less(t, time.Since(start), time.Minute, "retry waits after a context is done")
+}
+
+func TestSlowLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		took      time.Duration
+		wantLogs  int
+	}{
+		{name: "fast call", threshold: time.Second, wantLogs: 0},
+		{name: "slow call", threshold: time.Millisecond, took: time.Millisecond * 20, wantLogs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			interceptor := SlowLog(zap.New(core).Sugar(), tt.threshold)
+			err := interceptor(context.Background(), "GetBalance", func(ctx context.Context) error {
+				time.Sleep(tt.took)
+				return nil
+			})
+			require.NoError(t, err, "unexpected error")
+			require.Equal(t, tt.wantLogs, logs.Len(), "wrong amount of slow call logs")
+			if tt.wantLogs > 0 {
+				assert.Contains(t, logs.All()[0].Message, "GetBalance", "slow call log has no method")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package storagemw
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type PingerInt interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthMonitor pings a storage and remembers if it is reachable. A storage is treated as healthy until
+// the first failed ping. While a storage is down, pings are repeated with an exponential backoff.
+type HealthMonitor struct {
+	pinger  PingerInt
+	logger  *zap.SugaredLogger
+	healthy atomic.Bool
+}
+
+func NewHealthMonitor(pinger PingerInt, logger *zap.SugaredLogger) *HealthMonitor {
+	m := &HealthMonitor{
+		pinger: pinger,
+		logger: logger,
+	}
+	m.healthy.Store(true)
+	return m
+}
+
+// Healthy tells if the last ping succeeded.
+func (m *HealthMonitor) Healthy() bool {
+	return m.healthy.Load()
+}
+
+// Run pings a storage every interval while it is healthy. After a failure it waits interval, 2*interval and so on,
+// but not longer than maxBackoff, until a storage responds again.
+func (m *HealthMonitor) Run(ctx context.Context, interval time.Duration, maxBackoff time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	wait := interval
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := m.pinger.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			if !m.healthy.Swap(true) {
+				m.logger.Infof("storage is available again")
+			}
+			wait = interval
+		} else {
+			if m.healthy.Swap(false) {
+				m.logger.Errorf("storage is unavailable, err: %v", err.Error())
+			} else {
+				wait = min(wait*2, maxBackoff)
+				m.logger.Warnf("storage is still unavailable, next ping in %v, err: %v", wait, err.Error())
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package storagemw
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPinger answers pings with errs one by one, it stops a monitor after the last answer
+type testPinger struct {
+	errs    []error
+	monitor *HealthMonitor
+	cancel  context.CancelFunc
+	//Healthy() at every ping, it is the result of the previous one
+	healthy []bool
+}
+
+func (p *testPinger) Ping(ctx context.Context) error {
+	p.healthy = append(p.healthy, p.monitor.Healthy())
+	if len(p.healthy) >= len(p.errs) {
+		p.cancel()
+	}
+	return p.errs[min(len(p.healthy), len(p.errs))-1]
+}
+
+func TestHealthMonitor_Run(t *testing.T) {
+	pingErr := errors.New("connection refused")
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pinger := &testPinger{errs: []error{nil, pingErr, pingErr, pingErr, pingErr, nil, nil}, cancel: cancel}
+	monitor := NewHealthMonitor(pinger, zap.New(core).Sugar())
+	pinger.monitor = monitor
+	assert.True(t, monitor.Healthy(), "storage isn`t healthy before the first ping")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go monitor.Run(ctx, time.Millisecond*10, time.Millisecond*40, &wg)
+	wg.Wait()
+
+	assert.Equal(t, []bool{true, true, false, false, false, false, true}, pinger.healthy, "wrong healthy/unhealthy transitions")
+
+	var messages []string
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	//the first failure is retried after an interval, then the wait is doubled up to maxBackoff
+	assert.Equal(t, []string{
+		"storage is unavailable, err: connection refused",
+		"storage is still unavailable, next ping in 20ms, err: connection refused",
+		"storage is still unavailable, next ping in 40ms, err: connection refused",
+		"storage is still unavailable, next ping in 40ms, err: connection refused",
+		"storage is available again",
+	}, messages, "wrong backoff")
+}
@@ -0,0 +1,86 @@
+package storagemw
+
+import (
+	"context"
+	"expvar"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Retry repeats a call up to maxRetries times if it failed with a transient error (see isTransient).
+// The delay between attempts is doubled after every attempt.
+func Retry(maxRetries int, delay time.Duration, isTransient func(err error) bool) Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		wait := delay
+		for attempt := 0; ; attempt++ {
+			err := call(ctx)
+			if err == nil || attempt >= maxRetries || !isTransient(err) {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+	}
+}
+
+// Metrics counts calls and errors and sums latencies of every method in an expvar map
+// ("<name>": {"<method>": {"calls": ..., "errors": ..., "latency_ns": ...}}). A name can be used only once.
+func Metrics(name string) Interceptor {
+	methods := expvar.NewMap(name)
+	var mu sync.Mutex
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		latency := time.Since(start)
+
+		mu.Lock()
+		stats, ok := methods.Get(method).(*expvar.Map)
+		if !ok {
+			stats = new(expvar.Map).Init()
+			methods.Set(method, stats)
+		}
+		mu.Unlock()
+		stats.Add("calls", 1)
+		stats.Add("latency_ns", latency.Nanoseconds())
+		if err != nil {
+			stats.Add("errors", 1)
+		}
+		return err
+	}
+}
+
+// Tracing makes a span for every call.
+func Tracing(tracer trace.Tracer) Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		ctx, span := tracer.Start(ctx, "storage."+method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("storage.method", method)))
+		defer span.End()
+
+		err := call(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// SlowLog logs calls, which took longer than threshold.
+func SlowLog(logger *zap.SugaredLogger, threshold time.Duration) Interceptor {
+	return func(ctx context.Context, method string, call func(ctx context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		if took := time.Since(start); took > threshold {
+			logger.Warnf("slow storage call %s took %v (threshold %v), err: %v", method, took, threshold, err)
+		}
+		return err
+	}
+}
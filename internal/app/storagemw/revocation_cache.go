@@ -0,0 +1,86 @@
+package storagemw
+
+import (
+	"context"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"time"
+	"yandex_gophermart/pkg/security"
+)
+
+// RevocationCache keeps recent answers of the access tokens denylist in memory, so AuthMW doesn`t query
+// a storage on every request. A token revoked here is denied at once, a token revoked by another
+// instance of the service may be accepted until its cached answer expires. The same goes for
+// tokens of a user, who changed a password.
+type RevocationCache struct {
+	StorageInt
+	revoked *expirable.LRU[string, bool]
+	//a time, before which tokens of a user are revoked, it is kept as long as token answers are
+	validAfter *expirable.LRU[int, time.Time]
+}
+
+func NewRevocationCache(storage StorageInt, size int, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		StorageInt: storage,
+		revoked:    expirable.NewLRU[string, bool](size, nil, ttl),
+		validAfter: expirable.NewLRU[int, time.Time](size, nil, ttl),
+	}
+}
+
+func (c *RevocationCache) IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (bool, error) {
+	if c.isRevokedForUser(claims) {
+		return true, nil
+	}
+	if revoked, ok := c.revoked.Get(claims.ID); ok {
+		return revoked, nil
+	}
+
+	revoked, err := c.StorageInt.IsAccessTokenRevoked(ctx, claims)
+	if err != nil {
+		return false, err
+	}
+	//a token could be revoked here during the storage call, then its answer is already cached
+	if cached, ok := c.revoked.Get(claims.ID); ok && cached {
+		return true, nil
+	}
+	if c.isRevokedForUser(claims) {
+		return true, nil
+	}
+	c.revoked.Add(claims.ID, revoked)
+	return revoked, nil
+}
+
+func (c *RevocationCache) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	err := c.StorageInt.RevokeAccessToken(ctx, tokenID, expiresAt)
+	if err != nil {
+		return err
+	}
+	c.revoked.Add(tokenID, true)
+	return nil
+}
+
+func (c *RevocationCache) ChangePassword(ctx context.Context, userID int, currentPassword string, newPasswordHash string) error {
+	changedAt := time.Now().Truncate(time.Second)
+	err := c.StorageInt.ChangePassword(ctx, userID, currentPassword, newPasswordHash)
+	if err != nil {
+		return err
+	}
+	c.validAfter.Add(userID, changedAt)
+	return nil
+}
+
+func (c *RevocationCache) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string) (int, error) {
+	changedAt := time.Now().Truncate(time.Second)
+	userID, err := c.StorageInt.ResetPassword(ctx, tokenHash, newPasswordHash)
+	if err != nil {
+		return 0, err
+	}
+	c.validAfter.Add(userID, changedAt)
+	return userID, nil
+}
+
+// isRevokedForUser is true for a token issued before a password change made through this cache.
+// "iat" has seconds only, so it is compared with a change time truncated to seconds, as storages do.
+func (c *RevocationCache) isRevokedForUser(claims security.TokenClaims) bool {
+	validAfter, ok := c.validAfter.Get(claims.UserID)
+	return ok && validAfter.After(claims.IssuedAt)
+}
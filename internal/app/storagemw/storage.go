@@ -0,0 +1,15 @@
+package storagemw
+
+import (
+	"yandex_gophermart/internal/app/accrualdaemon"
+	"yandex_gophermart/internal/app/handlers"
+	"yandex_gophermart/internal/app/middlewares"
+)
+
+// StorageInt is a storage, wrapped by decorators of this package.
+type StorageInt interface {
+	handlers.StorageInt
+	accrualdaemon.UnfinishedOrdersStorageInt
+	middlewares.RevokedTokensStorageInt
+	middlewares.APIKeyStorageInt
+}
@@ -0,0 +1,83 @@
+package databases
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// sqlDialect hides differences of storages in list queries.
+type sqlDialect struct {
+	//placeholder returns a query placeholder for an n-th arg (from 1)
+	placeholder func(n int) string
+	//timeBound converts a user`s time to a form, used for time columns
+	timeBound func(t time.Time) time.Time
+}
+
+// postgresqlDialect: timestamps are stored without time zone in server`s local time
+var postgresqlDialect = sqlDialect{
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	timeBound:   func(t time.Time) time.Time { return t.Local() },
+}
+
+// sqliteDialect: timestamps are stored as UTC strings
+var sqliteDialect = sqlDialect{
+	placeholder: func(n int) string { return "?" + strconv.Itoa(n) },
+	timeBound:   func(t time.Time) time.Time { return t.UTC() },
+}
+
+// buildListConditions builds a WHERE clause (without "WHERE") and its args for a user`s list query.
+// Rows are expected to be ordered by (timeColumn, id) descending. Empty statusColumn disables status filtering.
+func buildListConditions(dialect sqlDialect, filter entities.ListFilter, timeColumn string, statusColumn string, userID int) (string, []any) {
+	args := []any{}
+	nextArg := func(val any) string {
+		args = append(args, val)
+		return dialect.placeholder(len(args))
+	}
+	conditions := []string{"user_id = " + nextArg(userID)}
+
+	if statusColumn != "" && len(filter.Statuses) > 0 {
+		placeholders := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			placeholders = append(placeholders, nextArg(status))
+		}
+		conditions = append(conditions, statusColumn+" IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, timeColumn+" >= "+nextArg(dialect.timeBound(filter.From)))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, timeColumn+" < "+nextArg(dialect.timeBound(filter.To)))
+	}
+	if filter.Cursor != nil {
+		//cursor time was read from a storage, so it is passed as is
+		conditions = append(conditions, "("+timeColumn+", id) < ("+nextArg(filter.Cursor.Time)+", "+nextArg(filter.Cursor.ID)+")")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Balance totals and history are computed from both current and archived rows.
+const (
+	balanceOrdersSource = `(SELECT user_id, status, accural, processed_at FROM orders
+			UNION ALL SELECT user_id, status, accural, processed_at FROM orders_archive) AS orders`
+	balanceWithdrawalsSource = `(SELECT user_id, amount, processed_at FROM withdrawals
+			UNION ALL SELECT user_id, amount, processed_at FROM withdrawals_archive) AS withdrawals`
+)
+
+// buildListSource returns a table to select a list from. If archived rows are included, it is a union
+// of the table and its archive ("<table>_archive") with the same name.
+func buildListSource(table string, columns string, filter entities.ListFilter) string {
+	if !filter.IncludeArchived {
+		return table
+	}
+	return "(SELECT " + columns + " FROM " + table + " UNION ALL SELECT " + columns + " FROM " + table + "_archive) AS " + table
+}
+
+func buildLimit(filter entities.ListFilter) string {
+	if filter.Limit <= 0 {
+		return ""
+	}
+	return "\n\t\tLIMIT " + strconv.Itoa(filter.Limit)
+}
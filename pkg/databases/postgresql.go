@@ -2,11 +2,12 @@ package databases
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
 	time2 "time"
 	"yandex_gophermart/pkg/entities"
 	gophermart_errors "yandex_gophermart/pkg/errors"
@@ -14,120 +15,270 @@ import (
 )
 
 type Postgresql struct {
-	store *sql.DB
+	store    *pgxpool.Pool
+	replica  *replica //nil if reads go to the primary only
+	tx       postgresqlTx
+	timeouts QueryTimeouts
+	hasher   *security.PasswordHasher
+	logger   *zap.SugaredLogger
 }
 
-func NewPostgresql(connStr string) (*Postgresql, error) {
-	db, err := sql.Open("pgx", connStr)
+// PoolSettings are optional pgxpool settings. Zero values mean "pgxpool default".
+type PoolSettings struct {
+	MaxConns           int32
+	MinConns           int32
+	MaxConnLifetime    time2.Duration
+	HealthCheckPeriod  time2.Duration
+	StatementCacheMode string
+}
+
+// PoolStats is a snapshot of a connection pool state, used for metrics.
+type PoolStats struct {
+	AcquireCount            int64          `json:"acquire_count"`
+	AcquireDuration         time2.Duration `json:"acquire_duration"`
+	AcquiredConns           int32          `json:"acquired_conns"`
+	CanceledAcquireCount    int64          `json:"canceled_acquire_count"`
+	ConstructingConns       int32          `json:"constructing_conns"`
+	EmptyAcquireCount       int64          `json:"empty_acquire_count"`
+	IdleConns               int32          `json:"idle_conns"`
+	MaxConns                int32          `json:"max_conns"`
+	TotalConns              int32          `json:"total_conns"`
+	NewConnsCount           int64          `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64          `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64          `json:"max_idle_destroy_count"`
+}
+
+func NewPostgresql(ctx context.Context, connStr string, settings PoolSettings) (*Postgresql, error) {
+	poolConfig, err := makePoolConfig(connStr, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, errors.Join(errors.New("cant create a new postgresql storage"), err)
 	}
+	tx, err := makePostgresqlTx(defaultTxSettings)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := security.NewPasswordHasher(security.DefaultPasswordHashSettings)
+	if err != nil {
+		return nil, err
+	}
 	return &Postgresql{
-		store: db,
+		store:  pool,
+		tx:     tx,
+		hasher: hasher,
+		logger: zap.NewNop().Sugar(),
 	}, nil
 }
 
-func (p *Postgresql) Ping() error {
-	return p.store.Ping()
+func makePoolConfig(connStr string, settings PoolSettings) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, errors.Join(errors.New("cant parse postgresql conn str"), err)
+	}
+
+	if settings.MaxConns > 0 {
+		poolConfig.MaxConns = settings.MaxConns
+	}
+	if settings.MinConns > 0 {
+		poolConfig.MinConns = settings.MinConns
+	}
+	if settings.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = settings.MaxConnLifetime
+	}
+	if settings.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = settings.HealthCheckPeriod
+	}
+	if settings.StatementCacheMode != "" {
+		mode, err := parseQueryExecMode(settings.StatementCacheMode)
+		if err != nil {
+			return nil, err
+		}
+		poolConfig.ConnConfig.DefaultQueryExecMode = mode
+	}
+	return poolConfig, nil
 }
 
-func (p *Postgresql) SetTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			login VARCHAR(255) UNIQUE,
-			password_hash VARCHAR(255),
-			password_salt VARCHAR(255)
-		);`,
-		`CREATE TABLE IF NOT EXISTS orders (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER,
-			order_number VARCHAR(255) UNIQUE,
-			status VARCHAR(255),
-			accural FLOAT,
-			uploaded_at TIMESTAMP
-		);`,
-		`CREATE TABLE IF NOT EXISTS balances (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER UNIQUE,
-			points FLOAT
-		);`,
-		`CREATE TABLE IF NOT EXISTS withdrawals (
-			id SERIAL PRIMARY KEY,
-			order_num VARCHAR(255),
-			user_id INTEGER,
-			amount FLOAT,
-			processed_at TIMESTAMP
-		);`,
+func parseQueryExecMode(mode string) (pgx.QueryExecMode, error) {
+	switch mode {
+	case "cache_statement":
+		return pgx.QueryExecModeCacheStatement, nil
+	case "cache_describe":
+		return pgx.QueryExecModeCacheDescribe, nil
+	case "describe_exec":
+		return pgx.QueryExecModeDescribeExec, nil
+	case "exec":
+		return pgx.QueryExecModeExec, nil
+	case "simple_protocol":
+		return pgx.QueryExecModeSimpleProtocol, nil
+	default:
+		return 0, fmt.Errorf("unknown statement cache mode `%s`", mode)
 	}
+}
 
-	for _, query := range queries {
-		if _, err := p.store.Exec(query); err != nil {
-			return errors.Join(errors.New("error while setting tables in postgres db"), err)
-		}
+func (p *Postgresql) Ping(ctx context.Context) error {
+	return p.store.Ping(ctx)
+}
+
+func (p *Postgresql) Close() {
+	p.store.Close()
+	if p.replica != nil {
+		p.replica.pool.Close()
 	}
+}
 
-	return nil
+func (p *Postgresql) Stats() PoolStats {
+	stat := p.store.Stat()
+	return PoolStats{
+		AcquireCount:            stat.AcquireCount(),
+		AcquireDuration:         stat.AcquireDuration(),
+		AcquiredConns:           stat.AcquiredConns(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		ConstructingConns:       stat.ConstructingConns(),
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		IdleConns:               stat.IdleConns(),
+		MaxConns:                stat.MaxConns(),
+		TotalConns:              stat.TotalConns(),
+		NewConnsCount:           stat.NewConnsCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+	}
 }
 
-func (p *Postgresql) SaveUser(ctx context.Context, login string, passwordHash string, passwordSalt string) (int, error) {
+func (p *Postgresql) SaveUser(ctx context.Context, login string, passwordHash string, passwordSalt string) (_ int, err error) {
+	ctx, done := p.withDeadline(ctx, "SaveUser")
+	defer done(&err)
+
 	var userID int
 
-	err := p.store.QueryRowContext(ctx, `
+	err = p.store.QueryRow(ctx, `
 		INSERT INTO users (login, password_hash, password_salt)
 		VALUES ($1, $2, $3)
-		ON CONFLICT (login) DO NOTHING
+		ON CONFLICT DO NOTHING
 		RETURNING id;`,
 		login, passwordHash, passwordSalt).Scan(&userID)
 
-	if errors.Is(err, sql.ErrNoRows) {
+	if errors.Is(err, pgx.ErrNoRows) {
 		// "save user err: %v"
 		return 0, gophermart_errors.MakeErrUserAlreadyExists()
 	} else if err != nil {
-		return 0, err
+		return 0, mapConstraintError(err)
 	}
 
 	return userID, nil
 }
 
-// CheckUser finds an id, password and password_salt by login, then checks password (using "security" package).
-// Returns an ID if password is correct, "0" + "error" if not
-func (p *Postgresql) GetUserIDWithCheck(ctx context.Context, login string, password string) (int, error) {
+// SetPasswordHasher changes a hasher, which checks passwords and rehashes outdated hashes.
+func (p *Postgresql) SetPasswordHasher(hasher *security.PasswordHasher) {
+	p.hasher = hasher
+}
+
+// SetLogger sets a logger for errors, which don`t fail a call (a failed password rehash for example).
+func (p *Postgresql) SetLogger(logger *zap.SugaredLogger) {
+	p.logger = logger
+}
+
+// GetUserIDWithCheck finds a user by login (case-insensitive) and checks a password against its hash.
+// Returns an ID if a password is correct, "0" + "error" if not. Legacy or outdated hashes are replaced with new ones.
+func (p *Postgresql) GetUserIDWithCheck(ctx context.Context, login string, password string) (_ int, err error) {
+	ctx, done := p.withDeadline(ctx, "GetUserIDWithCheck")
+	defer done(&err)
+
 	var userID int
 	var passwordHash, passwordSalt string
 
-	err := p.store.QueryRowContext(ctx, `
+	err = p.store.QueryRow(ctx, `
 		SELECT id, password_hash, password_salt 
 		FROM users 
-		WHERE login = $1`, login).Scan(&userID, &passwordHash, &passwordSalt)
-	if errors.Is(err, sql.ErrNoRows) {
+		WHERE lower(login) = lower($1)`, login).Scan(&userID, &passwordHash, &passwordSalt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		//a password is checked anyway, so an unknown login isn`t answered faster than a known one
+		p.hasher.VerifyDummy(password)
 		return 0, gophermart_errors.MakeErrWrongLoginOrPassword()
 	} else if err != nil {
 		return 0, err
 	}
 
-	if !security.CheckPassword(password, passwordHash, passwordSalt) {
+	ok, needsRehash, err := p.hasher.Verify(password, passwordHash, passwordSalt)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
 		return 0, gophermart_errors.MakeErrWrongLoginOrPassword()
 	}
 
+	if needsRehash {
+		//a user is checked anyway, so a failed rehash doesn`t fail a login. A password may be too long
+		//for a new algorithm (bcrypt takes 72 bytes), then an old hash is kept
+		newHash, err := p.hasher.Hash(password)
+		if err == nil {
+			_, err = p.store.Exec(ctx, `
+			UPDATE users SET password_hash = $1, password_salt = ''
+			WHERE id = $2 AND password_hash = $3`,
+				newHash, userID, passwordHash)
+			if err != nil {
+				p.logger.Warnf("cant rehash a password of user %d, an old hash is kept, err: %v", userID, err)
+			}
+		}
+	}
+
 	return userID, nil
 }
 
-func (p *Postgresql) SaveNewOrder(ctx context.Context, orderData entities.OrderData) error {
+// SaveNewOrder saves an order and an "order.uploaded" event.
+func (p *Postgresql) SaveNewOrder(ctx context.Context, orderData entities.OrderData) (err error) {
+	ctx, done := p.withDeadline(ctx, "SaveNewOrder")
+	defer done(&err)
+
 	var userID int
 	time := orderData.UploadedAt.Time
 
-	err := p.store.QueryRowContext(ctx, `
-		INSERT INTO orders (user_id, order_number, status, accural, uploaded_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING user_id`,
-		orderData.UserID, orderData.Number, orderData.Status, orderData.Accrual, time).Scan(&userID)
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		//order numbers are unique with archived ones too
+		var archivedUserID int
+		err := tx.QueryRow(ctx, `
+		SELECT user_id FROM orders_archive WHERE order_number = $1`,
+			orderData.Number).Scan(&archivedUserID)
+		if err == nil {
+			if archivedUserID == orderData.UserID {
+				return gophermart_errors.MakeErrUserHasAlreadyUploadedThisOrder()
+			}
+			return gophermart_errors.MakeErrThisOrderWasUploadedByDifferentUser()
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, `
+		INSERT INTO orders (user_id, order_number, status, accural, uploaded_at, merchant_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))
+		RETURNING id`,
+			orderData.UserID, orderData.Number, orderData.Status, orderData.Accrual, time, orderData.MerchantID).Scan(&orderData.ID)
+		if err != nil {
+			return err
+		}
+
+		return insertOutboxEvent(ctx, tx, entities.EventOrderUploaded, &entities.OrderEventPayload{
+			UserID:     orderData.UserID,
+			Number:     orderData.Number,
+			Status:     orderData.Status,
+			Accrual:    orderData.Accrual,
+			UploadedAt: orderData.UploadedAt,
+			MerchantID: orderData.MerchantID,
+		})
+	})
 
 	//check who uploaded this order first (conflict)
 	if err != nil {
-		if pqErr, ok := err.(*pgconn.PgError); ok && pqErr.Code == "23505" {
-			err = p.store.QueryRowContext(ctx, `
-				SELECT user_id FROM orders WHERE order_number = $1`,
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			err = p.store.QueryRow(ctx, `
+				SELECT user_id FROM orders WHERE order_number = $1
+				UNION ALL
+				SELECT user_id FROM orders_archive WHERE order_number = $1
+				LIMIT 1`,
 				orderData.Number).Scan(&userID)
 			if err != nil {
 				return err
@@ -138,74 +289,123 @@ func (p *Postgresql) SaveNewOrder(ctx context.Context, orderData entities.OrderD
 				return gophermart_errors.MakeErrThisOrderWasUploadedByDifferentUser()
 			}
 		}
-		return err
+		return mapConstraintError(err)
 	}
 
+	p.markWrite(orderData.UserID)
 	return nil
 }
 
-// UpdateOrder updates an order and increases users`s balance if order status is "PROCESSED"
-func (p *Postgresql) UpdateOrder(ctx context.Context, orderData entities.OrderData) error {
-	tx, err := p.store.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("cant begin a transaction, err: %w", err)
-	}
+// UpdateOrder updates an order and increases users`s balance if order status becomes "PROCESSED".
+// An event is saved if order status was changed.
+func (p *Postgresql) UpdateOrder(ctx context.Context, orderData entities.OrderData) (err error) {
+	ctx, done := p.withDeadline(ctx, "UpdateOrder")
+	defer done(&err)
 
-	_, err = tx.ExecContext(ctx, `
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		var oldStatus string
+		err := tx.QueryRow(ctx, `
+		SELECT status 
+		FROM orders 
+		WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+			orderData.ID, orderData.UserID).Scan(&oldStatus)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrOrderNotFound()
+		} else if err != nil {
+			return fmt.Errorf("cant get an order to update, err: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
 		UPDATE orders 
 		SET status = $1, accural = $2, uploaded_at = $3
 		WHERE id = $4 AND user_id = $5`,
-		orderData.Status, orderData.Accrual, orderData.UploadedAt.Time, orderData.ID, orderData.UserID)
-
-	if err != nil {
-		return fmt.Errorf("error while updating an order: %w", err)
-	}
+			orderData.Status, orderData.Accrual, orderData.UploadedAt.Time, orderData.ID, orderData.UserID)
+		if err != nil {
+			return fmt.Errorf("error while updating an order: %w", mapConstraintError(err))
+		}
 
-	if orderData.Status == entities.OrderStatusProcessed {
-		_, err = tx.ExecContext(ctx, `
+		if orderData.Status == entities.OrderStatusProcessed && oldStatus != entities.OrderStatusProcessed {
+			_, err = tx.Exec(ctx, `
 		INSERT INTO balances (user_id, points) 
 		VALUES ($1, $2) 
 		ON CONFLICT (user_id) 
 		DO UPDATE SET points = balances.points + $2`,
-			orderData.UserID, orderData.Accrual)
-		if err != nil {
-			return fmt.Errorf("cant increase users balance, err: %w", err)
+				orderData.UserID, orderData.Accrual)
+			if err != nil {
+				return fmt.Errorf("cant increase users balance, err: %w", mapConstraintError(err))
+			}
+
+			_, err = tx.Exec(ctx, `
+		UPDATE orders 
+		SET processed_at = $2
+		WHERE id = $1`, orderData.ID, time2.Now().Local())
+			if err != nil {
+				return fmt.Errorf("cant set order processing time, err: %w", err)
+			}
 		}
-	}
 
-	err = tx.Commit()
+		if eventType := entities.OrderStatusEvent(orderData.Status); eventType != "" && orderData.Status != oldStatus {
+			return insertOutboxEvent(ctx, tx, eventType, &entities.OrderEventPayload{
+				UserID:     orderData.UserID,
+				Number:     orderData.Number,
+				Status:     orderData.Status,
+				Accrual:    orderData.Accrual,
+				UploadedAt: orderData.UploadedAt,
+			})
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error while committing transaction, %w", err)
+		return err
 	}
 
+	p.markWrite(orderData.UserID)
 	return nil
 }
 
-func (p *Postgresql) GetOrdersList(ctx context.Context, userID int) ([]entities.OrderData, error) {
-	rows, err := p.store.QueryContext(ctx, `
+// GetOrdersList returns user`s orders, newest first, restricted by a filter.
+func (p *Postgresql) GetOrdersList(ctx context.Context, userID int, filter entities.ListFilter) (_ []entities.OrderData, err error) {
+	ctx, done := p.withDeadline(ctx, "GetOrdersList")
+	defer done(&err)
+
+	conditions, args := buildListConditions(postgresqlDialect, filter, "uploaded_at", "status", userID)
+	query := `
 		SELECT id, user_id, order_number, status, accural, uploaded_at 
-		FROM orders 
-		WHERE user_id = $1`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+		FROM ` + buildListSource("orders", "id, user_id, order_number, status, accural, uploaded_at", filter) + `
+		WHERE ` + conditions + `
+		ORDER BY uploaded_at DESC, id DESC` + buildLimit(filter)
 
 	var orders []entities.OrderData
-	for rows.Next() {
-		var order entities.OrderData
-		var time time2.Time
-		if err := rows.Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &time); err != nil {
-			return nil, err
+	err = p.withReader(ctx, userID, func(db querier) error {
+		orders = nil
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
 		}
-		order.UploadedAt.Time = time
-		orders = append(orders, order)
+		defer rows.Close()
+
+		for rows.Next() {
+			var order entities.OrderData
+			var time time2.Time
+			if err := rows.Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &time); err != nil {
+				return err
+			}
+			order.UploadedAt.Time = time
+			orders = append(orders, order)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
-	return orders, rows.Err()
+	return orders, nil
 }
 
-func (p *Postgresql) GetUnfinishedOrdersList(ctx context.Context) ([]entities.OrderData, error) {
-	rows, err := p.store.QueryContext(ctx, `
+func (p *Postgresql) GetUnfinishedOrdersList(ctx context.Context) (_ []entities.OrderData, err error) {
+	ctx, done := p.withDeadline(ctx, "GetUnfinishedOrdersList")
+	defer done(&err)
+
+	rows, err := p.store.Query(ctx, `
 		SELECT id, user_id, order_number, status, accural, uploaded_at 
 		FROM orders
 		WHERE status IN ('NEW', 'PROCESSING')`)
@@ -231,101 +431,152 @@ func (p *Postgresql) GetUnfinishedOrdersList(ctx context.Context) ([]entities.Or
 	return orders, nil
 }
 
-func (p *Postgresql) GetBalance(ctx context.Context, userID int) (entities.BalanceData, error) {
+func (p *Postgresql) GetBalance(ctx context.Context, userID int) (_ entities.BalanceData, err error) {
+	ctx, done := p.withDeadline(ctx, "GetBalance")
+	defer done(&err)
+
 	var balance entities.BalanceData
 
-	// Current balance
-	err := p.store.QueryRowContext(ctx, `
-		SELECT id, user_id, points 
+	err = p.withReader(ctx, userID, func(db querier) error {
+		return db.QueryRow(ctx, `
+		SELECT id, user_id, points, withdrawn 
 		FROM balances 
-		WHERE user_id = $1`, userID).Scan(&balance.ID, &balance.UserID, &balance.Current)
-	if err != nil {
-		return balance, err
-	}
-
-	//Sum of withdrawals
-	err = p.store.QueryRowContext(ctx, `
-		SELECT COALESCE(SUM(amount), 0) 
-		FROM withdrawals 
-		WHERE user_id = $1`, userID).Scan(&balance.Withdrawn)
-	if err != nil {
+		WHERE user_id = $1`, userID).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		//nothing was accrued yet
+		return entities.BalanceData{UserID: userID}, nil
+	} else if err != nil {
 		return balance, err
 	}
 
 	return balance, nil
 }
 
-func (p *Postgresql) AddToBalance(ctx context.Context, userID int, amount float64) error {
-	_, err := p.store.ExecContext(ctx, `
+func (p *Postgresql) AddToBalance(ctx context.Context, userID int, amount float64) (err error) {
+	ctx, done := p.withDeadline(ctx, "AddToBalance")
+	defer done(&err)
+
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
 		INSERT INTO balances (user_id, points) 
 		VALUES ($1, $2) 
 		ON CONFLICT (user_id) 
 		DO UPDATE SET points = balances.points + $2`,
-		userID, amount)
-	return err
-}
-
-func (p *Postgresql) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64) error {
-	tx, err := p.store.BeginTx(ctx, nil)
-	if err != nil {
+			userID, amount)
 		return err
+	})
+	if err != nil {
+		return mapConstraintError(err)
 	}
 
-	// Check balance
-	var currentBalance float64
-	err = tx.QueryRowContext(ctx, `
+	p.markWrite(userID)
+	return nil
+}
+
+// WithdrawFromBalance withdraws points and saves a withdrawal. A user without a balance has 0 points.
+// merchantID is 0 if a user withdraws points on their own.
+func (p *Postgresql) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) (err error) {
+	ctx, done := p.withDeadline(ctx, "WithdrawFromBalance")
+	defer done(&err)
+
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		//a repeated order is a conflict even if there are not enough points for it now,
+		//order numbers are unique with archived withdrawals too
+		var exists bool
+		err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM withdrawals WHERE order_num = $1)
+			OR EXISTS (SELECT 1 FROM withdrawals_archive WHERE order_num = $1)`, orderNum).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("cant check withdrawals, err: %w", err)
+		}
+		if exists {
+			return gophermart_errors.MakeErrWithdrawalAlreadyExists()
+		}
+
+		// Check balance
+		var currentBalance float64
+		err = tx.QueryRow(ctx, `
 		SELECT points 
 		FROM balances 
 		WHERE user_id = $1 FOR UPDATE`, userID).Scan(&currentBalance)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("cant get balance to check, err: %w", err)
-	}
+		if errors.Is(err, pgx.ErrNoRows) {
+			currentBalance = 0
+		} else if err != nil {
+			return fmt.Errorf("cant get balance to check, err: %w", err)
+		}
 
-	if currentBalance < amount {
-		tx.Rollback()
-		return gophermart_errors.MakeErrNotEnoughPoints()
-	}
+		if currentBalance < amount {
+			return gophermart_errors.MakeErrNotEnoughPoints()
+		}
 
-	// Withdraw
-	_, err = tx.ExecContext(ctx, `
+		// Withdraw
+		_, err = tx.Exec(ctx, `
 		UPDATE balances 
-		SET points = points - $1 
+		SET points = points - $1, withdrawn = withdrawn + $1 
 		WHERE user_id = $2`, amount, userID)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("cant withdraw from balance in db, err: %w", err)
-	}
+		if err != nil {
+			return fmt.Errorf("cant withdraw from balance in db, err: %w", mapConstraintError(err))
+		}
 
-	// Add new withdrawal
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO withdrawals (order_num, user_id, amount, processed_at) 
-		VALUES ($1, $2, $3, now())`,
-		orderNum, userID, amount)
+		// Add new withdrawal
+		processedAt := time2.Now().Local()
+		_, err = tx.Exec(ctx, `
+		INSERT INTO withdrawals (order_num, user_id, amount, processed_at, merchant_id) 
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0))`,
+			orderNum, userID, amount, processedAt, merchantID)
+		if err != nil {
+			return fmt.Errorf("cant add new withdrawal, err: %w", mapConstraintError(err))
+		}
+
+		return insertOutboxEvent(ctx, tx, entities.EventPointsWithdrawn, &entities.WithdrawalEventPayload{
+			UserID:      userID,
+			OrderNum:    orderNum,
+			Sum:         amount,
+			ProcessedAt: entities.TimeRFC3339{Time: processedAt},
+			MerchantID:  merchantID,
+		})
+	})
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("cant add new withdrawal, err: %w", err)
+		return err
 	}
 
-	return tx.Commit()
+	p.markWrite(userID)
+	return nil
 }
 
-func (p *Postgresql) GetWithdrawals(ctx context.Context, userID int) ([]entities.WithdrawalData, error) {
-	rows, err := p.store.QueryContext(ctx, `
-		SELECT order_num, amount, processed_at 
-		FROM withdrawals WHERE user_id = $1`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// GetWithdrawals returns user`s withdrawals, newest first, restricted by a filter (statuses are ignored).
+func (p *Postgresql) GetWithdrawals(ctx context.Context, userID int, filter entities.ListFilter) (_ []entities.WithdrawalData, err error) {
+	ctx, done := p.withDeadline(ctx, "GetWithdrawals")
+	defer done(&err)
+
+	conditions, args := buildListConditions(postgresqlDialect, filter, "processed_at", "", userID)
+	query := `
+		SELECT id, order_num, amount, processed_at 
+		FROM ` + buildListSource("withdrawals", "id, user_id, order_num, amount, processed_at", filter) + `
+		WHERE ` + conditions + `
+		ORDER BY processed_at DESC, id DESC` + buildLimit(filter)
 
 	var withdrawals []entities.WithdrawalData
-	for rows.Next() {
-		var withdrawal entities.WithdrawalData
-		if err := rows.Scan(&withdrawal.OrderNum, &withdrawal.Sum, &withdrawal.ProcessedAt.Time); err != nil {
-			return nil, err
+	err = p.withReader(ctx, userID, func(db querier) error {
+		withdrawals = nil
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var withdrawal entities.WithdrawalData
+			if err := rows.Scan(&withdrawal.ID, &withdrawal.OrderNum, &withdrawal.Sum, &withdrawal.ProcessedAt.Time); err != nil {
+				return err
+			}
+			withdrawals = append(withdrawals, withdrawal)
 		}
-		withdrawals = append(withdrawals, withdrawal)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
-	return withdrawals, rows.Err()
+	return withdrawals, nil
 }
@@ -0,0 +1,203 @@
+package databases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// insertAuditRecord saves an admin action, it is called in a transaction of an action itself when there is one.
+func insertAuditRecord(ctx context.Context, db querier, record entities.AdminAuditRecord) error {
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		return fmt.Errorf("cant marshal audit record details, err: %w", err)
+	}
+	_, err = db.Exec(ctx, `
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, details)
+		VALUES ($1, $2, NULLIF($3, 0), $4)`,
+		record.AdminID, record.Action, record.TargetUserID, details)
+	if err != nil {
+		return fmt.Errorf("cant save an audit record, err: %w", mapConstraintError(err))
+	}
+	return nil
+}
+
+// SaveAdminAuditRecord saves an admin action, which doesn`t change anything in the storage (a lookup for example).
+func (p *Postgresql) SaveAdminAuditRecord(ctx context.Context, record entities.AdminAuditRecord) (err error) {
+	ctx, done := p.withDeadline(ctx, "SaveAdminAuditRecord")
+	defer done(&err)
+
+	return insertAuditRecord(ctx, p.store, record)
+}
+
+// GetUserRoles returns roles of a user. Roles are read from the primary, so a granted role is seen at once.
+func (p *Postgresql) GetUserRoles(ctx context.Context, userID int) (_ []string, err error) {
+	ctx, done := p.withDeadline(ctx, "GetUserRoles")
+	defer done(&err)
+
+	rows, err := p.store.Query(ctx, `
+		SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// GrantRole gives a role to a user found by login. Returns MakeErrUserNotFound() for an unknown login.
+func (p *Postgresql) GrantRole(ctx context.Context, login string, role string) (err error) {
+	ctx, done := p.withDeadline(ctx, "GrantRole")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role)
+		SELECT id, $2 FROM users WHERE lower(login) = lower($1)
+		ON CONFLICT DO NOTHING`, login, role)
+	if err != nil {
+		return mapConstraintError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		//a role could be granted before
+		var exists bool
+		err = p.store.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE lower(login) = lower($1))`, login).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return gophermart_errors.MakeErrUserNotFound()
+		}
+	}
+	return nil
+}
+
+// GetUserByLogin finds a user with roles. Returns MakeErrUserNotFound() for an unknown login.
+func (p *Postgresql) GetUserByLogin(ctx context.Context, login string) (_ entities.UserInfo, err error) {
+	ctx, done := p.withDeadline(ctx, "GetUserByLogin")
+	defer done(&err)
+
+	var user entities.UserInfo
+	err = p.store.QueryRow(ctx, `
+		SELECT u.id, u.login, COALESCE(array_agg(r.role ORDER BY r.role) FILTER (WHERE r.role IS NOT NULL), '{}')
+		FROM users u
+		LEFT JOIN user_roles r ON r.user_id = u.id
+		WHERE lower(u.login) = lower($1)
+		GROUP BY u.id, u.login`, login).Scan(&user.ID, &user.Login, &user.Roles)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user, gophermart_errors.MakeErrUserNotFound()
+	} else if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// AdjustBalance adds points to a balance (or takes them away with a negative amount) and saves an adjustment
+// with an audit record. Returns a new balance or MakeErrNotEnoughPoints() if a balance would become negative.
+func (p *Postgresql) AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (_ entities.BalanceData, err error) {
+	ctx, done := p.withDeadline(ctx, "AdjustBalance")
+	defer done(&err)
+
+	var balance entities.BalanceData
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		//an upsert can`t be used for a negative amount, a check constraint fails on a row to insert before a conflict
+		err := tx.QueryRow(ctx, `
+		UPDATE balances SET points = points + $2
+		WHERE user_id = $1
+		RETURNING id, user_id, points, withdrawn`,
+			adjustment.UserID, adjustment.Amount).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+		if errors.Is(err, pgx.ErrNoRows) {
+			if adjustment.Amount < 0 {
+				return gophermart_errors.MakeErrNotEnoughPoints()
+			}
+			err = tx.QueryRow(ctx, `
+		INSERT INTO balances (user_id, points)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET points = balances.points + $2
+		RETURNING id, user_id, points, withdrawn`,
+				adjustment.UserID, adjustment.Amount).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+		}
+		if err != nil {
+			return fmt.Errorf("cant adjust balance, err: %w", mapConstraintError(err))
+		}
+
+		_, err = tx.Exec(ctx, `
+		INSERT INTO balance_adjustments (user_id, admin_id, amount, reason, processed_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+			adjustment.UserID, adjustment.AdminID, adjustment.Amount, adjustment.Reason, time.Now().Local())
+		if err != nil {
+			return fmt.Errorf("cant save a balance adjustment, err: %w", mapConstraintError(err))
+		}
+
+		return insertAuditRecord(ctx, tx, entities.AdminAuditRecord{
+			AdminID:      adjustment.AdminID,
+			Action:       entities.AuditActionBalanceAdjustment,
+			TargetUserID: adjustment.UserID,
+			Details:      adjustment,
+		})
+	})
+	if err != nil {
+		return balance, err
+	}
+
+	p.markWrite(adjustment.UserID)
+	return balance, nil
+}
+
+// RequeueOrder makes an unprocessed order "NEW" again, so the accrual daemon asks about it once more.
+// Returns MakeErrOrderNotFound() for an unknown (or archived) order and MakeErrOrderAlreadyProcessed() for a processed one.
+func (p *Postgresql) RequeueOrder(ctx context.Context, orderNumber string, adminID int) (_ entities.OrderData, err error) {
+	ctx, done := p.withDeadline(ctx, "RequeueOrder")
+	defer done(&err)
+
+	var order entities.OrderData
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		var oldStatus string
+		err := tx.QueryRow(ctx, `
+		SELECT id, user_id, order_number, status, uploaded_at
+		FROM orders
+		WHERE order_number = $1 FOR UPDATE`, orderNumber).Scan(&order.ID, &order.UserID, &order.Number, &oldStatus, &order.UploadedAt.Time)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrOrderNotFound()
+		} else if err != nil {
+			return fmt.Errorf("cant get an order to requeue, err: %w", err)
+		}
+		if oldStatus == entities.OrderStatusProcessed {
+			return gophermart_errors.MakeErrOrderAlreadyProcessed()
+		}
+
+		order.Status = entities.OrderStatusNew
+		_, err = tx.Exec(ctx, `
+		UPDATE orders SET status = $1, accural = 0 WHERE id = $2`, order.Status, order.ID)
+		if err != nil {
+			return fmt.Errorf("cant requeue an order, err: %w", err)
+		}
+
+		return insertAuditRecord(ctx, tx, entities.AdminAuditRecord{
+			AdminID:      adminID,
+			Action:       entities.AuditActionOrderRequeue,
+			TargetUserID: order.UserID,
+			Details:      map[string]string{"order": order.Number, "previous_status": oldStatus},
+		})
+	})
+	if err != nil {
+		return order, err
+	}
+
+	p.markWrite(order.UserID)
+	return order, nil
+}
@@ -0,0 +1,67 @@
+package databases
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// ArchiveOrders moves up to batchSize finished orders, uploaded before olderThan, to the archive.
+// Returns an amount of moved orders.
+func (p *Postgresql) ArchiveOrders(ctx context.Context, olderThan time.Time, batchSize int) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "ArchiveOrders")
+	defer done(&err)
+
+	var moved int64
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+		WITH moved AS (
+			DELETE FROM orders
+			WHERE id IN (
+				SELECT id FROM orders
+				WHERE status IN ('PROCESSED', 'INVALID') AND uploaded_at < $1
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED)
+			RETURNING id, user_id, order_number, status, accural, uploaded_at, processed_at, merchant_id)
+		INSERT INTO orders_archive (id, user_id, order_number, status, accural, uploaded_at, processed_at, merchant_id)
+		SELECT id, user_id, order_number, status, accural, uploaded_at, processed_at, merchant_id FROM moved`,
+			olderThan.Local(), batchSize)
+		moved = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// ArchiveWithdrawals moves up to batchSize withdrawals, processed before olderThan, to the archive.
+// Returns an amount of moved withdrawals.
+func (p *Postgresql) ArchiveWithdrawals(ctx context.Context, olderThan time.Time, batchSize int) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "ArchiveWithdrawals")
+	defer done(&err)
+
+	var moved int64
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+		WITH moved AS (
+			DELETE FROM withdrawals
+			WHERE id IN (
+				SELECT id FROM withdrawals
+				WHERE processed_at < $1
+				ORDER BY id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED)
+			RETURNING id, order_num, user_id, amount, processed_at, merchant_id)
+		INSERT INTO withdrawals_archive (id, order_num, user_id, amount, processed_at, merchant_id)
+		SELECT id, order_num, user_id, amount, processed_at, merchant_id FROM moved`,
+			olderThan.Local(), batchSize)
+		moved = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
@@ -0,0 +1,81 @@
+package databases
+
+import (
+	"context"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// GetBalanceAt computes a balance at the moment "at" from processed orders, withdrawals (including archived ones)
+// and balance adjustments made by admins.
+func (p *Postgresql) GetBalanceAt(ctx context.Context, userID int, at time.Time) (_ entities.BalanceData, err error) {
+	ctx, done := p.withDeadline(ctx, "GetBalanceAt")
+	defer done(&err)
+
+	balance := entities.BalanceData{UserID: userID}
+	var accrued, adjusted float64
+	err = p.withReader(ctx, userID, func(db querier) error {
+		return db.QueryRow(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(accural) FROM `+balanceOrdersSource+`
+				WHERE user_id = $1 AND status = 'PROCESSED' AND processed_at <= $2), 0),
+			COALESCE((SELECT SUM(amount) FROM `+balanceWithdrawalsSource+`
+				WHERE user_id = $1 AND processed_at <= $2), 0),
+			COALESCE((SELECT SUM(amount) FROM balance_adjustments
+				WHERE user_id = $1 AND processed_at <= $2), 0)`,
+			userID, at.Local()).Scan(&accrued, &balance.Withdrawn, &adjusted)
+	})
+	if err != nil {
+		return balance, err
+	}
+
+	balance.Current = accrued + adjusted - balance.Withdrawn
+	return balance, nil
+}
+
+// GetBalanceEvents returns balance changes in (from, to], oldest first. An adjustment is accrued points,
+// a negative one takes points away.
+func (p *Postgresql) GetBalanceEvents(ctx context.Context, userID int, from time.Time, to time.Time) (_ []entities.BalanceEvent, err error) {
+	ctx, done := p.withDeadline(ctx, "GetBalanceEvents")
+	defer done(&err)
+
+	var events []entities.BalanceEvent
+	err = p.withReader(ctx, userID, func(db querier) error {
+		events = nil
+		rows, err := db.Query(ctx, `
+		SELECT processed_at, accural, 0::FLOAT
+		FROM `+balanceOrdersSource+`
+		WHERE user_id = $1 AND status = 'PROCESSED' AND processed_at > $2 AND processed_at <= $3
+		UNION ALL
+		SELECT processed_at, 0::FLOAT, amount
+		FROM `+balanceWithdrawalsSource+`
+		WHERE user_id = $1 AND processed_at > $2 AND processed_at <= $3
+		UNION ALL
+		SELECT processed_at, amount, 0::FLOAT
+		FROM balance_adjustments
+		WHERE user_id = $1 AND processed_at > $2 AND processed_at <= $3
+		ORDER BY 1`,
+			userID, from.Local(), to.Local())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event entities.BalanceEvent
+			var wallClock time.Time
+			if err := rows.Scan(&wallClock, &event.Accrued, &event.Withdrawn); err != nil {
+				return err
+			}
+			//timestamps are stored without time zone in server`s local time
+			event.Time = time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(),
+				wallClock.Hour(), wallClock.Minute(), wallClock.Second(), wallClock.Nanosecond(), time.Local)
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
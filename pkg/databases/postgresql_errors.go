@@ -0,0 +1,65 @@
+package databases
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// constraintErrors maps constraints to business errors, which handlers understand.
+var constraintErrors = map[string]error{
+	"orders_user_id_fkey":                gophermart_errors.MakeErrUserNotFound(),
+	"balances_user_id_fkey":              gophermart_errors.MakeErrUserNotFound(),
+	"withdrawals_user_id_fkey":           gophermart_errors.MakeErrUserNotFound(),
+	"idempotency_keys_user_id_fkey":      gophermart_errors.MakeErrUserNotFound(),
+	"refresh_tokens_user_id_fkey":        gophermart_errors.MakeErrUserNotFound(),
+	"password_reset_tokens_user_id_fkey": gophermart_errors.MakeErrUserNotFound(),
+	"user_roles_user_id_fkey":            gophermart_errors.MakeErrUserNotFound(),
+	"balance_adjustments_user_id_fkey":   gophermart_errors.MakeErrUserNotFound(),
+	"balances_points_non_negative":       gophermart_errors.MakeErrNotEnoughPoints(),
+	"withdrawals_order_num_key":          gophermart_errors.MakeErrWithdrawalAlreadyExists(),
+	"users_login_lower_key":              gophermart_errors.MakeErrUserAlreadyExists(),
+	"merchants_name_key":                 gophermart_errors.MakeErrMerchantAlreadyExists(),
+	"api_keys_merchant_id_fkey":          gophermart_errors.MakeErrMerchantNotFound(),
+	"merchant_users_merchant_id_fkey":    gophermart_errors.MakeErrMerchantNotFound(),
+	"merchant_users_user_id_fkey":        gophermart_errors.MakeErrUserNotFound(),
+	"orders_merchant_id_fkey":            gophermart_errors.MakeErrMerchantNotFound(),
+	"withdrawals_merchant_id_fkey":       gophermart_errors.MakeErrMerchantNotFound(),
+
+	"orders_archive_user_id_fkey":       gophermart_errors.MakeErrUserNotFound(),
+	"withdrawals_archive_user_id_fkey":  gophermart_errors.MakeErrUserNotFound(),
+	"withdrawals_archive_order_num_key": gophermart_errors.MakeErrWithdrawalAlreadyExists(),
+}
+
+// mapConstraintError turns constraint violations into typed errors. Other errors are returned as is.
+func mapConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	var kind error
+	switch pgErr.Code {
+	case "23505":
+		kind = gophermart_errors.MakeErrUniqueViolation()
+	case "23503":
+		kind = gophermart_errors.MakeErrForeignKeyViolation()
+	case "23514":
+		kind = gophermart_errors.MakeErrCheckViolation()
+	case "23502":
+		kind = gophermart_errors.MakeErrNotNullViolation()
+	default:
+		return err
+	}
+
+	return constraintViolation(pgErr.ConstraintName, kind)
+}
+
+// constraintViolation joins a violation with a business error of its constraint, if there is one.
+func constraintViolation(constraint string, kind error) error {
+	violation := &gophermart_errors.ConstraintViolationError{Constraint: constraint, Err: kind}
+	if businessErr, ok := constraintErrors[constraint]; ok {
+		return errors.Join(businessErr, violation)
+	}
+	return violation
+}
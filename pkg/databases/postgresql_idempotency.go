@@ -0,0 +1,109 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// ReserveIdempotencyKey saves a new (in progress) record if there is no unexpired record with the same key.
+// A record, which is in progress longer than lease, is taken over, so a crashed request doesn`t hold its key for ttl.
+// Returns "true" and the record with its reservation time (CreatedAt) if the key was reserved,
+// otherwise returns "false" and the existing record.
+func (p *Postgresql) ReserveIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord, ttl time.Duration, lease time.Duration) (_ entities.IdempotencyRecord, _ bool, err error) {
+	ctx, done := p.withDeadline(ctx, "ReserveIdempotencyKey")
+	defer done(&err)
+
+	err = p.store.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (user_id, idem_key, fingerprint, created_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (user_id, idem_key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, content_type = NULL,
+			response_body = NULL, created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < now() - make_interval(secs => $4)
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < now() - make_interval(secs => $5))
+		RETURNING created_at`,
+		record.UserID, record.Key, record.Fingerprint, ttl.Seconds(), lease.Seconds()).Scan(&record.CreatedAt)
+	if err == nil {
+		return record, true, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return entities.IdempotencyRecord{}, false, mapConstraintError(err)
+	}
+
+	//key is already used
+	existing := entities.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var statusCode *int
+	var contentType *string
+	err = p.store.QueryRow(ctx, `
+		SELECT fingerprint, status_code, content_type, response_body, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idem_key = $2`,
+		record.UserID, record.Key).Scan(&existing.Fingerprint, &statusCode, &contentType, &existing.Body, &existing.CreatedAt)
+	if err != nil {
+		return entities.IdempotencyRecord{}, false, err
+	}
+	if statusCode != nil {
+		existing.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		existing.ContentType = *contentType
+	}
+
+	return existing, false, nil
+}
+
+// SaveIdempotentResponse saves a response of a request, made with a reserved key. A reservation is matched
+// by CreatedAt, so a request, whose key was taken over after a lease, gets MakeErrIdempotencyLeaseLost().
+func (p *Postgresql) SaveIdempotentResponse(ctx context.Context, record entities.IdempotencyRecord) (err error) {
+	ctx, done := p.withDeadline(ctx, "SaveIdempotentResponse")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = $1, content_type = $2, response_body = $3
+		WHERE user_id = $4 AND idem_key = $5 AND created_at = $6 AND status_code IS NULL`,
+		record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return gophermart_errors.MakeErrIdempotencyLeaseLost()
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases a reserved key, so a request can be retried with it. A key, which was taken over
+// after a lease, isn`t released and MakeErrIdempotencyLeaseLost() is returned.
+func (p *Postgresql) DeleteIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord) (err error) {
+	ctx, done := p.withDeadline(ctx, "DeleteIdempotencyKey")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idem_key = $2 AND created_at = $3 AND status_code IS NULL`,
+		record.UserID, record.Key, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return gophermart_errors.MakeErrIdempotencyLeaseLost()
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than ttl.
+func (p *Postgresql) DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "DeleteExpiredIdempotencyKeys")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE created_at < now() - make_interval(secs => $1)`, ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
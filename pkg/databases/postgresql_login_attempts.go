@@ -0,0 +1,85 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// AddLoginFailure counts a failure of a key and returns an amount of failures in a row.
+// A counter starts again if the previous failure was more than window ago.
+func (p *Postgresql) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (_ int, err error) {
+	ctx, done := p.withDeadline(ctx, "AddLoginFailure")
+	defer done(&err)
+
+	var failures int
+	err = p.store.QueryRow(ctx, `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING failures`, key, now.Local(), now.Add(-window).Local()).Scan(&failures)
+	return failures, err
+}
+
+// ReleaseLoginFailure takes back a failure, counted for an attempt, which turned out to be successful.
+func (p *Postgresql) ReleaseLoginFailure(ctx context.Context, key string) (err error) {
+	ctx, done := p.withDeadline(ctx, "ReleaseLoginFailure")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE attempt_key = $1`, key)
+	return err
+}
+
+func (p *Postgresql) LockLoginAttempts(ctx context.Context, key string, until time.Time) (err error) {
+	ctx, done := p.withDeadline(ctx, "LockLoginAttempts")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		UPDATE login_attempts SET locked_until = $2 WHERE attempt_key = $1`, key, until.Local())
+	return err
+}
+
+// GetLoginLock returns a time, until which attempts of a key are locked (zero time if they are not).
+func (p *Postgresql) GetLoginLock(ctx context.Context, key string) (_ time.Time, err error) {
+	ctx, done := p.withDeadline(ctx, "GetLoginLock")
+	defer done(&err)
+
+	var lockedUntil *time.Time
+	err = p.store.QueryRow(ctx, `
+		SELECT locked_until FROM login_attempts WHERE attempt_key = $1`, key).Scan(&lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && lockedUntil == nil) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	//TIMESTAMP is a local wall clock time, but pgx reads it as UTC
+	return time.Date(lockedUntil.Year(), lockedUntil.Month(), lockedUntil.Day(),
+		lockedUntil.Hour(), lockedUntil.Minute(), lockedUntil.Second(), lockedUntil.Nanosecond(), time.Local), nil
+}
+
+func (p *Postgresql) ResetLoginAttempts(ctx context.Context, key string) (err error) {
+	ctx, done := p.withDeadline(ctx, "ResetLoginAttempts")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		DELETE FROM login_attempts WHERE attempt_key = $1`, key)
+	return err
+}
+
+// DeleteExpiredLoginAttempts removes counters, whose last failure was before olderThan and which are not locked.
+func (p *Postgresql) DeleteExpiredLoginAttempts(ctx context.Context, olderThan time.Time) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "DeleteExpiredLoginAttempts")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $2)`, olderThan.Local(), time.Now().Local())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
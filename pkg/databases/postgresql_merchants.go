@@ -0,0 +1,221 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// scopes are stored as a comma separated list, they never contain commas.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+// CreateMerchant saves a merchant with an audit record. Returns MakeErrMerchantAlreadyExists() for a taken name.
+func (p *Postgresql) CreateMerchant(ctx context.Context, name string, adminID int) (_ entities.Merchant, err error) {
+	ctx, done := p.withDeadline(ctx, "CreateMerchant")
+	defer done(&err)
+
+	merchant := entities.Merchant{Name: name}
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		merchant.CreatedAt.Time = time.Now().Local()
+		err := tx.QueryRow(ctx, `
+		INSERT INTO merchants (name, created_at)
+		VALUES ($1, $2)
+		RETURNING id`, name, merchant.CreatedAt.Time).Scan(&merchant.ID)
+		if err != nil {
+			return mapConstraintError(err)
+		}
+
+		return insertAuditRecord(ctx, tx, entities.AdminAuditRecord{
+			AdminID: adminID,
+			Action:  entities.AuditActionMerchantCreate,
+			Details: map[string]any{"merchant_id": merchant.ID, "name": name},
+		})
+	})
+	return merchant, err
+}
+
+// CreateAPIKey saves a key of a merchant with an audit record. Returns MakeErrMerchantNotFound() for an unknown merchant.
+func (p *Postgresql) CreateAPIKey(ctx context.Context, key entities.APIKey, adminID int) (_ entities.APIKey, err error) {
+	ctx, done := p.withDeadline(ctx, "CreateAPIKey")
+	defer done(&err)
+
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		var exists bool
+		err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM merchants WHERE id = $1)`, key.MerchantID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return gophermart_errors.MakeErrMerchantNotFound()
+		}
+
+		key.CreatedAt.Time = time.Now().Local()
+		err = tx.QueryRow(ctx, `
+		INSERT INTO api_keys (merchant_id, key_prefix, key_hash, scopes, rate_limit, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+			key.MerchantID, key.Prefix, key.Hash, joinScopes(key.Scopes), key.RateLimit, key.CreatedAt.Time).Scan(&key.ID)
+		if err != nil {
+			return mapConstraintError(err)
+		}
+
+		return insertAuditRecord(ctx, tx, entities.AdminAuditRecord{
+			AdminID: adminID,
+			Action:  entities.AuditActionAPIKeyCreate,
+			Details: &key,
+		})
+	})
+	return key, err
+}
+
+// RevokeAPIKey revokes a key of a merchant with an audit record. Returns MakeErrAPIKeyNotFound()
+// if a merchant has no such key or it is already revoked.
+func (p *Postgresql) RevokeAPIKey(ctx context.Context, merchantID int, keyID int, adminID int) (err error) {
+	ctx, done := p.withDeadline(ctx, "RevokeAPIKey")
+	defer done(&err)
+
+	return p.runInTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = $3
+		WHERE id = $1 AND merchant_id = $2 AND revoked_at IS NULL`, keyID, merchantID, time.Now().Local())
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return gophermart_errors.MakeErrAPIKeyNotFound()
+		}
+
+		return insertAuditRecord(ctx, tx, entities.AdminAuditRecord{
+			AdminID: adminID,
+			Action:  entities.AuditActionAPIKeyRevoke,
+			Details: map[string]int{"merchant_id": merchantID, "key_id": keyID},
+		})
+	})
+}
+
+// GetAPIKey finds an active key by its hash. Returns MakeErrAPIKeyNotFound() for an unknown or revoked key.
+// Keys are read from the primary, so a revoked key stops working at once.
+func (p *Postgresql) GetAPIKey(ctx context.Context, hash string) (_ entities.APIKey, err error) {
+	ctx, done := p.withDeadline(ctx, "GetAPIKey")
+	defer done(&err)
+
+	key := entities.APIKey{Hash: hash}
+	var scopes string
+	var createdAt time.Time
+	err = p.store.QueryRow(ctx, `
+		SELECT id, merchant_id, key_prefix, scopes, rate_limit, created_at
+		FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL`, hash).Scan(&key.ID, &key.MerchantID, &key.Prefix, &scopes, &key.RateLimit, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return key, gophermart_errors.MakeErrAPIKeyNotFound()
+	} else if err != nil {
+		return key, fmt.Errorf("cant get an api key, err: %w", err)
+	}
+	key.Scopes = splitScopes(scopes)
+	//timestamps are stored without time zone in server`s local time
+	key.CreatedAt.Time = time.Date(createdAt.Year(), createdAt.Month(), createdAt.Day(),
+		createdAt.Hour(), createdAt.Minute(), createdAt.Second(), createdAt.Nanosecond(), time.Local)
+	return key, nil
+}
+
+// LinkMerchant lets a merchant act on behalf of a user, linking a linked merchant again changes nothing.
+// Returns MakeErrMerchantNotFound() for an unknown merchant.
+func (p *Postgresql) LinkMerchant(ctx context.Context, userID int, merchantID int) (err error) {
+	ctx, done := p.withDeadline(ctx, "LinkMerchant")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		INSERT INTO merchant_users (merchant_id, user_id, linked_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (merchant_id, user_id) DO NOTHING`, merchantID, userID, time.Now().Local())
+	if err != nil {
+		return mapConstraintError(err)
+	}
+
+	p.markWrite(userID)
+	return nil
+}
+
+// UnlinkMerchant takes a consent of a user back. Returns MakeErrMerchantNotLinked() if a merchant wasn`t linked.
+func (p *Postgresql) UnlinkMerchant(ctx context.Context, userID int, merchantID int) (err error) {
+	ctx, done := p.withDeadline(ctx, "UnlinkMerchant")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		DELETE FROM merchant_users WHERE merchant_id = $1 AND user_id = $2`, merchantID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return gophermart_errors.MakeErrMerchantNotLinked()
+	}
+
+	p.markWrite(userID)
+	return nil
+}
+
+// GetLinkedMerchants returns merchants, linked by a user, oldest links first.
+func (p *Postgresql) GetLinkedMerchants(ctx context.Context, userID int) (_ []entities.MerchantLink, err error) {
+	ctx, done := p.withDeadline(ctx, "GetLinkedMerchants")
+	defer done(&err)
+
+	var links []entities.MerchantLink
+	err = p.withReader(ctx, userID, func(db querier) error {
+		links = nil
+		rows, err := db.Query(ctx, `
+		SELECT m.id, m.name, mu.linked_at
+		FROM merchant_users mu
+		JOIN merchants m ON m.id = mu.merchant_id
+		WHERE mu.user_id = $1
+		ORDER BY mu.linked_at, m.id`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var link entities.MerchantLink
+			var linkedAt time.Time
+			if err := rows.Scan(&link.MerchantID, &link.MerchantName, &linkedAt); err != nil {
+				return err
+			}
+			//timestamps are stored without time zone in server`s local time
+			link.LinkedAt.Time = time.Date(linkedAt.Year(), linkedAt.Month(), linkedAt.Day(),
+				linkedAt.Hour(), linkedAt.Minute(), linkedAt.Second(), linkedAt.Nanosecond(), time.Local)
+			links = append(links, link)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// IsMerchantLinked checks a consent of a user. Links are read from the primary, so an unlinked merchant
+// loses access at once.
+func (p *Postgresql) IsMerchantLinked(ctx context.Context, merchantID int, userID int) (_ bool, err error) {
+	ctx, done := p.withDeadline(ctx, "IsMerchantLinked")
+	defer done(&err)
+
+	var linked bool
+	err = p.store.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM merchant_users WHERE merchant_id = $1 AND user_id = $2)`,
+		merchantID, userID).Scan(&linked)
+	return linked, err
+}
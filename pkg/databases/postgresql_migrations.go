@@ -0,0 +1,409 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// migration is a versioned schema change. Migrations are applied in order, each one in its own transaction.
+type migration struct {
+	version int
+	name    string
+	//check returns a reason, why a migration can`t be applied, or NULL if it can. It runs before queries.
+	check   string
+	queries []string
+}
+
+// migrationsLockID is a key of an advisory lock, that prevents several instances from migrating at once.
+const migrationsLockID = 7_162_534
+
+var postgresqlMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial tables",
+		//tables made before versioned migrations can have repeated withdrawals of one order, they should be refunded
+		//and deleted by hand, so the unique index can be built. withdrawals doesn`t exist in a new database,
+		//so it is queried by query_to_xml, which resolves the table only when the query runs.
+		check: `
+			SELECT CASE WHEN to_regclass('withdrawals') IS NOT NULL THEN
+				'withdrawals repeat order numbers, refund repeated withdrawals and delete them before the migration: ' ||
+				(xpath('/row/repeats/text()', query_to_xml($$
+					SELECT string_agg(order_num || ' (ids ' || ids || ')', '; ') AS repeats
+					FROM (
+						SELECT order_num, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+						FROM withdrawals GROUP BY order_num HAVING count(*) > 1
+					) AS duplicates$$, false, true, '')))[1]::TEXT
+			END`,
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id SERIAL PRIMARY KEY,
+				login VARCHAR(255) UNIQUE,
+				password_hash VARCHAR(255),
+				password_salt VARCHAR(255)
+			);`,
+			`CREATE TABLE IF NOT EXISTS orders (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER,
+				order_number VARCHAR(255) UNIQUE,
+				status VARCHAR(255),
+				accural FLOAT,
+				uploaded_at TIMESTAMP
+			);`,
+			`CREATE TABLE IF NOT EXISTS balances (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER UNIQUE,
+				points FLOAT
+			);`,
+			`CREATE TABLE IF NOT EXISTS withdrawals (
+				id SERIAL PRIMARY KEY,
+				order_num VARCHAR(255),
+				user_id INTEGER,
+				amount FLOAT,
+				processed_at TIMESTAMP
+			);`,
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				user_id INTEGER,
+				idem_key VARCHAR(255),
+				fingerprint VARCHAR(64),
+				status_code INTEGER,
+				content_type VARCHAR(255),
+				response_body BYTEA,
+				created_at TIMESTAMPTZ,
+				PRIMARY KEY (user_id, idem_key)
+			);`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS withdrawals_order_num_key ON withdrawals (order_num);`,
+		},
+	},
+	{
+		version: 2,
+		name:    "referential integrity and indexes",
+		queries: []string{
+			//statuses from an accrual system were saved as is before
+			`UPDATE orders SET status = 'PROCESSING' WHERE status = 'REGISTERED';`,
+			`ALTER TABLE users
+				ALTER COLUMN login SET NOT NULL,
+				ALTER COLUMN password_hash SET NOT NULL,
+				ALTER COLUMN password_salt SET NOT NULL;`,
+			`ALTER TABLE orders
+				ALTER COLUMN user_id SET NOT NULL,
+				ALTER COLUMN order_number SET NOT NULL,
+				ALTER COLUMN status SET NOT NULL,
+				ALTER COLUMN accural SET NOT NULL,
+				ALTER COLUMN uploaded_at SET NOT NULL,
+				ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id),
+				ADD CONSTRAINT orders_accrual_non_negative CHECK (accural >= 0),
+				ADD CONSTRAINT orders_status_known CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED'));`,
+			`ALTER TABLE balances
+				ALTER COLUMN user_id SET NOT NULL,
+				ALTER COLUMN points SET NOT NULL,
+				ALTER COLUMN points SET DEFAULT 0,
+				ADD CONSTRAINT balances_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id),
+				ADD CONSTRAINT balances_points_non_negative CHECK (points >= 0);`,
+			`ALTER TABLE withdrawals
+				ALTER COLUMN order_num SET NOT NULL,
+				ALTER COLUMN user_id SET NOT NULL,
+				ALTER COLUMN amount SET NOT NULL,
+				ALTER COLUMN processed_at SET NOT NULL,
+				ADD CONSTRAINT withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id),
+				ADD CONSTRAINT withdrawals_amount_positive CHECK (amount > 0);`,
+			`ALTER TABLE idempotency_keys
+				ADD CONSTRAINT idempotency_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);`,
+			//users lists (GetOrdersList, GetWithdrawals, GetBalance)
+			`CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at DESC, id DESC);`,
+			//GetUnfinishedOrdersList
+			`CREATE INDEX IF NOT EXISTS orders_unfinished_idx ON orders (id) WHERE status IN ('NEW', 'PROCESSING');`,
+			//expired keys cleanup
+			`CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);`,
+		},
+	},
+	{
+		version: 3,
+		name:    "outbox events",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS outbox_events (
+				id BIGSERIAL PRIMARY KEY,
+				event_type VARCHAR(255) NOT NULL,
+				payload JSONB NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				published_at TIMESTAMPTZ
+			);`,
+			`CREATE INDEX IF NOT EXISTS outbox_events_unpublished_idx ON outbox_events (id) WHERE published_at IS NULL;`,
+		},
+	},
+	{
+		version: 4,
+		name:    "order processing time",
+		queries: []string{
+			`ALTER TABLE orders ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;`,
+			//the real time is unknown for orders, processed before this migration
+			`UPDATE orders SET processed_at = uploaded_at WHERE status = 'PROCESSED' AND processed_at IS NULL;`,
+			//balance history
+			`CREATE INDEX IF NOT EXISTS orders_user_id_processed_at_idx ON orders (user_id, processed_at) WHERE status = 'PROCESSED';`,
+		},
+	},
+	{
+		version: 5,
+		name:    "archive tables",
+		queries: []string{
+			//rows keep their ids, so lists with archived rows are paged the same way
+			`CREATE TABLE IF NOT EXISTS orders_archive (
+				id INTEGER PRIMARY KEY,
+				user_id INTEGER NOT NULL CONSTRAINT orders_archive_user_id_fkey REFERENCES users (id),
+				order_number VARCHAR(255) NOT NULL CONSTRAINT orders_archive_order_number_key UNIQUE,
+				status VARCHAR(255) NOT NULL,
+				accural FLOAT NOT NULL,
+				uploaded_at TIMESTAMP NOT NULL,
+				processed_at TIMESTAMP,
+				archived_at TIMESTAMP NOT NULL DEFAULT now()
+			);`,
+			`CREATE TABLE IF NOT EXISTS withdrawals_archive (
+				id INTEGER PRIMARY KEY,
+				order_num VARCHAR(255) NOT NULL CONSTRAINT withdrawals_archive_order_num_key UNIQUE,
+				user_id INTEGER NOT NULL CONSTRAINT withdrawals_archive_user_id_fkey REFERENCES users (id),
+				amount FLOAT NOT NULL,
+				processed_at TIMESTAMP NOT NULL,
+				archived_at TIMESTAMP NOT NULL DEFAULT now()
+			);`,
+			//users lists with archived rows, balance totals and history
+			`CREATE INDEX IF NOT EXISTS orders_archive_user_id_uploaded_at_idx ON orders_archive (user_id, uploaded_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS orders_archive_user_id_processed_at_idx ON orders_archive (user_id, processed_at) WHERE status = 'PROCESSED';`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_archive_user_id_processed_at_idx ON withdrawals_archive (user_id, processed_at DESC, id DESC);`,
+			//archiver
+			`CREATE INDEX IF NOT EXISTS orders_finished_uploaded_at_idx ON orders (uploaded_at) WHERE status IN ('PROCESSED', 'INVALID');`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_processed_at_idx ON withdrawals (processed_at);`,
+		},
+	},
+	{
+		version: 6,
+		name:    "materialized withdrawn total",
+		queries: []string{
+			`ALTER TABLE balances
+				ADD COLUMN IF NOT EXISTS withdrawn FLOAT NOT NULL DEFAULT 0,
+				ADD CONSTRAINT balances_withdrawn_non_negative CHECK (withdrawn >= 0);`,
+			`UPDATE balances SET withdrawn = totals.withdrawn
+				FROM (SELECT user_id, SUM(amount) AS withdrawn
+					FROM (SELECT user_id, amount FROM withdrawals UNION ALL SELECT user_id, amount FROM withdrawals_archive) AS w
+					GROUP BY user_id) AS totals
+				WHERE balances.user_id = totals.user_id;`,
+		},
+	},
+	{
+		version: 7,
+		name:    "refresh tokens and revoked access tokens",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id SERIAL PRIMARY KEY,
+				token_hash VARCHAR(64) NOT NULL CONSTRAINT refresh_tokens_token_hash_key UNIQUE,
+				family_id VARCHAR(64) NOT NULL,
+				user_id INTEGER NOT NULL CONSTRAINT refresh_tokens_user_id_fkey REFERENCES users (id),
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP,
+				revoked_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);`,
+			//access tokens denylist, a token is kept until it expires
+			`CREATE TABLE IF NOT EXISTS revoked_tokens (
+				jti VARCHAR(64) PRIMARY KEY,
+				expires_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);`,
+		},
+	},
+	{
+		version: 8,
+		name:    "failed login attempts",
+		queries: []string{
+			//a key is "login:<login>" or "ip:<address>"
+			`CREATE TABLE IF NOT EXISTS login_attempts (
+				attempt_key VARCHAR(255) PRIMARY KEY,
+				failures INTEGER NOT NULL,
+				last_failure_at TIMESTAMP NOT NULL,
+				locked_until TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);`,
+		},
+	},
+	{
+		version: 9,
+		name:    "case-insensitive unique logins",
+		//logins, which differ in case only, should be renamed by hand first
+		check: `
+			SELECT 'logins differ in case only, rename them before the migration: ' || string_agg(logins, '; ')
+			FROM (
+				SELECT string_agg(login, ', ' ORDER BY id) AS logins
+				FROM users GROUP BY lower(login) HAVING count(*) > 1
+			) AS duplicates`,
+		queries: []string{
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_key ON users (lower(login));`,
+		},
+	},
+	{
+		version: 10,
+		name:    "password changes and reset tokens",
+		queries: []string{
+			//access tokens issued before it are rejected
+			`ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP;`,
+			`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+				id SERIAL PRIMARY KEY,
+				token_hash VARCHAR(64) NOT NULL CONSTRAINT password_reset_tokens_token_hash_key UNIQUE,
+				user_id INTEGER NOT NULL CONSTRAINT password_reset_tokens_user_id_fkey REFERENCES users (id),
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);`,
+			`CREATE INDEX IF NOT EXISTS password_reset_tokens_expires_at_idx ON password_reset_tokens (expires_at);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);`,
+		},
+	},
+	{
+		version: 11,
+		name:    "user roles and admin actions",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS user_roles (
+				user_id INTEGER NOT NULL CONSTRAINT user_roles_user_id_fkey REFERENCES users (id),
+				role VARCHAR(64) NOT NULL,
+				PRIMARY KEY (user_id, role)
+			);`,
+			//manual balance changes, they are a part of a balance history like orders and withdrawals
+			`CREATE TABLE IF NOT EXISTS balance_adjustments (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL CONSTRAINT balance_adjustments_user_id_fkey REFERENCES users (id),
+				admin_id INTEGER NOT NULL CONSTRAINT balance_adjustments_admin_id_fkey REFERENCES users (id),
+				amount FLOAT NOT NULL,
+				reason TEXT NOT NULL,
+				processed_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS balance_adjustments_user_id_processed_at_idx ON balance_adjustments (user_id, processed_at);`,
+			`CREATE TABLE IF NOT EXISTS admin_audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				admin_id INTEGER NOT NULL CONSTRAINT admin_audit_log_admin_id_fkey REFERENCES users (id),
+				action VARCHAR(64) NOT NULL,
+				target_user_id INTEGER CONSTRAINT admin_audit_log_target_user_id_fkey REFERENCES users (id),
+				details JSONB NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT now()
+			);`,
+			`CREATE INDEX IF NOT EXISTS admin_audit_log_created_at_idx ON admin_audit_log (created_at);`,
+		},
+	},
+	{
+		version: 12,
+		name:    "merchants and api keys",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS merchants (
+				id SERIAL PRIMARY KEY,
+				name VARCHAR(255) NOT NULL CONSTRAINT merchants_name_key UNIQUE,
+				created_at TIMESTAMP NOT NULL
+			);`,
+			//scopes are a comma separated list
+			`CREATE TABLE IF NOT EXISTS api_keys (
+				id SERIAL PRIMARY KEY,
+				merchant_id INTEGER NOT NULL CONSTRAINT api_keys_merchant_id_fkey REFERENCES merchants (id),
+				key_prefix VARCHAR(16) NOT NULL,
+				key_hash VARCHAR(64) NOT NULL CONSTRAINT api_keys_key_hash_key UNIQUE,
+				scopes VARCHAR(255) NOT NULL,
+				rate_limit INTEGER NOT NULL CONSTRAINT api_keys_rate_limit_positive CHECK (rate_limit > 0),
+				created_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS api_keys_merchant_id_idx ON api_keys (merchant_id);`,
+		},
+	},
+	{
+		version: 13,
+		name:    "merchant links of users",
+		queries: []string{
+			//a merchant can act on behalf of a user only after the user links it
+			`CREATE TABLE IF NOT EXISTS merchant_users (
+				merchant_id INTEGER NOT NULL CONSTRAINT merchant_users_merchant_id_fkey REFERENCES merchants (id),
+				user_id INTEGER NOT NULL CONSTRAINT merchant_users_user_id_fkey REFERENCES users (id),
+				linked_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (merchant_id, user_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS merchant_users_user_id_idx ON merchant_users (user_id);`,
+			//a merchant, which made an order or a withdrawal on behalf of a user
+			`ALTER TABLE orders ADD COLUMN IF NOT EXISTS merchant_id INTEGER CONSTRAINT orders_merchant_id_fkey REFERENCES merchants (id);`,
+			`ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS merchant_id INTEGER;`,
+			`ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS merchant_id INTEGER CONSTRAINT withdrawals_merchant_id_fkey REFERENCES merchants (id);`,
+			`ALTER TABLE withdrawals_archive ADD COLUMN IF NOT EXISTS merchant_id INTEGER;`,
+		},
+	},
+	{
+		version: 14,
+		name:    "published outbox events retention",
+		queries: []string{
+			`CREATE INDEX IF NOT EXISTS outbox_events_published_at_idx ON outbox_events (published_at) WHERE published_at IS NOT NULL;`,
+		},
+	},
+}
+
+// SetTables applies all migrations, which were not applied yet.
+func (p *Postgresql) SetTables(ctx context.Context) error {
+	_, err := p.store.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);`)
+	if err != nil {
+		return errors.Join(errors.New("error while setting tables in postgres db"), err)
+	}
+
+	for _, m := range postgresqlMigrations {
+		err = p.applyMigration(ctx, m)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error while applying migration %d (%s)", m.version, m.name), err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Postgresql) applyMigration(ctx context.Context, m migration) error {
+	tx, err := p.store.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID)
+	if err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if m.check != "" {
+		var reason *string
+		if err = tx.QueryRow(ctx, m.check).Scan(&reason); err != nil {
+			return err
+		}
+		if reason != nil {
+			return errors.New(*reason)
+		}
+	}
+	for _, query := range m.queries {
+		if _, err = tx.Exec(ctx, query); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
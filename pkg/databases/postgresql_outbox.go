@@ -0,0 +1,80 @@
+package databases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"yandex_gophermart/pkg/entities"
+)
+
+// insertOutboxEvent saves an event, should be called in the same transaction as a change it describes.
+// Payload should be a pointer (TimeRFC3339 is marshalled with a pointer receiver).
+func insertOutboxEvent(ctx context.Context, db querier, eventType string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cant marshal an event payload, err: %w", err)
+	}
+	_, err = db.Exec(ctx, `
+		INSERT INTO outbox_events (event_type, payload)
+		VALUES ($1, $2)`, eventType, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("cant save an outbox event, err: %w", err)
+	}
+	return nil
+}
+
+// GetUnpublishedEvents returns the oldest events, which were not published yet.
+func (p *Postgresql) GetUnpublishedEvents(ctx context.Context, limit int) (_ []entities.OutboxEvent, err error) {
+	ctx, done := p.withDeadline(ctx, "GetUnpublishedEvents")
+	defer done(&err)
+
+	rows, err := p.store.Query(ctx, `
+		SELECT id, event_type, payload, created_at
+		FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entities.OutboxEvent
+	for rows.Next() {
+		var event entities.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Type, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkEventsPublished marks events as published, so they won`t be returned by GetUnpublishedEvents.
+func (p *Postgresql) MarkEventsPublished(ctx context.Context, ids []int64) (err error) {
+	ctx, done := p.withDeadline(ctx, "MarkEventsPublished")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		UPDATE outbox_events
+		SET published_at = now()
+		WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// DeletePublishedEvents removes events, which were published before olderThan. Unpublished events are kept.
+func (p *Postgresql) DeletePublishedEvents(ctx context.Context, olderThan time.Time) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "DeletePublishedEvents")
+	defer done(&err)
+
+	tag, err := p.store.Exec(ctx, `
+		DELETE FROM outbox_events
+		WHERE published_at < $1`, olderThan)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,117 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// ChangePassword checks a current password of a user and replaces it. All sessions of a user are revoked:
+// refresh tokens are revoked and access tokens issued before now are rejected by IsAccessTokenRevoked.
+func (p *Postgresql) ChangePassword(ctx context.Context, userID int, currentPassword string, newPasswordHash string) (err error) {
+	ctx, done := p.withDeadline(ctx, "ChangePassword")
+	defer done(&err)
+
+	return p.runInTx(ctx, func(tx pgx.Tx) error {
+		var passwordHash, passwordSalt string
+		err := tx.QueryRow(ctx, `
+		SELECT password_hash, password_salt FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&passwordHash, &passwordSalt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrUserNotFound()
+		} else if err != nil {
+			return err
+		}
+
+		ok, _, err := p.hasher.Verify(currentPassword, passwordHash, passwordSalt)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return gophermart_errors.MakeErrWrongLoginOrPassword()
+		}
+
+		return setPasswordTx(ctx, tx, userID, newPasswordHash)
+	})
+}
+
+// CreatePasswordResetToken saves a reset token of a user found by login, older unused tokens of a user stop working.
+// Returns MakeErrUserNotFound() for an unknown login.
+func (p *Postgresql) CreatePasswordResetToken(ctx context.Context, login string, tokenHash string, expiresAt time.Time) (err error) {
+	ctx, done := p.withDeadline(ctx, "CreatePasswordResetToken")
+	defer done(&err)
+
+	return p.runInTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now().Local()
+
+		var userID int
+		err := tx.QueryRow(ctx, `
+		SELECT id FROM users WHERE lower(login) = lower($1)`, login).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrUserNotFound()
+		} else if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+		UPDATE password_reset_tokens SET used_at = $2
+		WHERE user_id = $1 AND used_at IS NULL`, userID, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)`, tokenHash, userID, now, expiresAt.Local())
+		return mapConstraintError(err)
+	})
+}
+
+// ResetPassword uses a reset token once and replaces a password of its user. Sessions are revoked as by ChangePassword.
+// Returns a user id or MakeErrPasswordResetTokenNotValid() for an unknown, used or expired token.
+func (p *Postgresql) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string) (_ int, err error) {
+	ctx, done := p.withDeadline(ctx, "ResetPassword")
+	defer done(&err)
+
+	var userID int
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		now := time.Now().Local()
+
+		err := tx.QueryRow(ctx, `
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		FOR UPDATE`, tokenHash, now).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrPasswordResetTokenNotValid()
+		} else if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+		UPDATE password_reset_tokens SET used_at = $2 WHERE token_hash = $1`, tokenHash, now)
+		if err != nil {
+			return err
+		}
+		return setPasswordTx(ctx, tx, userID, newPasswordHash)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// setPasswordTx replaces a password and revokes all sessions of a user. Token "iat" has seconds only,
+// so tokens_valid_after is truncated to seconds too, otherwise tokens issued right after a change would be rejected.
+func setPasswordTx(ctx context.Context, tx pgx.Tx, userID int, passwordHash string) error {
+	now := time.Now()
+	_, err := tx.Exec(ctx, `
+		UPDATE users SET password_hash = $2, password_salt = '', tokens_valid_after = $3
+		WHERE id = $1`, userID, passwordHash, now.Truncate(time.Second).Local())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID, now.Local())
+	return err
+}
@@ -0,0 +1,133 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const replicaCheckPeriod = time.Second * 3
+
+// ReplicaSettings configures routing of read-only queries to a replica.
+type ReplicaSettings struct {
+	ConnStr string
+	//replica is not used while it lags behind the primary more than MaxLag
+	MaxLag time.Duration
+	//user`s reads go to the primary for this time after his own write
+	PrimaryAfterWrite time.Duration
+}
+
+// querier is implemented by both pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type replica struct {
+	pool              *pgxpool.Pool
+	maxLag            time.Duration
+	primaryAfterWrite time.Duration
+	usable            atomic.Bool
+	lastWrites        sync.Map //userID -> time.Time
+}
+
+// UseReplica connects to a replica, reads will be routed to it while it is usable.
+// Replica state is checked until ctx is done.
+func (p *Postgresql) UseReplica(ctx context.Context, settings ReplicaSettings, poolSettings PoolSettings) error {
+	poolConfig, err := makePoolConfig(settings.ConnStr, poolSettings)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return errors.Join(errors.New("cant connect to a replica"), err)
+	}
+
+	p.replica = &replica{
+		pool:              pool,
+		maxLag:            settings.MaxLag,
+		primaryAfterWrite: settings.PrimaryAfterWrite,
+	}
+	p.replica.check(ctx)
+	go p.replica.monitor(ctx)
+	return nil
+}
+
+// monitor checks replica availability and lag, and forgets old user writes.
+func (r *replica) monitor(ctx context.Context) {
+	ticker := time.NewTicker(replicaCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+			r.lastWrites.Range(func(userID, writtenAt any) bool {
+				if time.Since(writtenAt.(time.Time)) > r.primaryAfterWrite {
+					r.lastWrites.Delete(userID)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (r *replica) check(ctx context.Context) {
+	var lagSeconds float64
+	err := r.pool.QueryRow(ctx, `
+		SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END`).Scan(&lagSeconds)
+	if err != nil {
+		r.usable.Store(false)
+		return
+	}
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	r.usable.Store(r.maxLag <= 0 || lag <= r.maxLag)
+}
+
+// reader returns a replica if user`s read can go there, otherwise nil.
+func (p *Postgresql) reader(userID int) *pgxpool.Pool {
+	if p.replica == nil || !p.replica.usable.Load() {
+		return nil
+	}
+	if writtenAt, ok := p.replica.lastWrites.Load(userID); ok && time.Since(writtenAt.(time.Time)) <= p.replica.primaryAfterWrite {
+		return nil
+	}
+	return p.replica.pool
+}
+
+// markWrite makes user`s next reads go to the primary for a while.
+func (p *Postgresql) markWrite(userID int) {
+	if p.replica != nil {
+		p.replica.lastWrites.Store(userID, time.Now())
+	}
+}
+
+// withReader runs a read-only query on a replica if it is usable. If the replica is unreachable, the query
+// is repeated on the primary.
+func (p *Postgresql) withReader(ctx context.Context, userID int, read func(db querier) error) error {
+	if db := p.reader(userID); db != nil {
+		err := read(db)
+		if err == nil || !isConnectionError(ctx, err) {
+			return err
+		}
+		p.replica.usable.Store(false)
+	}
+	return read(p.store)
+}
+
+// isConnectionError returns true if a query failed not because of a query itself or a cancelled context.
+func isConnectionError(ctx context.Context, err error) bool {
+	var pgErr *pgconn.PgError
+	return ctx.Err() == nil && !errors.As(err, &pgErr) && !errors.Is(err, pgx.ErrNoRows)
+}
@@ -0,0 +1,106 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newTestReplicaStorage makes a storage with a primary and a usable replica. Pools connect lazily, so
+// nothing listens on their addresses, routing is checked by a pool, which a query gets.
+func newTestReplicaStorage(t *testing.T, primaryAfterWrite time.Duration) *Postgresql {
+	t.Helper()
+	newPool := func(db string) *pgxpool.Pool {
+		pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/"+db)
+		require.NoError(t, err, "cant make a pool")
+		t.Cleanup(pool.Close)
+		return pool
+	}
+	p := &Postgresql{
+		store: newPool("primary"),
+		replica: &replica{
+			pool:              newPool("replica"),
+			primaryAfterWrite: primaryAfterWrite,
+		},
+	}
+	p.replica.usable.Store(true)
+	return p
+}
+
+func TestPostgresql_ReaderRouting(t *testing.T) {
+	p := newTestReplicaStorage(t, time.Minute)
+	assert.Same(t, p.replica.pool, p.reader(1), "read doesn`t go to a replica")
+
+	p.replica.usable.Store(false)
+	assert.Nil(t, p.reader(1), "read goes to an unusable replica")
+	p.replica.usable.Store(true)
+
+	without := &Postgresql{store: p.store}
+	assert.Nil(t, without.reader(1), "read goes to a replica, which isn`t set")
+	//a write without a replica is ignored
+	without.markWrite(1)
+	assert.Nil(t, without.reader(1), "read goes to a replica, which isn`t set")
+}
+
+func TestPostgresql_ReaderAfterWrite(t *testing.T) {
+	p := newTestReplicaStorage(t, time.Millisecond*50)
+
+	p.markWrite(1)
+	assert.Nil(t, p.reader(1), "read after a write goes to a replica")
+	assert.Same(t, p.replica.pool, p.reader(2), "write of one user changes reads of another")
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Same(t, p.replica.pool, p.reader(1), "reads stick to the primary after primaryAfterWrite")
+}
+
+func TestPostgresql_WithReader(t *testing.T) {
+	queryErr := &pgconn.PgError{Code: "42P01", Message: "relation doesn`t exist"}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		replicaErr error
+		wantErr    error
+		wantPools  []string
+		wantUsable bool
+		afterWrite bool
+	}{
+		{name: "replica answers", ctx: context.Background(), wantPools: []string{"replica"}, wantUsable: true},
+		{name: "replica is down", ctx: context.Background(), replicaErr: errors.New("connection refused"), wantPools: []string{"replica", "primary"}},
+		{name: "query error", ctx: context.Background(), replicaErr: queryErr, wantErr: queryErr, wantPools: []string{"replica"}, wantUsable: true},
+		{name: "cancelled context", ctx: cancelled, replicaErr: context.Canceled, wantErr: context.Canceled, wantPools: []string{"replica"}, wantUsable: true},
+		{name: "read after a write", ctx: context.Background(), afterWrite: true, wantPools: []string{"primary"}, wantUsable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestReplicaStorage(t, time.Minute)
+			if tt.afterWrite {
+				p.markWrite(1)
+			}
+
+			var pools []string
+			err := p.withReader(tt.ctx, 1, func(db querier) error {
+				if db == querier(p.replica.pool) {
+					pools = append(pools, "replica")
+					return tt.replicaErr
+				}
+				pools = append(pools, "primary")
+				return nil
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "wrong error")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+			assert.Equal(t, tt.wantPools, pools, "wrong query routing")
+			assert.Equal(t, tt.wantUsable, p.replica.usable.Load(), "wrong replica state")
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// QueryTimeouts limit storage calls, so a slow query can`t block a caller with a long-lived context.
+// Zero duration means "no limit".
+type QueryTimeouts struct {
+	Default time.Duration
+	//method name (like "GetOrdersList") -> timeout
+	PerMethod map[string]time.Duration
+}
+
+func (t QueryTimeouts) forMethod(method string) time.Duration {
+	if timeout, ok := t.PerMethod[method]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// SetQueryTimeouts changes deadlines of storage calls.
+func (p *Postgresql) SetQueryTimeouts(timeouts QueryTimeouts) {
+	p.timeouts = timeouts
+}
+
+// withDeadline limits a storage call with a method timeout. The returned func should be deferred with
+// a pointer to the call error, it releases the deadline and turns its expiration into a typed error.
+func (p *Postgresql) withDeadline(ctx context.Context, method string) (context.Context, func(err *error)) {
+	timeout := p.timeouts.forMethod(method)
+	if timeout <= 0 {
+		return ctx, func(*error) {}
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, gophermart_errors.MakeErrQueryTimeout())
+	return ctx, func(err *error) {
+		//the cause is set only if this deadline expired, not a caller`s one
+		if *err != nil && errors.Is(context.Cause(ctx), gophermart_errors.MakeErrQueryTimeout()) {
+			*err = errors.Join(fmt.Errorf("%w (%s, %v)", gophermart_errors.MakeErrQueryTimeout(), method, timeout), *err)
+		}
+		cancel()
+	}
+}
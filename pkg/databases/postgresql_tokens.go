@@ -0,0 +1,144 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// SaveRefreshToken saves the first token of a new family.
+func (p *Postgresql) SaveRefreshToken(ctx context.Context, token entities.RefreshToken) (err error) {
+	ctx, done := p.withDeadline(ctx, "SaveRefreshToken")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		token.Hash, token.FamilyID, token.UserID, token.CreatedAt.Local(), token.ExpiresAt.Local())
+	return mapConstraintError(err)
+}
+
+// RotateRefreshToken marks a token as used and saves a new one of the same family and user.
+// Returns a user id. If a token was already used, the whole family is revoked and MakeErrRefreshTokenReused() is returned.
+func (p *Postgresql) RotateRefreshToken(ctx context.Context, oldHash string, newToken entities.RefreshToken) (_ int, err error) {
+	ctx, done := p.withDeadline(ctx, "RotateRefreshToken")
+	defer done(&err)
+
+	var userID int
+	var reused bool
+	err = p.runInTx(ctx, func(tx pgx.Tx) error {
+		reused = false
+		now := time.Now().Local()
+
+		var familyID string
+		var expired, used, revoked bool
+		err := tx.QueryRow(ctx, `
+		SELECT family_id, user_id, expires_at <= $2, used_at IS NOT NULL, revoked_at IS NOT NULL
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`, oldHash, now).Scan(&familyID, &userID, &expired, &used, &revoked)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return gophermart_errors.MakeErrRefreshTokenNotFound()
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case revoked:
+			//a family was revoked by a logout or a reuse before
+			return gophermart_errors.MakeErrRefreshTokenExpired()
+		case used:
+			//the revocation is committed, so an error is returned after the transaction
+			reused = true
+			_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE family_id = $2 AND revoked_at IS NULL`, now, familyID)
+			return err
+		case expired:
+			return gophermart_errors.MakeErrRefreshTokenExpired()
+		}
+
+		_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2`, now, oldHash)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+			newToken.Hash, familyID, userID, newToken.CreatedAt.Local(), newToken.ExpiresAt.Local())
+		return mapConstraintError(err)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if reused {
+		return 0, gophermart_errors.MakeErrRefreshTokenReused()
+	}
+	return userID, nil
+}
+
+// RevokeRefreshTokenFamily revokes a token and all tokens of its family. An unknown token is ignored.
+func (p *Postgresql) RevokeRefreshTokenFamily(ctx context.Context, hash string) (err error) {
+	ctx, done := p.withDeadline(ctx, "RevokeRefreshTokenFamily")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $2
+		WHERE revoked_at IS NULL AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)`,
+		hash, time.Now().Local())
+	return err
+}
+
+// RevokeAccessToken adds a token id to the denylist until the token expires.
+func (p *Postgresql) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) (err error) {
+	ctx, done := p.withDeadline(ctx, "RevokeAccessToken")
+	defer done(&err)
+
+	_, err = p.store.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, tokenID, expiresAt.Local())
+	return err
+}
+
+// IsAccessTokenRevoked checks the denylist and whether a token was issued before the last password change of its user.
+func (p *Postgresql) IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (_ bool, err error) {
+	ctx, done := p.withDeadline(ctx, "IsAccessTokenRevoked")
+	defer done(&err)
+
+	var revoked bool
+	err = p.store.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM users WHERE id = $2 AND tokens_valid_after > $3)`,
+		claims.ID, claims.UserID, claims.IssuedAt.Local()).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpiredTokens removes expired refresh tokens, password reset tokens and denylist entries of expired access tokens.
+func (p *Postgresql) DeleteExpiredTokens(ctx context.Context) (_ int64, err error) {
+	ctx, done := p.withDeadline(ctx, "DeleteExpiredTokens")
+	defer done(&err)
+
+	now := time.Now().Local()
+	refreshTag, err := p.store.Exec(ctx, `
+		DELETE FROM refresh_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	revokedTag, err := p.store.Exec(ctx, `
+		DELETE FROM revoked_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	resetTag, err := p.store.Exec(ctx, `
+		DELETE FROM password_reset_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return refreshTag.RowsAffected() + revokedTag.RowsAffected() + resetTag.RowsAffected(), nil
+}
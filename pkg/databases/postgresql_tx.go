@@ -0,0 +1,121 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"math/rand/v2"
+	"time"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// TxSettings configure transactions, which change balances and orders.
+type TxSettings struct {
+	//"serializable", "repeatable_read" or "read_committed"
+	Isolation string
+	//how many times a transaction is repeated after a serialization failure or a deadlock
+	MaxRetries int
+	//delay before the first retry, it is doubled on every next retry
+	RetryDelay time.Duration
+}
+
+var defaultTxSettings = TxSettings{
+	Isolation:  "serializable",
+	MaxRetries: 5,
+	RetryDelay: time.Millisecond * 10,
+}
+
+type postgresqlTx struct {
+	options    pgx.TxOptions
+	maxRetries int
+	retryDelay time.Duration
+}
+
+func makePostgresqlTx(settings TxSettings) (postgresqlTx, error) {
+	var isoLevel pgx.TxIsoLevel
+	switch settings.Isolation {
+	case "serializable":
+		isoLevel = pgx.Serializable
+	case "repeatable_read":
+		isoLevel = pgx.RepeatableRead
+	case "read_committed":
+		isoLevel = pgx.ReadCommitted
+	default:
+		return postgresqlTx{}, fmt.Errorf("unknown transaction isolation level `%s`", settings.Isolation)
+	}
+	return postgresqlTx{
+		options:    pgx.TxOptions{IsoLevel: isoLevel},
+		maxRetries: settings.MaxRetries,
+		retryDelay: settings.RetryDelay,
+	}, nil
+}
+
+// SetTxSettings changes settings of balance-changing transactions.
+func (p *Postgresql) SetTxSettings(settings TxSettings) error {
+	tx, err := makePostgresqlTx(settings)
+	if err != nil {
+		return err
+	}
+	p.tx = tx
+	return nil
+}
+
+// txBeginner is implemented by pgxpool.Pool, a transaction is started on it.
+type txBeginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// runInTx runs fn in a transaction and commits it. The whole transaction is repeated with a backoff
+// if it fails because of a serialization failure or a deadlock, so fn should have no side effects
+// outside the transaction.
+func (p *Postgresql) runInTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return p.tx.run(ctx, p.store, fn)
+}
+
+func (t postgresqlTx) run(ctx context.Context, db txBeginner, fn func(tx pgx.Tx) error) error {
+	delay := t.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := t.try(ctx, db, fn)
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+		if attempt >= t.maxRetries {
+			return errors.Join(gophermart_errors.MakeErrTxRetriesExhausted(), err)
+		}
+
+		//jitter spreads retries of concurrent transactions
+		wait := delay + time.Duration(rand.Int64N(int64(delay)+1))
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+func (t postgresqlTx) try(ctx context.Context, db txBeginner, fn func(tx pgx.Tx) error) error {
+	tx, err := db.BeginTx(ctx, t.options)
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction, err: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error while committing transaction, %w", err)
+	}
+	return nil
+}
+
+// isRetryableTxError returns true for serialization failures (40001) and deadlocks (40P01).
+func isRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
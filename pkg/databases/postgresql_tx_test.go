@@ -0,0 +1,111 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// testTx is a transaction, which only counts commits and rollbacks
+type testTx struct {
+	pgx.Tx
+	db *testTxBeginner
+}
+
+func (tx *testTx) Commit(ctx context.Context) error {
+	tx.db.commits++
+	return tx.db.commitErr
+}
+
+func (tx *testTx) Rollback(ctx context.Context) error {
+	tx.db.rollbacks++
+	return nil
+}
+
+type testTxBeginner struct {
+	beginErr  error
+	commitErr error
+	begins    int
+	commits   int
+	rollbacks int
+}
+
+func (db *testTxBeginner) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	db.begins++
+	if db.beginErr != nil {
+		return nil, db.beginErr
+	}
+	return &testTx{db: db}, nil
+}
+
+func TestPostgresqlTx_Run(t *testing.T) {
+	serializationErr := &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+	deadlockErr := &pgconn.PgError{Code: "40P01", Message: "deadlock detected"}
+	uniqueErr := &pgconn.PgError{Code: "23505", Message: "duplicate key value"}
+	otherErr := errors.New("some test error")
+
+	tests := []struct {
+		name          string
+		db            *testTxBeginner
+		errs          []error //errors of fn on attempts, the last one repeats
+		wantAttempts  int
+		wantCommits   int
+		wantErr       error
+		wantExhausted bool
+	}{
+		{name: "success", db: &testTxBeginner{}, errs: []error{nil}, wantAttempts: 1, wantCommits: 1},
+		{name: "serialization failure is retried", db: &testTxBeginner{}, errs: []error{serializationErr, serializationErr, nil}, wantAttempts: 3, wantCommits: 1},
+		{name: "deadlock is retried", db: &testTxBeginner{}, errs: []error{deadlockErr, nil}, wantAttempts: 2, wantCommits: 1},
+		{name: "retries are exhausted", db: &testTxBeginner{}, errs: []error{deadlockErr}, wantAttempts: 4, wantErr: deadlockErr, wantExhausted: true},
+		{name: "failed commit is retried", db: &testTxBeginner{commitErr: serializationErr}, errs: []error{nil}, wantAttempts: 4, wantCommits: 4, wantErr: serializationErr, wantExhausted: true},
+		{name: "constraint error isn`t retried", db: &testTxBeginner{}, errs: []error{uniqueErr}, wantAttempts: 1, wantErr: uniqueErr},
+		{name: "other error isn`t retried", db: &testTxBeginner{}, errs: []error{otherErr}, wantAttempts: 1, wantErr: otherErr},
+		{name: "begin error isn`t retried", db: &testTxBeginner{beginErr: otherErr}, errs: []error{nil}, wantAttempts: 0, wantErr: otherErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := makePostgresqlTx(TxSettings{Isolation: "serializable", MaxRetries: 3, RetryDelay: time.Millisecond})
+			require.NoError(t, err, "cant make tx settings")
+
+			attempts := 0
+			err = tx.run(context.Background(), tt.db, func(tx pgx.Tx) error {
+				err := tt.errs[min(attempts, len(tt.errs)-1)]
+				attempts++
+				return err
+			})
+			assert.Equal(t, tt.wantAttempts, attempts, "wrong amount of attempts")
+			assert.Equal(t, tt.wantCommits, tt.db.commits, "wrong amount of commits")
+			assert.Equal(t, attempts, tt.db.rollbacks, "transaction isn`t rolled back")
+			if tt.wantErr == nil {
+				assert.NoError(t, err, "unexpected error")
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr, "cause is lost")
+			assert.Equal(t, tt.wantExhausted, errors.Is(err, gophermart_errors.MakeErrTxRetriesExhausted()), "wrong retries exhausted error")
+		})
+	}
+}
+
+func TestPostgresqlTx_RunStopsOnDoneContext(t *testing.T) {
+	tx, err := makePostgresqlTx(TxSettings{Isolation: "serializable", MaxRetries: 3, RetryDelay: time.Hour})
+	require.NoError(t, err, "cant make tx settings")
+	ctx, cancel := context.WithCancel(context.Background())
+	serializationErr := &pgconn.PgError{Code: "40001"}
+
+	attempts := 0
+	err = tx.run(ctx, &testTxBeginner{}, func(tx pgx.Tx) error {
+		attempts++
+		cancel()
+		return serializationErr
+	})
+	assert.Equal(t, 1, attempts, "transaction is retried after a context is done")
+	assert.ErrorIs(t, err, context.Canceled, "context error is lost")
+	assert.ErrorIs(t, err, serializationErr, "cause is lost")
+	assert.NotErrorIs(t, err, gophermart_errors.MakeErrTxRetriesExhausted(), "cancelled transaction is reported as exhausted retries")
+}
@@ -0,0 +1,1714 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/url"
+	"strings"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+	"yandex_gophermart/pkg/security"
+)
+
+// SQLiteScheme is a DATABASE_URI scheme, which selects the SQLite storage ("sqlite:///path/to/file.db").
+const SQLiteScheme = "sqlite"
+
+// SQLite is a storage for small deployments and demos. It has the same schema semantics as Postgresql.
+// All timestamps are stored in UTC.
+type SQLite struct {
+	store  *sql.DB
+	hasher *security.PasswordHasher
+	logger *zap.SugaredLogger
+}
+
+func NewSQLite(ctx context.Context, uri string) (*SQLite, error) {
+	dsn, err := makeSQLiteDSN(uri)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, errors.Join(errors.New("cant create a new sqlite storage"), err)
+	}
+	//sqlite allows only one writer, so all transactions go one by one
+	db.SetMaxOpenConns(1)
+	hasher, err := security.NewPasswordHasher(security.DefaultPasswordHashSettings)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLite{
+		store:  db,
+		hasher: hasher,
+		logger: zap.NewNop().Sugar(),
+	}, nil
+}
+
+// makeSQLiteDSN turns "sqlite:///path/to/file.db?params" into a driver DSN with required pragmas.
+func makeSQLiteDSN(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", errors.Join(errors.New("cant parse sqlite uri"), err)
+	}
+	path := parsed.Host + parsed.Path
+	if path == "" {
+		path = parsed.Opaque
+	}
+	if path == "" {
+		return "", errors.New("sqlite uri has no file path")
+	}
+
+	query := parsed.Query()
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Set("_time_format", "sqlite")
+	query.Set("_txlock", "immediate")
+	return "file:" + path + "?" + query.Encode(), nil
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.store.PingContext(ctx)
+}
+
+func (s *SQLite) Close() {
+	s.store.Close()
+}
+
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "initial tables",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				login TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				password_salt TEXT NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS orders (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				order_number TEXT NOT NULL UNIQUE,
+				status TEXT NOT NULL,
+				accural REAL NOT NULL,
+				uploaded_at TIMESTAMP NOT NULL,
+				CONSTRAINT orders_accrual_non_negative CHECK (accural >= 0),
+				CONSTRAINT orders_status_known CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED'))
+			);`,
+			`CREATE TABLE IF NOT EXISTS balances (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL UNIQUE REFERENCES users (id),
+				points REAL NOT NULL DEFAULT 0,
+				CONSTRAINT balances_points_non_negative CHECK (points >= 0)
+			);`,
+			`CREATE TABLE IF NOT EXISTS withdrawals (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				order_num TEXT NOT NULL UNIQUE,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				amount REAL NOT NULL,
+				processed_at TIMESTAMP NOT NULL,
+				CONSTRAINT withdrawals_amount_positive CHECK (amount > 0)
+			);`,
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				idem_key TEXT NOT NULL,
+				fingerprint TEXT NOT NULL,
+				status_code INTEGER,
+				content_type TEXT,
+				response_body BLOB,
+				created_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (user_id, idem_key)
+			);`,
+			`CREATE TABLE IF NOT EXISTS outbox_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				event_type TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				published_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS orders_unfinished_idx ON orders (id) WHERE status IN ('NEW', 'PROCESSING');`,
+			`CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);`,
+			`CREATE INDEX IF NOT EXISTS outbox_events_unpublished_idx ON outbox_events (id) WHERE published_at IS NULL;`,
+		},
+	},
+	{
+		version: 2,
+		name:    "order processing time",
+		queries: []string{
+			`ALTER TABLE orders ADD COLUMN processed_at TIMESTAMP;`,
+			`UPDATE orders SET processed_at = uploaded_at WHERE status = 'PROCESSED' AND processed_at IS NULL;`,
+			`CREATE INDEX IF NOT EXISTS orders_user_id_processed_at_idx ON orders (user_id, processed_at) WHERE status = 'PROCESSED';`,
+		},
+	},
+	{
+		version: 3,
+		name:    "archive tables",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS orders_archive (
+				id INTEGER PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				order_number TEXT NOT NULL UNIQUE,
+				status TEXT NOT NULL,
+				accural REAL NOT NULL,
+				uploaded_at TIMESTAMP NOT NULL,
+				processed_at TIMESTAMP,
+				archived_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS withdrawals_archive (
+				id INTEGER PRIMARY KEY,
+				order_num TEXT NOT NULL UNIQUE,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				amount REAL NOT NULL,
+				processed_at TIMESTAMP NOT NULL,
+				archived_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS orders_archive_user_id_uploaded_at_idx ON orders_archive (user_id, uploaded_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS orders_archive_user_id_processed_at_idx ON orders_archive (user_id, processed_at) WHERE status = 'PROCESSED';`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_archive_user_id_processed_at_idx ON withdrawals_archive (user_id, processed_at DESC, id DESC);`,
+			`CREATE INDEX IF NOT EXISTS orders_finished_uploaded_at_idx ON orders (uploaded_at) WHERE status IN ('PROCESSED', 'INVALID');`,
+			`CREATE INDEX IF NOT EXISTS withdrawals_processed_at_idx ON withdrawals (processed_at);`,
+		},
+	},
+	{
+		version: 4,
+		name:    "materialized withdrawn total",
+		queries: []string{
+			`ALTER TABLE balances ADD COLUMN withdrawn REAL NOT NULL DEFAULT 0
+				CONSTRAINT balances_withdrawn_non_negative CHECK (withdrawn >= 0);`,
+			`UPDATE balances SET withdrawn = COALESCE((SELECT SUM(amount)
+				FROM (SELECT user_id, amount FROM withdrawals UNION ALL SELECT user_id, amount FROM withdrawals_archive) AS w
+				WHERE w.user_id = balances.user_id), 0);`,
+		},
+	},
+	{
+		version: 5,
+		name:    "refresh tokens and revoked access tokens",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				token_hash TEXT NOT NULL UNIQUE,
+				family_id TEXT NOT NULL,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP,
+				revoked_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);`,
+			`CREATE TABLE IF NOT EXISTS revoked_tokens (
+				jti TEXT PRIMARY KEY,
+				expires_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);`,
+		},
+	},
+	{
+		version: 6,
+		name:    "failed login attempts",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS login_attempts (
+				attempt_key TEXT PRIMARY KEY,
+				failures INTEGER NOT NULL,
+				last_failure_at TIMESTAMP NOT NULL,
+				locked_until TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);`,
+		},
+	},
+	{
+		version: 7,
+		name:    "case-insensitive unique logins",
+		//logins, which differ in case only, should be renamed by hand first
+		check: `
+			SELECT 'logins differ in case only, rename them before the migration: ' || group_concat(logins, '; ')
+			FROM (
+				SELECT group_concat(login, ', ') AS logins
+				FROM (SELECT login FROM users ORDER BY id) GROUP BY lower(login) HAVING count(*) > 1
+			)`,
+		queries: []string{
+			`CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_key ON users (lower(login));`,
+		},
+	},
+	{
+		version: 8,
+		name:    "password changes and reset tokens",
+		queries: []string{
+			`ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMP;`,
+			`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				token_hash TEXT NOT NULL UNIQUE,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);`,
+			`CREATE INDEX IF NOT EXISTS password_reset_tokens_expires_at_idx ON password_reset_tokens (expires_at);`,
+			`CREATE INDEX IF NOT EXISTS refresh_tokens_user_id_idx ON refresh_tokens (user_id);`,
+		},
+	},
+	{
+		version: 9,
+		name:    "user roles and admin actions",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS user_roles (
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				role TEXT NOT NULL,
+				PRIMARY KEY (user_id, role)
+			);`,
+			`CREATE TABLE IF NOT EXISTS balance_adjustments (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				admin_id INTEGER NOT NULL REFERENCES users (id),
+				amount REAL NOT NULL,
+				reason TEXT NOT NULL,
+				processed_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS balance_adjustments_user_id_processed_at_idx ON balance_adjustments (user_id, processed_at);`,
+			`CREATE TABLE IF NOT EXISTS admin_audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				admin_id INTEGER NOT NULL REFERENCES users (id),
+				action TEXT NOT NULL,
+				target_user_id INTEGER REFERENCES users (id),
+				details TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS admin_audit_log_created_at_idx ON admin_audit_log (created_at);`,
+		},
+	},
+	{
+		version: 10,
+		name:    "merchants and api keys",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS merchants (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE,
+				created_at TIMESTAMP NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS api_keys (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				merchant_id INTEGER NOT NULL REFERENCES merchants (id),
+				key_prefix TEXT NOT NULL,
+				key_hash TEXT NOT NULL UNIQUE,
+				scopes TEXT NOT NULL,
+				rate_limit INTEGER NOT NULL CONSTRAINT api_keys_rate_limit_positive CHECK (rate_limit > 0),
+				created_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP
+			);`,
+			`CREATE INDEX IF NOT EXISTS api_keys_merchant_id_idx ON api_keys (merchant_id);`,
+		},
+	},
+	{
+		version: 11,
+		name:    "merchant links of users",
+		queries: []string{
+			`CREATE TABLE IF NOT EXISTS merchant_users (
+				merchant_id INTEGER NOT NULL REFERENCES merchants (id),
+				user_id INTEGER NOT NULL REFERENCES users (id),
+				linked_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (merchant_id, user_id)
+			);`,
+			`CREATE INDEX IF NOT EXISTS merchant_users_user_id_idx ON merchant_users (user_id);`,
+			`ALTER TABLE orders ADD COLUMN merchant_id INTEGER REFERENCES merchants (id);`,
+			`ALTER TABLE orders_archive ADD COLUMN merchant_id INTEGER;`,
+			`ALTER TABLE withdrawals ADD COLUMN merchant_id INTEGER REFERENCES merchants (id);`,
+			`ALTER TABLE withdrawals_archive ADD COLUMN merchant_id INTEGER;`,
+		},
+	},
+	{
+		version: 12,
+		name:    "published outbox events retention",
+		queries: []string{
+			`CREATE INDEX IF NOT EXISTS outbox_events_published_at_idx ON outbox_events (published_at) WHERE published_at IS NOT NULL;`,
+		},
+	},
+}
+
+// SetTables applies all migrations, which were not applied yet.
+func (s *SQLite) SetTables(ctx context.Context) error {
+	_, err := s.store.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		);`)
+	if err != nil {
+		return errors.Join(errors.New("error while setting tables in sqlite db"), err)
+	}
+
+	for _, m := range sqliteMigrations {
+		err = s.applyMigration(ctx, m)
+		if err != nil {
+			return errors.Join(fmt.Errorf("error while applying migration %d (%s)", m.version, m.name), err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLite) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?1)`, m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if m.check != "" {
+		var reason sql.NullString
+		if err = tx.QueryRowContext(ctx, m.check).Scan(&reason); err != nil {
+			return err
+		}
+		if reason.Valid {
+			return errors.New(reason.String)
+		}
+	}
+	for _, query := range m.queries {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO schema_migrations (version, name, applied_at) VALUES (?1, ?2, ?3)`, m.version, m.name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLite) SaveUser(ctx context.Context, login string, passwordHash string, passwordSalt string) (int, error) {
+	var userID int
+
+	err := s.store.QueryRowContext(ctx, `
+		INSERT INTO users (login, password_hash, password_salt)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT DO NOTHING
+		RETURNING id;`,
+		login, passwordHash, passwordSalt).Scan(&userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, gophermart_errors.MakeErrUserAlreadyExists()
+	} else if err != nil {
+		return 0, mapSQLiteConstraintError(err)
+	}
+
+	return userID, nil
+}
+
+// SetPasswordHasher changes a hasher, which checks passwords and rehashes outdated hashes.
+func (s *SQLite) SetPasswordHasher(hasher *security.PasswordHasher) {
+	s.hasher = hasher
+}
+
+// SetLogger sets a logger for errors, which don`t fail a call (a failed password rehash for example).
+func (s *SQLite) SetLogger(logger *zap.SugaredLogger) {
+	s.logger = logger
+}
+
+// GetUserIDWithCheck finds a user by login (case-insensitive) and checks a password against its hash.
+// Returns an ID if a password is correct, "0" + "error" if not. Legacy or outdated hashes are replaced with new ones.
+func (s *SQLite) GetUserIDWithCheck(ctx context.Context, login string, password string) (int, error) {
+	var userID int
+	var passwordHash, passwordSalt string
+
+	err := s.store.QueryRowContext(ctx, `
+		SELECT id, password_hash, password_salt
+		FROM users
+		WHERE lower(login) = lower(?1)`, login).Scan(&userID, &passwordHash, &passwordSalt)
+	if errors.Is(err, sql.ErrNoRows) {
+		//a password is checked anyway, so an unknown login isn`t answered faster than a known one
+		s.hasher.VerifyDummy(password)
+		return 0, gophermart_errors.MakeErrWrongLoginOrPassword()
+	} else if err != nil {
+		return 0, err
+	}
+
+	ok, needsRehash, err := s.hasher.Verify(password, passwordHash, passwordSalt)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, gophermart_errors.MakeErrWrongLoginOrPassword()
+	}
+
+	if needsRehash {
+		//a user is checked anyway, so a failed rehash doesn`t fail a login. A password may be too long
+		//for a new algorithm (bcrypt takes 72 bytes), then an old hash is kept
+		newHash, err := s.hasher.Hash(password)
+		if err == nil {
+			_, err = s.store.ExecContext(ctx, `
+			UPDATE users SET password_hash = ?1, password_salt = ''
+			WHERE id = ?2 AND password_hash = ?3`,
+				newHash, userID, passwordHash)
+			if err != nil {
+				s.logger.Warnf("cant rehash a password of user %d, an old hash is kept, err: %v", userID, err)
+			}
+		}
+	}
+
+	return userID, nil
+}
+
+// insertSQLiteOutboxEvent saves an event, should be called in the same transaction as a change it describes.
+func insertSQLiteOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, payload any) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cant marshal an event payload, err: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox_events (event_type, payload, created_at)
+		VALUES (?1, ?2, ?3)`, eventType, string(payloadJSON), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("cant save an outbox event, err: %w", err)
+	}
+	return nil
+}
+
+// SaveNewOrder saves an order and an "order.uploaded" event.
+func (s *SQLite) SaveNewOrder(ctx context.Context, orderData entities.OrderData) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction, err: %w", err)
+	}
+	defer tx.Rollback()
+
+	//check who uploaded this order first (conflict), order numbers are unique with archived ones too
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM orders WHERE order_number = ?1
+		UNION ALL
+		SELECT user_id FROM orders_archive WHERE order_number = ?1
+		LIMIT 1`,
+		orderData.Number).Scan(&userID)
+	if err == nil {
+		if userID == orderData.UserID {
+			return gophermart_errors.MakeErrUserHasAlreadyUploadedThisOrder()
+		}
+		return gophermart_errors.MakeErrThisOrderWasUploadedByDifferentUser()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO orders (user_id, order_number, status, accural, uploaded_at, merchant_id)
+		VALUES (?1, ?2, ?3, ?4, ?5, NULLIF(?6, 0))`,
+		orderData.UserID, orderData.Number, orderData.Status, orderData.Accrual, orderData.UploadedAt.Time.UTC(), orderData.MerchantID)
+	if err != nil {
+		return mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "orders", column: "user_id", parent: "users", id: orderData.UserID},
+			sqliteReference{table: "orders", column: "merchant_id", parent: "merchants", id: orderData.MerchantID})
+	}
+
+	err = insertSQLiteOutboxEvent(ctx, tx, entities.EventOrderUploaded, &entities.OrderEventPayload{
+		UserID:     orderData.UserID,
+		Number:     orderData.Number,
+		Status:     orderData.Status,
+		Accrual:    orderData.Accrual,
+		UploadedAt: orderData.UploadedAt,
+		MerchantID: orderData.MerchantID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateOrder updates an order and increases users`s balance if order status becomes "PROCESSED".
+// An event is saved if order status was changed.
+func (s *SQLite) UpdateOrder(ctx context.Context, orderData entities.OrderData) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cant begin a transaction, err: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status
+		FROM orders
+		WHERE id = ?1 AND user_id = ?2`,
+		orderData.ID, orderData.UserID).Scan(&oldStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gophermart_errors.MakeErrOrderNotFound()
+	} else if err != nil {
+		return fmt.Errorf("cant get an order to update, err: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders
+		SET status = ?1, accural = ?2, uploaded_at = ?3
+		WHERE id = ?4 AND user_id = ?5`,
+		orderData.Status, orderData.Accrual, orderData.UploadedAt.Time.UTC(), orderData.ID, orderData.UserID)
+	if err != nil {
+		return fmt.Errorf("error while updating an order: %w", mapSQLiteConstraintError(err))
+	}
+
+	if orderData.Status == entities.OrderStatusProcessed && oldStatus != entities.OrderStatusProcessed {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO balances (user_id, points)
+		VALUES (?1, ?2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET points = balances.points + ?2`,
+			orderData.UserID, orderData.Accrual)
+		if err != nil {
+			return fmt.Errorf("cant increase users balance, err: %w", mapSQLiteReferenceError(ctx, tx, err,
+				sqliteReference{table: "balances", column: "user_id", parent: "users", id: orderData.UserID}))
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE orders
+		SET processed_at = ?1
+		WHERE id = ?2`, time.Now().UTC(), orderData.ID)
+		if err != nil {
+			return fmt.Errorf("cant set order processing time, err: %w", err)
+		}
+	}
+
+	if eventType := entities.OrderStatusEvent(orderData.Status); eventType != "" && orderData.Status != oldStatus {
+		err = insertSQLiteOutboxEvent(ctx, tx, eventType, &entities.OrderEventPayload{
+			UserID:     orderData.UserID,
+			Number:     orderData.Number,
+			Status:     orderData.Status,
+			Accrual:    orderData.Accrual,
+			UploadedAt: orderData.UploadedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error while committing transaction, %w", err)
+	}
+	return nil
+}
+
+// GetOrdersList returns user`s orders, newest first, restricted by a filter.
+func (s *SQLite) GetOrdersList(ctx context.Context, userID int, filter entities.ListFilter) ([]entities.OrderData, error) {
+	conditions, args := buildListConditions(sqliteDialect, filter, "uploaded_at", "status", userID)
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT id, user_id, order_number, status, accural, uploaded_at
+		FROM `+buildListSource("orders", "id, user_id, order_number, status, accural, uploaded_at", filter)+`
+		WHERE `+conditions+`
+		ORDER BY uploaded_at DESC, id DESC`+buildLimit(filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []entities.OrderData
+	for rows.Next() {
+		var order entities.OrderData
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &order.UploadedAt.Time); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLite) GetUnfinishedOrdersList(ctx context.Context) ([]entities.OrderData, error) {
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT id, user_id, order_number, status, accural, uploaded_at
+		FROM orders
+		WHERE status IN ('NEW', 'PROCESSING')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []entities.OrderData
+	for rows.Next() {
+		var order entities.OrderData
+		err := rows.Scan(&order.ID, &order.UserID, &order.Number, &order.Status, &order.Accrual, &order.UploadedAt.Time)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLite) GetBalance(ctx context.Context, userID int) (entities.BalanceData, error) {
+	var balance entities.BalanceData
+
+	err := s.store.QueryRowContext(ctx, `
+		SELECT id, user_id, points, withdrawn
+		FROM balances
+		WHERE user_id = ?1`, userID).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+	if errors.Is(err, sql.ErrNoRows) {
+		//nothing was accrued yet
+		return entities.BalanceData{UserID: userID}, nil
+	} else if err != nil {
+		return balance, err
+	}
+
+	return balance, nil
+}
+
+func (s *SQLite) AddToBalance(ctx context.Context, userID int, amount float64) error {
+	_, err := s.store.ExecContext(ctx, `
+		INSERT INTO balances (user_id, points)
+		VALUES (?1, ?2)
+		ON CONFLICT (user_id)
+		DO UPDATE SET points = balances.points + ?2`,
+		userID, amount)
+	return mapSQLiteReferenceError(ctx, s.store, err,
+		sqliteReference{table: "balances", column: "user_id", parent: "users", id: userID})
+}
+
+// WithdrawFromBalance is atomic, because sqlite transactions are started with an exclusive write lock,
+// so they are serializable and never need a retry. A user without a balance has 0 points.
+// merchantID is 0 if a user withdraws points on their own.
+func (s *SQLite) WithdrawFromBalance(ctx context.Context, userID int, orderNum string, amount float64, merchantID int) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//a repeated order is a conflict even if there are not enough points for it now,
+	//order numbers are unique with archived withdrawals too
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM withdrawals WHERE order_num = ?1)
+			OR EXISTS (SELECT 1 FROM withdrawals_archive WHERE order_num = ?1)`, orderNum).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("cant check withdrawals, err: %w", err)
+	}
+	if exists {
+		return gophermart_errors.MakeErrWithdrawalAlreadyExists()
+	}
+
+	// Check balance
+	var currentBalance float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT points
+		FROM balances
+		WHERE user_id = ?1`, userID).Scan(&currentBalance)
+	if errors.Is(err, sql.ErrNoRows) {
+		currentBalance = 0
+	} else if err != nil {
+		return fmt.Errorf("cant get balance to check, err: %w", err)
+	}
+
+	if currentBalance < amount {
+		return gophermart_errors.MakeErrNotEnoughPoints()
+	}
+
+	// Withdraw
+	_, err = tx.ExecContext(ctx, `
+		UPDATE balances
+		SET points = points - ?1, withdrawn = withdrawn + ?1
+		WHERE user_id = ?2`, amount, userID)
+	if err != nil {
+		return fmt.Errorf("cant withdraw from balance in db, err: %w", mapSQLiteConstraintError(err))
+	}
+
+	// Add new withdrawal
+	processedAt := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO withdrawals (order_num, user_id, amount, processed_at, merchant_id)
+		VALUES (?1, ?2, ?3, ?4, NULLIF(?5, 0))`,
+		orderNum, userID, amount, processedAt, merchantID)
+	if err != nil {
+		return fmt.Errorf("cant add new withdrawal, err: %w", mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "withdrawals", column: "user_id", parent: "users", id: userID},
+			sqliteReference{table: "withdrawals", column: "merchant_id", parent: "merchants", id: merchantID}))
+	}
+
+	err = insertSQLiteOutboxEvent(ctx, tx, entities.EventPointsWithdrawn, &entities.WithdrawalEventPayload{
+		UserID:      userID,
+		OrderNum:    orderNum,
+		Sum:         amount,
+		ProcessedAt: entities.TimeRFC3339{Time: processedAt},
+		MerchantID:  merchantID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWithdrawals returns user`s withdrawals, newest first, restricted by a filter (statuses are ignored).
+func (s *SQLite) GetWithdrawals(ctx context.Context, userID int, filter entities.ListFilter) ([]entities.WithdrawalData, error) {
+	conditions, args := buildListConditions(sqliteDialect, filter, "processed_at", "", userID)
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT id, order_num, amount, processed_at
+		FROM `+buildListSource("withdrawals", "id, user_id, order_num, amount, processed_at", filter)+`
+		WHERE `+conditions+`
+		ORDER BY processed_at DESC, id DESC`+buildLimit(filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var withdrawals []entities.WithdrawalData
+	for rows.Next() {
+		var withdrawal entities.WithdrawalData
+		if err := rows.Scan(&withdrawal.ID, &withdrawal.OrderNum, &withdrawal.Sum, &withdrawal.ProcessedAt.Time); err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+	return withdrawals, rows.Err()
+}
+
+// ReserveIdempotencyKey saves a new (in progress) record if there is no unexpired record with the same key.
+// A record, which is in progress longer than lease, is taken over, so a crashed request doesn`t hold its key for ttl.
+// Returns "true" and the record with its reservation time (CreatedAt) if the key was reserved,
+// otherwise returns "false" and the existing record.
+func (s *SQLite) ReserveIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord, ttl time.Duration, lease time.Duration) (entities.IdempotencyRecord, bool, error) {
+	now := time.Now().UTC()
+	var userID int
+	err := s.store.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, idem_key, fingerprint, created_at)
+		VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (user_id, idem_key) DO UPDATE
+		SET fingerprint = excluded.fingerprint, status_code = NULL, content_type = NULL,
+			response_body = NULL, created_at = excluded.created_at
+		WHERE idempotency_keys.created_at < ?5
+			OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < ?6)
+		RETURNING user_id`,
+		record.UserID, record.Key, record.Fingerprint, now, now.Add(-ttl), now.Add(-lease)).Scan(&userID)
+	if err == nil {
+		record.CreatedAt = now
+		return record, true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return entities.IdempotencyRecord{}, false, mapSQLiteReferenceError(ctx, s.store, err,
+			sqliteReference{table: "idempotency_keys", column: "user_id", parent: "users", id: record.UserID})
+	}
+
+	//key is already used
+	existing := entities.IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	err = s.store.QueryRowContext(ctx, `
+		SELECT fingerprint, status_code, content_type, response_body, created_at
+		FROM idempotency_keys
+		WHERE user_id = ?1 AND idem_key = ?2`,
+		record.UserID, record.Key).Scan(&existing.Fingerprint, &statusCode, &contentType, &existing.Body, &existing.CreatedAt)
+	if err != nil {
+		return entities.IdempotencyRecord{}, false, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.ContentType = contentType.String
+
+	return existing, false, nil
+}
+
+// SaveIdempotentResponse saves a response of a request, made with a reserved key. A reservation is matched
+// by CreatedAt, so a request, whose key was taken over after a lease, gets MakeErrIdempotencyLeaseLost().
+func (s *SQLite) SaveIdempotentResponse(ctx context.Context, record entities.IdempotencyRecord) error {
+	res, err := s.store.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status_code = ?1, content_type = ?2, response_body = ?3
+		WHERE user_id = ?4 AND idem_key = ?5 AND created_at = ?6 AND status_code IS NULL`,
+		record.StatusCode, record.ContentType, record.Body, record.UserID, record.Key, record.CreatedAt.UTC())
+	return sqliteLeaseResult(res, err)
+}
+
+// DeleteIdempotencyKey releases a reserved key, so a request can be retried with it. A key, which was taken over
+// after a lease, isn`t released and MakeErrIdempotencyLeaseLost() is returned.
+func (s *SQLite) DeleteIdempotencyKey(ctx context.Context, record entities.IdempotencyRecord) error {
+	res, err := s.store.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = ?1 AND idem_key = ?2 AND created_at = ?3 AND status_code IS NULL`,
+		record.UserID, record.Key, record.CreatedAt.UTC())
+	return sqliteLeaseResult(res, err)
+}
+
+// sqliteLeaseResult turns a change of no rows into MakeErrIdempotencyLeaseLost().
+func sqliteLeaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	changed, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return gophermart_errors.MakeErrIdempotencyLeaseLost()
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys older than ttl.
+func (s *SQLite) DeleteExpiredIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	res, err := s.store.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE created_at < ?1`, time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetUnpublishedEvents returns the oldest events, which were not published yet.
+func (s *SQLite) GetUnpublishedEvents(ctx context.Context, limit int) ([]entities.OutboxEvent, error) {
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT id, event_type, payload, created_at
+		FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT ?1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entities.OutboxEvent
+	for rows.Next() {
+		var event entities.OutboxEvent
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Type, &payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkEventsPublished marks events as published, so they won`t be returned by GetUnpublishedEvents.
+func (s *SQLite) MarkEventsPublished(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, 0, len(ids))
+	args := []any{time.Now().UTC()}
+	for _, id := range ids {
+		args = append(args, id)
+		placeholders = append(placeholders, sqliteDialect.placeholder(len(args)))
+	}
+	_, err := s.store.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET published_at = ?1
+		WHERE id IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	return err
+}
+
+// DeletePublishedEvents removes events, which were published before olderThan. Unpublished events are kept.
+func (s *SQLite) DeletePublishedEvents(ctx context.Context, olderThan time.Time) (int64, error) {
+	res, err := s.store.ExecContext(ctx, `
+		DELETE FROM outbox_events
+		WHERE published_at < ?1`, olderThan.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetBalanceAt computes a balance at the moment "at" from processed orders, withdrawals (including archived ones)
+// and balance adjustments made by admins.
+func (s *SQLite) GetBalanceAt(ctx context.Context, userID int, at time.Time) (entities.BalanceData, error) {
+	balance := entities.BalanceData{UserID: userID}
+	var accrued, adjusted float64
+	err := s.store.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(accural) FROM `+balanceOrdersSource+`
+				WHERE user_id = ?1 AND status = 'PROCESSED' AND processed_at <= ?2), 0),
+			COALESCE((SELECT SUM(amount) FROM `+balanceWithdrawalsSource+`
+				WHERE user_id = ?1 AND processed_at <= ?2), 0),
+			COALESCE((SELECT SUM(amount) FROM balance_adjustments
+				WHERE user_id = ?1 AND processed_at <= ?2), 0)`,
+		userID, at.UTC()).Scan(&accrued, &balance.Withdrawn, &adjusted)
+	if err != nil {
+		return balance, err
+	}
+
+	balance.Current = accrued + adjusted - balance.Withdrawn
+	return balance, nil
+}
+
+// GetBalanceEvents returns balance changes in (from, to], oldest first. An adjustment is accrued points,
+// a negative one takes points away.
+func (s *SQLite) GetBalanceEvents(ctx context.Context, userID int, from time.Time, to time.Time) ([]entities.BalanceEvent, error) {
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT processed_at, accural, 0.0
+		FROM `+balanceOrdersSource+`
+		WHERE user_id = ?1 AND status = 'PROCESSED' AND processed_at > ?2 AND processed_at <= ?3
+		UNION ALL
+		SELECT processed_at, 0.0, amount
+		FROM `+balanceWithdrawalsSource+`
+		WHERE user_id = ?1 AND processed_at > ?2 AND processed_at <= ?3
+		UNION ALL
+		SELECT processed_at, amount, 0.0
+		FROM balance_adjustments
+		WHERE user_id = ?1 AND processed_at > ?2 AND processed_at <= ?3
+		ORDER BY 1`,
+		userID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entities.BalanceEvent
+	for rows.Next() {
+		var event entities.BalanceEvent
+		if err := rows.Scan(&event.Time, &event.Accrued, &event.Withdrawn); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ArchiveOrders moves up to batchSize finished orders, uploaded before olderThan, to the archive.
+// Returns an amount of moved orders.
+func (s *SQLite) ArchiveOrders(ctx context.Context, olderThan time.Time, batchSize int) (int64, error) {
+	return s.archive(ctx, `
+		SELECT id FROM orders
+		WHERE status IN ('PROCESSED', 'INVALID') AND uploaded_at < ?1
+		ORDER BY id
+		LIMIT ?2`, "orders", "id, user_id, order_number, status, accural, uploaded_at, processed_at, merchant_id", olderThan, batchSize)
+}
+
+// ArchiveWithdrawals moves up to batchSize withdrawals, processed before olderThan, to the archive.
+// Returns an amount of moved withdrawals.
+func (s *SQLite) ArchiveWithdrawals(ctx context.Context, olderThan time.Time, batchSize int) (int64, error) {
+	return s.archive(ctx, `
+		SELECT id FROM withdrawals
+		WHERE processed_at < ?1
+		ORDER BY id
+		LIMIT ?2`, "withdrawals", "id, order_num, user_id, amount, processed_at, merchant_id", olderThan, batchSize)
+}
+
+// archive moves rows, selected by selectIDs, from a table to its archive ("<table>_archive").
+func (s *SQLite) archive(ctx context.Context, selectIDs string, table string, columns string, olderThan time.Time, batchSize int) (int64, error) {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectIDs, olderThan.UTC(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var placeholders []string
+	var args []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		args = append(args, id)
+		placeholders = append(placeholders, sqliteDialect.placeholder(len(args)))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	ids := strings.Join(placeholders, ", ")
+	args = append(args, time.Now().UTC())
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+table+`_archive (`+columns+`, archived_at)
+		SELECT `+columns+`, `+sqliteDialect.placeholder(len(args))+` FROM `+table+` WHERE id IN (`+ids+`)`, args...)
+	if err != nil {
+		return 0, mapSQLiteConstraintError(err)
+	}
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM `+table+` WHERE id IN (`+ids+`)`, args[:len(args)-1]...)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, tx.Commit()
+}
+
+// SaveRefreshToken saves the first token of a new family.
+func (s *SQLite) SaveRefreshToken(ctx context.Context, token entities.RefreshToken) error {
+	_, err := s.store.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)`,
+		token.Hash, token.FamilyID, token.UserID, token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return mapSQLiteReferenceError(ctx, s.store, err,
+		sqliteReference{table: "refresh_tokens", column: "user_id", parent: "users", id: token.UserID})
+}
+
+// RotateRefreshToken marks a token as used and saves a new one of the same family and user.
+// Returns a user id. If a token was already used, the whole family is revoked and MakeErrRefreshTokenReused() is returned.
+func (s *SQLite) RotateRefreshToken(ctx context.Context, oldHash string, newToken entities.RefreshToken) (int, error) {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID int
+	var familyID string
+	var expired, used, revoked bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT family_id, user_id, expires_at <= ?2, used_at IS NOT NULL, revoked_at IS NOT NULL
+		FROM refresh_tokens
+		WHERE token_hash = ?1`, oldHash, now).Scan(&familyID, &userID, &expired, &used, &revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, gophermart_errors.MakeErrRefreshTokenNotFound()
+	} else if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case revoked:
+		//a family was revoked by a logout or a reuse before
+		return 0, gophermart_errors.MakeErrRefreshTokenExpired()
+	case used:
+		_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?1
+		WHERE family_id = ?2 AND revoked_at IS NULL`, now, familyID)
+		if err != nil {
+			return 0, err
+		}
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, gophermart_errors.MakeErrRefreshTokenReused()
+	case expired:
+		return 0, gophermart_errors.MakeErrRefreshTokenExpired()
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = ?1 WHERE token_hash = ?2`, now, oldHash)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)`,
+		newToken.Hash, familyID, userID, newToken.CreatedAt.UTC(), newToken.ExpiresAt.UTC())
+	if err != nil {
+		return 0, mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "refresh_tokens", column: "user_id", parent: "users", id: userID})
+	}
+
+	return userID, tx.Commit()
+}
+
+// RevokeRefreshTokenFamily revokes a token and all tokens of its family. An unknown token is ignored.
+func (s *SQLite) RevokeRefreshTokenFamily(ctx context.Context, hash string) error {
+	_, err := s.store.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2
+		WHERE revoked_at IS NULL AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = ?1)`,
+		hash, time.Now().UTC())
+	return err
+}
+
+// RevokeAccessToken adds a token id to the denylist until the token expires.
+func (s *SQLite) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := s.store.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		VALUES (?1, ?2)
+		ON CONFLICT (jti) DO NOTHING`, tokenID, expiresAt.UTC())
+	return err
+}
+
+// IsAccessTokenRevoked checks the denylist and whether a token was issued before the last password change of its user.
+func (s *SQLite) IsAccessTokenRevoked(ctx context.Context, claims security.TokenClaims) (bool, error) {
+	var revoked bool
+	err := s.store.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?1)
+			OR EXISTS (SELECT 1 FROM users WHERE id = ?2 AND tokens_valid_after > ?3)`,
+		claims.ID, claims.UserID, claims.IssuedAt.UTC()).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpiredTokens removes expired refresh tokens, password reset tokens and denylist entries of expired access tokens.
+func (s *SQLite) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	refreshRes, err := s.store.ExecContext(ctx, `
+		DELETE FROM refresh_tokens WHERE expires_at < ?1`, now)
+	if err != nil {
+		return 0, err
+	}
+	revokedRes, err := s.store.ExecContext(ctx, `
+		DELETE FROM revoked_tokens WHERE expires_at < ?1`, now)
+	if err != nil {
+		return 0, err
+	}
+	resetRes, err := s.store.ExecContext(ctx, `
+		DELETE FROM password_reset_tokens WHERE expires_at < ?1`, now)
+	if err != nil {
+		return 0, err
+	}
+	refreshDeleted, err := refreshRes.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	revokedDeleted, err := revokedRes.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	resetDeleted, err := resetRes.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return refreshDeleted + revokedDeleted + resetDeleted, nil
+}
+
+// AddLoginFailure counts a failure of a key and returns an amount of failures in a row.
+// A counter starts again if the previous failure was more than window ago.
+func (s *SQLite) AddLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+	err := s.store.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES (?1, 1, ?2)
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ?3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = ?2
+		RETURNING failures`, key, now.UTC(), now.Add(-window).UTC()).Scan(&failures)
+	return failures, err
+}
+
+// ReleaseLoginFailure takes back a failure, counted for an attempt, which turned out to be successful.
+func (s *SQLite) ReleaseLoginFailure(ctx context.Context, key string) error {
+	_, err := s.store.ExecContext(ctx, `
+		UPDATE login_attempts SET failures = MAX(failures - 1, 0) WHERE attempt_key = ?1`, key)
+	return err
+}
+
+func (s *SQLite) LockLoginAttempts(ctx context.Context, key string, until time.Time) error {
+	_, err := s.store.ExecContext(ctx, `
+		UPDATE login_attempts SET locked_until = ?2 WHERE attempt_key = ?1`, key, until.UTC())
+	return err
+}
+
+// GetLoginLock returns a time, until which attempts of a key are locked (zero time if they are not).
+func (s *SQLite) GetLoginLock(ctx context.Context, key string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := s.store.QueryRowContext(ctx, `
+		SELECT locked_until FROM login_attempts WHERE attempt_key = ?1`, key).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+func (s *SQLite) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := s.store.ExecContext(ctx, `
+		DELETE FROM login_attempts WHERE attempt_key = ?1`, key)
+	return err
+}
+
+// DeleteExpiredLoginAttempts removes counters, whose last failure was before olderThan and which are not locked.
+func (s *SQLite) DeleteExpiredLoginAttempts(ctx context.Context, olderThan time.Time) (int64, error) {
+	res, err := s.store.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < ?1 AND (locked_until IS NULL OR locked_until < ?2)`, olderThan.UTC(), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ChangePassword checks a current password of a user and replaces it. All sessions of a user are revoked:
+// refresh tokens are revoked and access tokens issued before now are rejected by IsAccessTokenRevoked.
+func (s *SQLite) ChangePassword(ctx context.Context, userID int, currentPassword string, newPasswordHash string) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var passwordHash, passwordSalt string
+	err = tx.QueryRowContext(ctx, `
+		SELECT password_hash, password_salt FROM users WHERE id = ?1`, userID).Scan(&passwordHash, &passwordSalt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gophermart_errors.MakeErrUserNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	ok, _, err := s.hasher.Verify(currentPassword, passwordHash, passwordSalt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gophermart_errors.MakeErrWrongLoginOrPassword()
+	}
+
+	err = setSQLitePasswordTx(ctx, tx, userID, newPasswordHash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreatePasswordResetToken saves a reset token of a user found by login, older unused tokens of a user stop working.
+// Returns MakeErrUserNotFound() for an unknown login.
+func (s *SQLite) CreatePasswordResetToken(ctx context.Context, login string, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM users WHERE lower(login) = lower(?1)`, login).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gophermart_errors.MakeErrUserNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = ?2
+		WHERE user_id = ?1 AND used_at IS NULL`, userID, now)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+		VALUES (?1, ?2, ?3, ?4)`, tokenHash, userID, now, expiresAt.UTC())
+	if err != nil {
+		return mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "password_reset_tokens", column: "user_id", parent: "users", id: userID})
+	}
+	return tx.Commit()
+}
+
+// ResetPassword uses a reset token once and replaces a password of its user. Sessions are revoked as by ChangePassword.
+// Returns a user id or MakeErrPasswordResetTokenNotValid() for an unknown, used or expired token.
+func (s *SQLite) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string) (int, error) {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = ?1 AND used_at IS NULL AND expires_at > ?2`, tokenHash, now).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, gophermart_errors.MakeErrPasswordResetTokenNotValid()
+	} else if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = ?2 WHERE token_hash = ?1`, tokenHash, now)
+	if err != nil {
+		return 0, err
+	}
+	err = setSQLitePasswordTx(ctx, tx, userID, newPasswordHash)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// setSQLitePasswordTx replaces a password and revokes all sessions of a user. Token "iat" has seconds only,
+// so tokens_valid_after is truncated to seconds too, otherwise tokens issued right after a change would be rejected.
+func setSQLitePasswordTx(ctx context.Context, tx *sql.Tx, userID int, passwordHash string) error {
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users SET password_hash = ?2, password_salt = '', tokens_valid_after = ?3
+		WHERE id = ?1`, userID, passwordHash, now.Truncate(time.Second))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = ?2
+		WHERE user_id = ?1 AND revoked_at IS NULL`, userID, now)
+	return err
+}
+
+// insertSQLiteAuditRecord saves an admin action, it is called in a transaction of an action itself when there is one.
+func insertSQLiteAuditRecord(ctx context.Context, db sqliteExecer, record entities.AdminAuditRecord) error {
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		return fmt.Errorf("cant marshal audit record details, err: %w", err)
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, details, created_at)
+		VALUES (?1, ?2, NULLIF(?3, 0), ?4, ?5)`,
+		record.AdminID, record.Action, record.TargetUserID, string(details), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("cant save an audit record, err: %w", mapSQLiteReferenceError(ctx, db, err,
+			sqliteReference{table: "admin_audit_log", column: "admin_id", parent: "users", id: record.AdminID},
+			sqliteReference{table: "admin_audit_log", column: "target_user_id", parent: "users", id: record.TargetUserID}))
+	}
+	return nil
+}
+
+// sqliteExecer is implemented by both sql.DB and sql.Tx.
+type sqliteExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SaveAdminAuditRecord saves an admin action, which doesn`t change anything in the storage (a lookup for example).
+func (s *SQLite) SaveAdminAuditRecord(ctx context.Context, record entities.AdminAuditRecord) error {
+	return insertSQLiteAuditRecord(ctx, s.store, record)
+}
+
+// GetUserRoles returns roles of a user.
+func (s *SQLite) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT role FROM user_roles WHERE user_id = ?1 ORDER BY role`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// GrantRole gives a role to a user found by login. Returns MakeErrUserNotFound() for an unknown login.
+func (s *SQLite) GrantRole(ctx context.Context, login string, role string) error {
+	var userID int
+	err := s.store.QueryRowContext(ctx, `
+		SELECT id FROM users WHERE lower(login) = lower(?1)`, login).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gophermart_errors.MakeErrUserNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	_, err = s.store.ExecContext(ctx, `
+		INSERT INTO user_roles (user_id, role) VALUES (?1, ?2)
+		ON CONFLICT DO NOTHING`, userID, role)
+	return mapSQLiteReferenceError(ctx, s.store, err,
+		sqliteReference{table: "user_roles", column: "user_id", parent: "users", id: userID})
+}
+
+// GetUserByLogin finds a user with roles. Returns MakeErrUserNotFound() for an unknown login.
+func (s *SQLite) GetUserByLogin(ctx context.Context, login string) (entities.UserInfo, error) {
+	var user entities.UserInfo
+	err := s.store.QueryRowContext(ctx, `
+		SELECT id, login FROM users WHERE lower(login) = lower(?1)`, login).Scan(&user.ID, &user.Login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, gophermart_errors.MakeErrUserNotFound()
+	} else if err != nil {
+		return user, err
+	}
+
+	user.Roles, err = s.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return user, err
+	}
+	if user.Roles == nil {
+		user.Roles = []string{}
+	}
+	return user, nil
+}
+
+// AdjustBalance adds points to a balance (or takes them away with a negative amount) and saves an adjustment
+// with an audit record. Returns a new balance or MakeErrNotEnoughPoints() if a balance would become negative.
+func (s *SQLite) AdjustBalance(ctx context.Context, adjustment entities.BalanceAdjustment) (entities.BalanceData, error) {
+	var balance entities.BalanceData
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return balance, err
+	}
+	defer tx.Rollback()
+
+	//an upsert can`t be used for a negative amount, a check constraint fails on a row to insert before a conflict
+	err = tx.QueryRowContext(ctx, `
+		UPDATE balances SET points = points + ?2
+		WHERE user_id = ?1
+		RETURNING id, user_id, points, withdrawn`,
+		adjustment.UserID, adjustment.Amount).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+	if errors.Is(err, sql.ErrNoRows) {
+		if adjustment.Amount < 0 {
+			return balance, gophermart_errors.MakeErrNotEnoughPoints()
+		}
+		err = tx.QueryRowContext(ctx, `
+		INSERT INTO balances (user_id, points)
+		VALUES (?1, ?2)
+		RETURNING id, user_id, points, withdrawn`,
+			adjustment.UserID, adjustment.Amount).Scan(&balance.ID, &balance.UserID, &balance.Current, &balance.Withdrawn)
+	}
+	if err != nil {
+		return balance, fmt.Errorf("cant adjust balance, err: %w", mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "balances", column: "user_id", parent: "users", id: adjustment.UserID}))
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO balance_adjustments (user_id, admin_id, amount, reason, processed_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)`,
+		adjustment.UserID, adjustment.AdminID, adjustment.Amount, adjustment.Reason, time.Now().UTC())
+	if err != nil {
+		return balance, fmt.Errorf("cant save a balance adjustment, err: %w", mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "balance_adjustments", column: "user_id", parent: "users", id: adjustment.UserID},
+			sqliteReference{table: "balance_adjustments", column: "admin_id", parent: "users", id: adjustment.AdminID}))
+	}
+
+	err = insertSQLiteAuditRecord(ctx, tx, entities.AdminAuditRecord{
+		AdminID:      adjustment.AdminID,
+		Action:       entities.AuditActionBalanceAdjustment,
+		TargetUserID: adjustment.UserID,
+		Details:      adjustment,
+	})
+	if err != nil {
+		return balance, err
+	}
+	return balance, tx.Commit()
+}
+
+// RequeueOrder makes an unprocessed order "NEW" again, so the accrual daemon asks about it once more.
+// Returns MakeErrOrderNotFound() for an unknown (or archived) order and MakeErrOrderAlreadyProcessed() for a processed one.
+func (s *SQLite) RequeueOrder(ctx context.Context, orderNumber string, adminID int) (entities.OrderData, error) {
+	var order entities.OrderData
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return order, err
+	}
+	defer tx.Rollback()
+
+	var oldStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, order_number, status, uploaded_at
+		FROM orders
+		WHERE order_number = ?1`, orderNumber).Scan(&order.ID, &order.UserID, &order.Number, &oldStatus, &order.UploadedAt.Time)
+	if errors.Is(err, sql.ErrNoRows) {
+		return order, gophermart_errors.MakeErrOrderNotFound()
+	} else if err != nil {
+		return order, fmt.Errorf("cant get an order to requeue, err: %w", err)
+	}
+	if oldStatus == entities.OrderStatusProcessed {
+		return order, gophermart_errors.MakeErrOrderAlreadyProcessed()
+	}
+
+	order.Status = entities.OrderStatusNew
+	_, err = tx.ExecContext(ctx, `
+		UPDATE orders SET status = ?1, accural = 0 WHERE id = ?2`, order.Status, order.ID)
+	if err != nil {
+		return order, fmt.Errorf("cant requeue an order, err: %w", err)
+	}
+
+	err = insertSQLiteAuditRecord(ctx, tx, entities.AdminAuditRecord{
+		AdminID:      adminID,
+		Action:       entities.AuditActionOrderRequeue,
+		TargetUserID: order.UserID,
+		Details:      map[string]string{"order": order.Number, "previous_status": oldStatus},
+	})
+	if err != nil {
+		return order, err
+	}
+	return order, tx.Commit()
+}
+
+// CreateMerchant saves a merchant with an audit record. Returns MakeErrMerchantAlreadyExists() for a taken name.
+func (s *SQLite) CreateMerchant(ctx context.Context, name string, adminID int) (entities.Merchant, error) {
+	merchant := entities.Merchant{Name: name, CreatedAt: entities.TimeRFC3339{Time: time.Now().UTC()}}
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return merchant, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO merchants (name, created_at)
+		VALUES (?1, ?2)
+		RETURNING id`, name, merchant.CreatedAt.Time).Scan(&merchant.ID)
+	if err != nil {
+		return merchant, mapSQLiteConstraintError(err)
+	}
+
+	err = insertSQLiteAuditRecord(ctx, tx, entities.AdminAuditRecord{
+		AdminID: adminID,
+		Action:  entities.AuditActionMerchantCreate,
+		Details: map[string]any{"merchant_id": merchant.ID, "name": name},
+	})
+	if err != nil {
+		return merchant, err
+	}
+	return merchant, tx.Commit()
+}
+
+// CreateAPIKey saves a key of a merchant with an audit record. Returns MakeErrMerchantNotFound() for an unknown merchant.
+func (s *SQLite) CreateAPIKey(ctx context.Context, key entities.APIKey, adminID int) (entities.APIKey, error) {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return key, err
+	}
+	defer tx.Rollback()
+
+	key.CreatedAt.Time = time.Now().UTC()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO api_keys (merchant_id, key_prefix, key_hash, scopes, rate_limit, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+		RETURNING id`,
+		key.MerchantID, key.Prefix, key.Hash, joinScopes(key.Scopes), key.RateLimit, key.CreatedAt.Time).Scan(&key.ID)
+	if err != nil {
+		return key, mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "api_keys", column: "merchant_id", parent: "merchants", id: key.MerchantID})
+	}
+
+	err = insertSQLiteAuditRecord(ctx, tx, entities.AdminAuditRecord{
+		AdminID: adminID,
+		Action:  entities.AuditActionAPIKeyCreate,
+		Details: &key,
+	})
+	if err != nil {
+		return key, err
+	}
+	return key, tx.Commit()
+}
+
+// RevokeAPIKey revokes a key of a merchant with an audit record. Returns MakeErrAPIKeyNotFound()
+// if a merchant has no such key or it is already revoked.
+func (s *SQLite) RevokeAPIKey(ctx context.Context, merchantID int, keyID int, adminID int) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = ?3
+		WHERE id = ?1 AND merchant_id = ?2 AND revoked_at IS NULL`, keyID, merchantID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	revoked, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return gophermart_errors.MakeErrAPIKeyNotFound()
+	}
+
+	err = insertSQLiteAuditRecord(ctx, tx, entities.AdminAuditRecord{
+		AdminID: adminID,
+		Action:  entities.AuditActionAPIKeyRevoke,
+		Details: map[string]int{"merchant_id": merchantID, "key_id": keyID},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAPIKey finds an active key by its hash. Returns MakeErrAPIKeyNotFound() for an unknown or revoked key.
+func (s *SQLite) GetAPIKey(ctx context.Context, hash string) (entities.APIKey, error) {
+	key := entities.APIKey{Hash: hash}
+	var scopes string
+	err := s.store.QueryRowContext(ctx, `
+		SELECT id, merchant_id, key_prefix, scopes, rate_limit, created_at
+		FROM api_keys
+		WHERE key_hash = ?1 AND revoked_at IS NULL`, hash).Scan(&key.ID, &key.MerchantID, &key.Prefix, &scopes, &key.RateLimit, &key.CreatedAt.Time)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, gophermart_errors.MakeErrAPIKeyNotFound()
+	} else if err != nil {
+		return key, fmt.Errorf("cant get an api key, err: %w", err)
+	}
+	key.Scopes = splitScopes(scopes)
+	return key, nil
+}
+
+// LinkMerchant lets a merchant act on behalf of a user, linking a linked merchant again changes nothing.
+// Returns MakeErrMerchantNotFound() for an unknown merchant.
+func (s *SQLite) LinkMerchant(ctx context.Context, userID int, merchantID int) error {
+	tx, err := s.store.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO merchant_users (merchant_id, user_id, linked_at)
+		VALUES (?1, ?2, ?3)
+		ON CONFLICT (merchant_id, user_id) DO NOTHING`, merchantID, userID, time.Now().UTC())
+	if err != nil {
+		return mapSQLiteReferenceError(ctx, tx, err,
+			sqliteReference{table: "merchant_users", column: "merchant_id", parent: "merchants", id: merchantID},
+			sqliteReference{table: "merchant_users", column: "user_id", parent: "users", id: userID})
+	}
+	return tx.Commit()
+}
+
+// UnlinkMerchant takes a consent of a user back. Returns MakeErrMerchantNotLinked() if a merchant wasn`t linked.
+func (s *SQLite) UnlinkMerchant(ctx context.Context, userID int, merchantID int) error {
+	res, err := s.store.ExecContext(ctx, `
+		DELETE FROM merchant_users WHERE merchant_id = ?1 AND user_id = ?2`, merchantID, userID)
+	if err != nil {
+		return err
+	}
+	unlinked, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if unlinked == 0 {
+		return gophermart_errors.MakeErrMerchantNotLinked()
+	}
+	return nil
+}
+
+// GetLinkedMerchants returns merchants, linked by a user, oldest links first.
+func (s *SQLite) GetLinkedMerchants(ctx context.Context, userID int) ([]entities.MerchantLink, error) {
+	rows, err := s.store.QueryContext(ctx, `
+		SELECT m.id, m.name, mu.linked_at
+		FROM merchant_users mu
+		JOIN merchants m ON m.id = mu.merchant_id
+		WHERE mu.user_id = ?1
+		ORDER BY mu.linked_at, m.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []entities.MerchantLink
+	for rows.Next() {
+		var link entities.MerchantLink
+		if err := rows.Scan(&link.MerchantID, &link.MerchantName, &link.LinkedAt.Time); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// IsMerchantLinked checks a consent of a user.
+func (s *SQLite) IsMerchantLinked(ctx context.Context, merchantID int, userID int) (bool, error) {
+	var linked bool
+	err := s.store.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM merchant_users WHERE merchant_id = ?1 AND user_id = ?2)`,
+		merchantID, userID).Scan(&linked)
+	return linked, err
+}
@@ -0,0 +1,99 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteUniqueConstraints maps sqlite unique columns to constraint names, used by postgresql.
+var sqliteUniqueConstraints = map[string]string{
+	"users.login":           "users_login_key",
+	"orders.order_number":   "orders_order_number_key",
+	"withdrawals.order_num": "withdrawals_order_num_key",
+	"merchants.name":        "merchants_name_key",
+
+	"orders_archive.order_number":   "orders_archive_order_number_key",
+	"withdrawals_archive.order_num": "withdrawals_archive_order_num_key",
+}
+
+// sqliteReference is a foreign key value of a written row. sqlite doesn`t name a failed foreign key,
+// so a statement lists its references, and the failed one is found by a missing parent row.
+type sqliteReference struct {
+	table  string
+	column string
+	parent string
+	id     int
+}
+
+// constraint is a name of a foreign key, used by postgresql.
+func (r sqliteReference) constraint() string {
+	return r.table + "_" + r.column + "_fkey"
+}
+
+// mapSQLiteConstraintError turns constraint violations into the same typed errors as mapConstraintError does.
+// A failed foreign key isn`t named, use mapSQLiteReferenceError for statements with references.
+func mapSQLiteConstraintError(err error) error {
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) {
+		return err
+	}
+
+	//message looks like "constraint failed: CHECK constraint failed: balances_points_non_negative (275)"
+	constraint := liteErr.Error()
+	if i := strings.LastIndex(constraint, "failed: "); i >= 0 {
+		constraint = constraint[i+len("failed: "):]
+	}
+	if i := strings.LastIndex(constraint, " ("); i >= 0 {
+		constraint = constraint[:i]
+	}
+
+	var kind error
+	switch liteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		kind = gophermart_errors.MakeErrUniqueViolation()
+		if name, ok := sqliteUniqueConstraints[constraint]; ok {
+			constraint = name
+		}
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return &gophermart_errors.ConstraintViolationError{Err: gophermart_errors.MakeErrForeignKeyViolation()}
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		kind = gophermart_errors.MakeErrCheckViolation()
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		kind = gophermart_errors.MakeErrNotNullViolation()
+	default:
+		return err
+	}
+
+	return constraintViolation(constraint, kind)
+}
+
+// mapSQLiteReferenceError maps errors like mapSQLiteConstraintError does and names a failed foreign key
+// by the first reference without a parent row. References with a zero id are NULL and can`t fail.
+func mapSQLiteReferenceError(ctx context.Context, q sqliteExecer, err error, refs ...sqliteReference) error {
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) || liteErr.Code() != sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY {
+		return mapSQLiteConstraintError(err)
+	}
+
+	for _, ref := range refs {
+		if ref.id == 0 {
+			continue
+		}
+		var exists bool
+		checkErr := q.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM `+ref.parent+` WHERE id = ?1)`, ref.id).Scan(&exists)
+		if checkErr != nil {
+			return fmt.Errorf("%w, cant find a failed foreign key, err: %w", mapSQLiteConstraintError(err), checkErr)
+		}
+		if !exists {
+			return constraintViolation(ref.constraint(), gophermart_errors.MakeErrForeignKeyViolation())
+		}
+	}
+	return mapSQLiteConstraintError(err)
+}
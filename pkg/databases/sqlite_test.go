@@ -0,0 +1,304 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"yandex_gophermart/pkg/entities"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// newTestSQLite makes a migrated in-memory storage, a storage has one connection, so it sees one database
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	store, err := NewSQLite(context.Background(), "sqlite::memory:")
+	require.NoError(t, err, "cant make a storage")
+	t.Cleanup(store.Close)
+	require.NoError(t, store.SetTables(context.Background()), "cant migrate a storage")
+	return store
+}
+
+func TestSQLite_ForeignKeyErrors(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+	merchant, err := store.CreateMerchant(ctx, "shop", userID)
+	require.NoError(t, err, "cant save a merchant")
+	require.NoError(t, store.AddToBalance(ctx, userID, 100), "cant add points")
+	const unknownID = 1000
+
+	tests := []struct {
+		name       string
+		do         func() error
+		wantErr    error
+		constraint string
+	}{
+		{
+			name: "order of unknown user",
+			do: func() error {
+				return store.SaveNewOrder(ctx, entities.OrderData{UserID: unknownID, Number: "1", Status: entities.OrderStatusNew})
+			},
+			wantErr:    gophermart_errors.MakeErrUserNotFound(),
+			constraint: "orders_user_id_fkey",
+		},
+		{
+			name: "order of unknown merchant",
+			do: func() error {
+				return store.SaveNewOrder(ctx, entities.OrderData{UserID: userID, MerchantID: unknownID, Number: "2", Status: entities.OrderStatusNew})
+			},
+			wantErr:    gophermart_errors.MakeErrMerchantNotFound(),
+			constraint: "orders_merchant_id_fkey",
+		},
+		{
+			name: "withdrawal of unknown merchant",
+			do: func() error {
+				return store.WithdrawFromBalance(ctx, userID, "3", 10, unknownID)
+			},
+			wantErr:    gophermart_errors.MakeErrMerchantNotFound(),
+			constraint: "withdrawals_merchant_id_fkey",
+		},
+		{
+			name: "points of unknown user",
+			do: func() error {
+				return store.AddToBalance(ctx, unknownID, 10)
+			},
+			wantErr:    gophermart_errors.MakeErrUserNotFound(),
+			constraint: "balances_user_id_fkey",
+		},
+		{
+			name: "adjustment by unknown admin",
+			do: func() error {
+				_, err := store.AdjustBalance(ctx, entities.BalanceAdjustment{UserID: userID, AdminID: unknownID, Amount: 1, Reason: "bonus"})
+				return err
+			},
+			constraint: "balance_adjustments_admin_id_fkey",
+		},
+		{
+			name: "key of unknown merchant",
+			do: func() error {
+				_, err := store.CreateAPIKey(ctx, entities.APIKey{MerchantID: unknownID, Prefix: "p", Hash: "h", RateLimit: 10}, userID)
+				return err
+			},
+			wantErr:    gophermart_errors.MakeErrMerchantNotFound(),
+			constraint: "api_keys_merchant_id_fkey",
+		},
+		{
+			name: "link of unknown merchant",
+			do: func() error {
+				return store.LinkMerchant(ctx, userID, unknownID)
+			},
+			wantErr:    gophermart_errors.MakeErrMerchantNotFound(),
+			constraint: "merchant_users_merchant_id_fkey",
+		},
+		{
+			name: "link of unknown user",
+			do: func() error {
+				return store.LinkMerchant(ctx, unknownID, merchant.ID)
+			},
+			wantErr:    gophermart_errors.MakeErrUserNotFound(),
+			constraint: "merchant_users_user_id_fkey",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.do()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr, "wrong business error")
+			}
+			assert.ErrorIs(t, err, gophermart_errors.MakeErrForeignKeyViolation(), "wrong violation kind")
+			var violation *gophermart_errors.ConstraintViolationError
+			require.True(t, errors.As(err, &violation), "no constraint violation in %v", err)
+			assert.Equal(t, tt.constraint, violation.Constraint, "wrong failed foreign key")
+		})
+	}
+}
+
+func TestSQLite_ConstraintErrors(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+
+	_, err = store.SaveUser(ctx, "USER", "hash", "")
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrUserAlreadyExists(), "login in other case is saved")
+
+	_, err = store.CreateMerchant(ctx, "shop", userID)
+	require.NoError(t, err, "cant save a merchant")
+	_, err = store.CreateMerchant(ctx, "shop", userID)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrMerchantAlreadyExists(), "merchant name isn`t unique")
+	var violation *gophermart_errors.ConstraintViolationError
+	require.True(t, errors.As(err, &violation), "no constraint violation in %v", err)
+	assert.Equal(t, "merchants_name_key", violation.Constraint, "wrong unique constraint")
+}
+
+func TestSQLite_WithdrawFromBalance(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+	require.NoError(t, store.AddToBalance(ctx, userID, 100), "cant add points")
+
+	require.NoError(t, store.WithdrawFromBalance(ctx, userID, "2377225624", 60, 0), "cant withdraw points")
+
+	//a repeat is a conflict, even if there are not enough points for it now
+	err = store.WithdrawFromBalance(ctx, userID, "2377225624", 60, 0)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrWithdrawalAlreadyExists(), "repeated withdrawal isn`t a conflict")
+
+	err = store.WithdrawFromBalance(ctx, userID, "49927398716", 60, 0)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrNotEnoughPoints(), "withdrawal over a balance is accepted")
+
+	//archived withdrawals keep their order numbers
+	moved, err := store.ArchiveWithdrawals(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err, "cant archive withdrawals")
+	require.Equal(t, int64(1), moved, "wrong amount of archived withdrawals")
+	err = store.WithdrawFromBalance(ctx, userID, "2377225624", 10, 0)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrWithdrawalAlreadyExists(), "archived withdrawal is repeated")
+
+	balance, err := store.GetBalance(ctx, userID)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 40.0, balance.Current, "wrong balance")
+	assert.Equal(t, 60.0, balance.Withdrawn, "wrong withdrawn points")
+}
+
+func TestSQLite_DeletePublishedEvents(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+	require.NoError(t, store.AddToBalance(ctx, userID, 100), "cant add points")
+	require.NoError(t, store.WithdrawFromBalance(ctx, userID, "2377225624", 10, 0), "cant withdraw points")
+	require.NoError(t, store.WithdrawFromBalance(ctx, userID, "49927398716", 10, 0), "cant withdraw points")
+
+	events, err := store.GetUnpublishedEvents(ctx, 10)
+	require.NoError(t, err, "cant get events")
+	require.Len(t, events, 2, "wrong amount of events")
+	require.NoError(t, store.MarkEventsPublished(ctx, []int64{events[0].ID}), "cant mark an event")
+
+	deleted, err := store.DeletePublishedEvents(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err, "cant delete events")
+	assert.Equal(t, int64(0), deleted, "recently published event is deleted")
+
+	deleted, err = store.DeletePublishedEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err, "cant delete events")
+	assert.Equal(t, int64(1), deleted, "wrong amount of deleted events")
+
+	//unpublished events are kept whatever their age is
+	events, err = store.GetUnpublishedEvents(ctx, 10)
+	require.NoError(t, err, "cant get events")
+	assert.Len(t, events, 1, "unpublished event is deleted")
+}
+
+func TestSQLite_ReserveIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+	record := entities.IdempotencyRecord{UserID: userID, Key: "key", Fingerprint: "fingerprint"}
+
+	first, reserved, err := store.ReserveIdempotencyKey(ctx, record, time.Hour, time.Minute)
+	require.NoError(t, err, "cant reserve a key")
+	assert.True(t, reserved, "new key isn`t reserved")
+	assert.False(t, first.CreatedAt.IsZero(), "reservation has no time")
+
+	existing, reserved, err := store.ReserveIdempotencyKey(ctx, record, time.Hour, time.Minute)
+	require.NoError(t, err, "cant reserve a key")
+	assert.False(t, reserved, "key in progress is reserved again")
+	assert.Equal(t, 0, existing.StatusCode, "key in progress has a response")
+
+	//the first request runs longer than a lease, a retry takes its key over
+	time.Sleep(time.Millisecond * 10)
+	retry, reserved, err := store.ReserveIdempotencyKey(ctx, record, time.Hour, time.Millisecond)
+	require.NoError(t, err, "cant reserve a key")
+	assert.True(t, reserved, "key in progress isn`t taken over after a lease")
+
+	//the first request can neither release the key nor overwrite a response of the retry
+	err = store.DeleteIdempotencyKey(ctx, first)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrIdempotencyLeaseLost(), "key is released by a request, which lost it")
+	retry.StatusCode = 200
+	retry.Body = []byte("retry")
+	require.NoError(t, store.SaveIdempotentResponse(ctx, retry), "cant save a response")
+	first.StatusCode = 201
+	first.Body = []byte("first")
+	err = store.SaveIdempotentResponse(ctx, first)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrIdempotencyLeaseLost(), "response is saved by a request, which lost a key")
+
+	//a saved response is kept for ttl
+	time.Sleep(time.Millisecond * 10)
+	existing, reserved, err = store.ReserveIdempotencyKey(ctx, record, time.Hour, time.Millisecond)
+	require.NoError(t, err, "cant reserve a key")
+	assert.False(t, reserved, "key with a response is taken over after a lease")
+	assert.Equal(t, 200, existing.StatusCode, "wrong saved response")
+	assert.Equal(t, []byte("retry"), existing.Body, "response of a retry is overwritten")
+
+	//a saved response can`t be released
+	err = store.DeleteIdempotencyKey(ctx, retry)
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrIdempotencyLeaseLost(), "saved response is released")
+}
+
+func TestSQLite_Archive(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSQLite(t)
+	userID, err := store.SaveUser(ctx, "user", "hash", "")
+	require.NoError(t, err, "cant save a user")
+	uploadedAt := time.Now().Add(-time.Hour * 2)
+	for i, number := range []string{"2377225624", "49927398716", "12345678903"} {
+		order := entities.OrderData{UserID: userID, Number: number, Status: entities.OrderStatusNew}
+		order.UploadedAt.Time = uploadedAt.Add(time.Minute * time.Duration(i))
+		require.NoError(t, store.SaveNewOrder(ctx, order), "cant save an order")
+	}
+	orders, err := store.GetOrdersList(ctx, userID, entities.ListFilter{})
+	require.NoError(t, err, "cant get orders")
+	require.Len(t, orders, 3, "wrong amount of orders")
+	//the oldest order stays unfinished, others are finished
+	orders[0].Status, orders[0].Accrual = entities.OrderStatusProcessed, 100
+	orders[1].Status = entities.OrderStatusInvalid
+	require.NoError(t, store.UpdateOrder(ctx, orders[0]), "cant update an order")
+	require.NoError(t, store.UpdateOrder(ctx, orders[1]), "cant update an order")
+	require.NoError(t, store.WithdrawFromBalance(ctx, userID, "79927398713", 30, 0), "cant withdraw points")
+	require.NoError(t, store.WithdrawFromBalance(ctx, userID, "4561261212345467", 20, 0), "cant withdraw points")
+
+	//finished orders are moved in batches, unfinished ones stay
+	for _, want := range []int64{1, 1, 0} {
+		moved, err := store.ArchiveOrders(ctx, time.Now(), 1)
+		require.NoError(t, err, "cant archive orders")
+		assert.Equal(t, want, moved, "wrong amount of archived orders")
+	}
+	moved, err := store.ArchiveWithdrawals(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err, "cant archive withdrawals")
+	assert.Equal(t, int64(0), moved, "recent withdrawals are archived")
+	moved, err = store.ArchiveWithdrawals(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err, "cant archive withdrawals")
+	assert.Equal(t, int64(2), moved, "wrong amount of archived withdrawals")
+
+	//lists return archived rows only if they are asked for
+	orders, err = store.GetOrdersList(ctx, userID, entities.ListFilter{})
+	require.NoError(t, err, "cant get orders")
+	require.Len(t, orders, 1, "archived orders are listed")
+	assert.Equal(t, "2377225624", orders[0].Number, "wrong unfinished order")
+	orders, err = store.GetOrdersList(ctx, userID, entities.ListFilter{IncludeArchived: true})
+	require.NoError(t, err, "cant get orders")
+	require.Len(t, orders, 3, "archived orders aren`t listed")
+	assert.Equal(t, []string{"12345678903", "49927398716", "2377225624"}, []string{orders[0].Number, orders[1].Number, orders[2].Number}, "wrong order of a list")
+	assert.Equal(t, entities.OrderStatusProcessed, orders[0].Status, "archived order changed")
+	assert.Equal(t, 100.0, orders[0].Accrual, "archived order changed")
+
+	withdrawals, err := store.GetWithdrawals(ctx, userID, entities.ListFilter{})
+	require.NoError(t, err, "cant get withdrawals")
+	assert.Empty(t, withdrawals, "archived withdrawals are listed")
+	withdrawals, err = store.GetWithdrawals(ctx, userID, entities.ListFilter{IncludeArchived: true, Limit: 1})
+	require.NoError(t, err, "cant get withdrawals")
+	require.Len(t, withdrawals, 1, "limit isn`t applied to archived withdrawals")
+	assert.Equal(t, 20.0, withdrawals[0].Sum, "wrong last withdrawal")
+
+	//archived order numbers are still taken, a balance isn`t changed by archiving
+	err = store.SaveNewOrder(ctx, entities.OrderData{UserID: userID, Number: "12345678903", Status: entities.OrderStatusNew})
+	assert.ErrorIs(t, err, gophermart_errors.MakeErrUserHasAlreadyUploadedThisOrder(), "archived order is uploaded again")
+	balance, err := store.GetBalance(ctx, userID)
+	require.NoError(t, err, "cant get a balance")
+	assert.Equal(t, 50.0, balance.Current, "wrong balance")
+	assert.Equal(t, 50.0, balance.Withdrawn, "wrong withdrawn points")
+}
@@ -0,0 +1,30 @@
+package databases
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// IsTransientError returns true if a storage call failed before it reached a database (a connection
+// couldn`t be made or was lost before a query was sent) or a database was busy. Such calls can be repeated
+// safely, even if they write.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		primaryCode := liteErr.Code() & 0xff
+		return primaryCode == sqlite3.SQLITE_BUSY || primaryCode == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package entities
+
+// Roles give access to privileged operations. Any user can use their own data without a role.
+const (
+	RoleAdmin = "admin"
+)
+
+// Actions of admins, they are written to the audit log.
+const (
+	AuditActionUserLookup        = "user_lookup"
+	AuditActionBalanceAdjustment = "balance_adjustment"
+	AuditActionOrderRequeue      = "order_requeue"
+	AuditActionLoginUnlock       = "login_unlock"
+	AuditActionMerchantCreate    = "merchant_create"
+	AuditActionAPIKeyCreate      = "api_key_create"
+	AuditActionAPIKeyRevoke      = "api_key_revoke"
+)
+
+type UserInfo struct {
+	ID    int      `json:"id"`
+	Login string   `json:"login"`
+	Roles []string `json:"roles"`
+}
+
+// BalanceAdjustment is a manual change of a balance made by an admin. Amount is negative to take points away.
+type BalanceAdjustment struct {
+	UserID  int     `json:"user_id"`
+	AdminID int     `json:"admin_id"`
+	Amount  float64 `json:"amount"`
+	Reason  string  `json:"reason"`
+}
+
+// AdminAuditRecord is an admin action. TargetUserID is 0 if an action isn`t about a user,
+// Details is marshalled to JSON.
+type AdminAuditRecord struct {
+	AdminID      int
+	Action       string
+	TargetUserID int
+	Details      any
+}
@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+const (
+	BalanceHistoryDay   = "day"
+	BalanceHistoryEvent = "event"
+)
+
+// BalanceEvent is a change of a balance: a processed order or an admin adjustment (Accrued) or a withdrawal (Withdrawn).
+type BalanceEvent struct {
+	Time      time.Time
+	Accrued   float64
+	Withdrawn float64
+}
+
+// BalancePoint is a balance state at some moment.
+type BalancePoint struct {
+	At        TimeRFC3339 `json:"at"`
+	Current   float64     `json:"current"`
+	Withdrawn float64     `json:"withdrawn"`
+}
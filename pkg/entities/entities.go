@@ -44,6 +44,7 @@ func (t *TimeRFC3339) UnmarshalJSON(data []byte) error {
 type OrderData struct {
 	ID         int         `json:"-"`
 	UserID     int         `json:"-"`
+	MerchantID int         `json:"-"` //0 if a user uploaded an order on their own
 	Number     string      `json:"number"`
 	Status     string      `json:"status"`
 	Accrual    float64     `json:"accrual"`
@@ -58,7 +59,20 @@ type BalanceData struct {
 }
 
 type WithdrawalData struct {
+	ID          int         `json:"-"`
 	OrderNum    string      `json:"order"`
 	Sum         float64     `json:"sum"`
 	ProcessedAt TimeRFC3339 `json:"processed_at"`
 }
+
+// IdempotencyRecord is a stored result of a request made with an "Idempotency-Key" header.
+// StatusCode is 0 while the first request is still in progress.
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
@@ -0,0 +1,54 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outbox event types
+const (
+	EventOrderUploaded   = "order.uploaded"
+	EventOrderProcessing = "order.processing"
+	EventOrderProcessed  = "order.processed"
+	EventOrderInvalid    = "order.invalid"
+	EventPointsWithdrawn = "points.withdrawn"
+)
+
+// OutboxEvent is a domain event, saved in the same transaction as a change it describes.
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type OrderEventPayload struct {
+	UserID     int         `json:"user_id"`
+	Number     string      `json:"number"`
+	Status     string      `json:"status"`
+	Accrual    float64     `json:"accrual"`
+	UploadedAt TimeRFC3339 `json:"uploaded_at"`
+	MerchantID int         `json:"merchant_id,omitempty"`
+}
+
+type WithdrawalEventPayload struct {
+	UserID      int         `json:"user_id"`
+	OrderNum    string      `json:"order"`
+	Sum         float64     `json:"sum"`
+	ProcessedAt TimeRFC3339 `json:"processed_at"`
+	MerchantID  int         `json:"merchant_id,omitempty"`
+}
+
+// OrderStatusEvent returns an event type for an order, which got a new status.
+func OrderStatusEvent(status string) string {
+	switch status {
+	case OrderStatusProcessing:
+		return EventOrderProcessing
+	case OrderStatusProcessed:
+		return EventOrderProcessed
+	case OrderStatusInvalid:
+		return EventOrderInvalid
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,54 @@
+package entities
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListFilter describes a page and optional filters of a user`s orders or withdrawals list.
+// Zero values mean "no restriction", so an empty filter returns the whole list (newest first).
+type ListFilter struct {
+	Limit    int
+	Cursor   *ListCursor
+	Statuses []string
+	From     time.Time //inclusive
+	To       time.Time //exclusive
+	//archived rows are returned only if they are asked for
+	IncludeArchived bool
+}
+
+// ListCursor points to the last row of a previous page. Lists are ordered by (time, id) descending.
+type ListCursor struct {
+	Time time.Time
+	ID   int
+}
+
+// Encode makes an opaque string from a cursor.
+func (c ListCursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeListCursor parses a cursor made by ListCursor.Encode.
+func DecodeListCursor(cursor string) (ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ListCursor{}, fmt.Errorf("cant decode a cursor: %w", err)
+	}
+	timePart, idPart, found := strings.Cut(string(raw), ":")
+	if !found {
+		return ListCursor{}, fmt.Errorf("wrong cursor format")
+	}
+	nanos, err := strconv.ParseInt(timePart, 10, 64)
+	if err != nil {
+		return ListCursor{}, fmt.Errorf("cant parse cursor time: %w", err)
+	}
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return ListCursor{}, fmt.Errorf("cant parse cursor id: %w", err)
+	}
+	return ListCursor{Time: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
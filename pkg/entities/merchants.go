@@ -0,0 +1,37 @@
+package entities
+
+// Scopes of API keys, a key can be used for endpoints of its scopes only.
+const (
+	ScopeOrdersSubmit = "orders:submit"
+	ScopeBalanceRead  = "balance:read"
+	ScopePointsRedeem = "points:redeem"
+)
+
+// APIKeyScopes are all known scopes.
+var APIKeyScopes = []string{ScopeOrdersSubmit, ScopeBalanceRead, ScopePointsRedeem}
+
+// Merchant is a partner service (an online shop backend for example), which calls the API on behalf of users.
+type Merchant struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	CreatedAt TimeRFC3339 `json:"created_at"`
+}
+
+// APIKey is a key of a merchant. Only a hash of a key is stored, Prefix is the beginning of a key,
+// which helps to find out what key is used. RateLimit is requests per minute.
+type APIKey struct {
+	ID         int         `json:"id"`
+	MerchantID int         `json:"merchant_id"`
+	Prefix     string      `json:"prefix"`
+	Hash       string      `json:"-"`
+	Scopes     []string    `json:"scopes"`
+	RateLimit  int         `json:"rate_limit"`
+	CreatedAt  TimeRFC3339 `json:"created_at"`
+}
+
+// MerchantLink is a consent of a user: a linked merchant can act on behalf of the user with its API keys.
+type MerchantLink struct {
+	MerchantID   int         `json:"merchant_id"`
+	MerchantName string      `json:"merchant_name"`
+	LinkedAt     TimeRFC3339 `json:"linked_at"`
+}
@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+// RefreshToken is a stored refresh token. Only a hash of a token is stored. Every refresh replaces a token
+// with a new one of the same family, so a family is a chain of tokens, started by one login.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PasswordResetNotice is sent to a user, who asked to reset a password. Token is given to a user only,
+// a storage keeps its hash.
+type PasswordResetNotice struct {
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoginAttempt is a login attempt, which a login guard counted before a password is checked, so concurrent
+// attempts can`t get over a limit. Failures are counted with this attempt, zero if a limit is disabled.
+type LoginAttempt struct {
+	Login         string
+	IP            string
+	LoginFailures int
+	IPFailures    int
+}
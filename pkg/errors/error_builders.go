@@ -1,9 +1,51 @@
 package gophermarterrors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Database errors
 
+// ConstraintViolationError is returned by a storage when a query breaks a db constraint.
+// Err is one of "constraint violation" errors below, so it can be checked with errors.Is().
+type ConstraintViolationError struct {
+	Constraint string
+	Err        error
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("%s (constraint `%s`)", e.Err.Error(), e.Constraint)
+}
+
+func (e *ConstraintViolationError) Unwrap() error {
+	return e.Err
+}
+
+var errUniqueViolation error = errors.New("unique constraint violation")
+
+func MakeErrUniqueViolation() error {
+	return errUniqueViolation
+}
+
+var errForeignKeyViolation error = errors.New("foreign key constraint violation")
+
+func MakeErrForeignKeyViolation() error {
+	return errForeignKeyViolation
+}
+
+var errCheckViolation error = errors.New("check constraint violation")
+
+func MakeErrCheckViolation() error {
+	return errCheckViolation
+}
+
+var errNotNullViolation error = errors.New("not null constraint violation")
+
+func MakeErrNotNullViolation() error {
+	return errNotNullViolation
+}
+
 var errUserAlreadyExists error = errors.New("this user already exists")
 
 func MakeErrUserAlreadyExists() error {
@@ -16,6 +58,25 @@ func MakeErrUserNotFound() error {
 	return errUserNotFound
 }
 
+var errMerchantAlreadyExists error = errors.New("this merchant already exists")
+
+func MakeErrMerchantAlreadyExists() error {
+	return errMerchantAlreadyExists
+}
+
+var errMerchantNotFound error = errors.New("merchant wasn`t found")
+
+func MakeErrMerchantNotFound() error {
+	return errMerchantNotFound
+}
+
+// a user hasn`t allowed a merchant to act on their behalf
+var errMerchantNotLinked error = errors.New("merchant isn`t linked to this user")
+
+func MakeErrMerchantNotLinked() error {
+	return errMerchantNotLinked
+}
+
 var errThisOrderWasUploadedByDifferentUser error = errors.New("this order was uploaded by different user")
 
 func MakeErrThisOrderWasUploadedByDifferentUser() error {
@@ -34,8 +95,51 @@ func MakeErrOrderNotFound() error {
 	return errOrderNotFound
 }
 
+// a processed order can`t be sent to the accrual system again, its points are already accrued
+var errOrderAlreadyProcessed error = errors.New("order was already processed")
+
+func MakeErrOrderAlreadyProcessed() error {
+	return errOrderAlreadyProcessed
+}
+
+var errWithdrawalAlreadyExists error = errors.New("points were already withdrawn for this order")
+
+func MakeErrWithdrawalAlreadyExists() error {
+	return errWithdrawalAlreadyExists
+}
+
+// a request held an idempotency key longer than its lease, and a retry took the key over
+var errIdempotencyLeaseLost error = errors.New("idempotency key was taken over by another request")
+
+func MakeErrIdempotencyLeaseLost() error {
+	return errIdempotencyLeaseLost
+}
+
+var errTxRetriesExhausted error = errors.New("transaction was retried too many times because of concurrent changes")
+
+func MakeErrTxRetriesExhausted() error {
+	return errTxRetriesExhausted
+}
+
+var errQueryTimeout error = errors.New("storage call took too long")
+
+func MakeErrQueryTimeout() error {
+	return errQueryTimeout
+}
+
 //security errors
 
+// CredentialsPolicyError is returned when a login or a password breaks a registration rule.
+// Rule is a short rule name for clients, Message explains it.
+type CredentialsPolicyError struct {
+	Rule    string
+	Message string
+}
+
+func (e *CredentialsPolicyError) Error() string {
+	return fmt.Sprintf("%s (rule `%s`)", e.Message, e.Rule)
+}
+
 var errJWTTokenIsNotValid = errors.New("jwt token is not valid")
 
 func MakeErrJWTTokenIsNotValid() error {
@@ -48,6 +152,39 @@ func MakeErrWrongLoginOrPassword() error {
 	return errWrongLoginOrPassword
 }
 
+var errRefreshTokenNotFound error = errors.New("refresh token not found")
+
+func MakeErrRefreshTokenNotFound() error {
+	return errRefreshTokenNotFound
+}
+
+var errRefreshTokenExpired error = errors.New("refresh token expired")
+
+func MakeErrRefreshTokenExpired() error {
+	return errRefreshTokenExpired
+}
+
+// refresh token was used or revoked before, so it could be stolen, its whole family is revoked
+var errRefreshTokenReused error = errors.New("refresh token reuse")
+
+func MakeErrRefreshTokenReused() error {
+	return errRefreshTokenReused
+}
+
+// a reset token is unknown, expired or was already used
+var errPasswordResetTokenNotValid error = errors.New("password reset token is not valid")
+
+func MakeErrPasswordResetTokenNotValid() error {
+	return errPasswordResetTokenNotValid
+}
+
+// an api key is unknown or was revoked
+var errAPIKeyNotFound error = errors.New("api key wasn`t found")
+
+func MakeErrAPIKeyNotFound() error {
+	return errAPIKeyNotFound
+}
+
 //business errors
 
 var errNotEnoughPoints error = errors.New("not enough points")
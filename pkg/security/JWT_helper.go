@@ -1,35 +1,202 @@
 package security
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v4"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 	gophermart_errors "yandex_gophermart/pkg/errors"
 )
 
 const JWTCookieName = "auth_JWT_token"
-const secretKey = "SuperSecretKeyPart"
+
+const (
+	defaultJWTTTL       = time.Hour * 72
+	minJWTSecretLen     = 32
+	minRSAKeyBits       = 2048
+	generatedJWTKeyID   = "generated"
+	generatedJWTKeySize = 32
+)
+
+// JWTSettings are signing keys by their ids ("kid" header). A token is signed with SigningKeyID key
+// and is accepted if it was signed with any of Keys, so old keys stay here while tokens signed with them are alive.
+// A key is an HMAC secret (HS256) or a PEM encoded RSA (RS256) or Ed25519 (EdDSA) key. A PEM public key
+// can only check tokens, it is used for a retired key, whose private part is already deleted.
+type JWTSettings struct {
+	Keys         map[string]string
+	SigningKeyID string
+	TTL          time.Duration
+}
 
 type JWTHelper struct {
+	keys         map[string]jwtKey
+	signingKeyID string
+	ttl          time.Duration
+}
+
+type jwtKey struct {
+	method    jwt.SigningMethod
+	signKey   any //nil for a public key
+	verifyKey any
+}
+
+// NewJWTHelper checks keys. Without keys a random one is generated, so tokens are valid until a restart only.
+func NewJWTHelper(settings JWTSettings) (*JWTHelper, error) {
+	keys := make(map[string]jwtKey, len(settings.Keys))
+	for id, value := range settings.Keys {
+		key, err := parseJWTKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("wrong jwt key `%s`, err: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	signingKeyID := settings.SigningKeyID
+	if len(keys) == 0 {
+		secret := make([]byte, generatedJWTKeySize)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, errors.Join(errors.New("cant generate a jwt key"), err)
+		}
+		signingKeyID = generatedJWTKeyID
+		keys[signingKeyID] = makeHMACKey([]byte(hex.EncodeToString(secret)))
+	} else if signingKeyID == "" && len(keys) == 1 {
+		for id := range keys {
+			signingKeyID = id
+		}
+	}
+	if key, ok := keys[signingKeyID]; !ok {
+		return nil, fmt.Errorf("jwt signing key `%s` is not among keys %v", signingKeyID, keyIDs(keys))
+	} else if key.signKey == nil {
+		return nil, fmt.Errorf("jwt signing key `%s` is a public key, tokens cant be signed with it", signingKeyID)
+	}
+
+	ttl := settings.TTL
+	if ttl <= 0 {
+		ttl = defaultJWTTTL
+	}
+
+	return &JWTHelper{
+		keys:         keys,
+		signingKeyID: signingKeyID,
+		ttl:          ttl,
+	}, nil
 }
 
-func NewJWTHelper() *JWTHelper {
-	return &JWTHelper{}
+func makeHMACKey(secret []byte) jwtKey {
+	return jwtKey{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// parseJWTKey recognizes PEM keys by a "-----BEGIN" prefix, anything else is an HMAC secret.
+func parseJWTKey(value string) (jwtKey, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		if len(value) < minJWTSecretLen {
+			return jwtKey{}, fmt.Errorf("an hmac secret should have at least %d bytes", minJWTSecretLen)
+		}
+		return makeHMACKey([]byte(value)), nil
+	}
+
+	block, _ := pem.Decode([]byte(strings.TrimSpace(value)))
+	if block == nil {
+		return jwtKey{}, errors.New("cant decode a pem block")
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported pem block `%s`", block.Type)
+	}
+	if err != nil {
+		return jwtKey{}, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return jwtKey{}, fmt.Errorf("an rsa key should have at least %d bits", minRSAKeyBits)
+		}
+		return jwtKey{method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		//a retired key only checks tokens, but a short one still lets tokens be forged
+		if key.N.BitLen() < minRSAKeyBits {
+			return jwtKey{}, fmt.Errorf("an rsa key should have at least %d bits", minRSAKeyBits)
+		}
+		return jwtKey{method: jwt.SigningMethodRS256, verifyKey: key}, nil
+	case ed25519.PrivateKey:
+		return jwtKey{method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}, nil
+	case ed25519.PublicKey:
+		return jwtKey{method: jwt.SigningMethodEdDSA, verifyKey: key}, nil
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported key type %T, only rsa and ed25519 keys can be used", parsed)
+	}
+}
+
+func keyIDs(keys map[string]jwtKey) []string {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 type claims struct {
 	UserID int
+	Roles  []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// todo: улучшить секурность, почитать про разные методы подписи
-func (j *JWTHelper) BuildNewJWTString(userID int) (string, error) {
+// TokenClaims are claims of a checked token. ID ("jti") is used to revoke a token before it expires,
+// IssuedAt - to revoke all tokens of a user issued before a password change.
+// Roles are roles of a user at the moment a token was issued.
+type TokenClaims struct {
+	UserID    int
+	Roles     []string
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// HasRole says if a token gives a role.
+func (c TokenClaims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+func (j *JWTHelper) BuildNewJWTString(userID int, roles []string) (string, error) {
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := claims{
-		UserID:           userID,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72))},
+		UserID: userID,
+		Roles:  roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.ttl)),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	stringToken, err := token.SignedString([]byte(secretKey))
+	key := j.keys[j.signingKeyID]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = j.signingKeyID
+	stringToken, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -37,19 +204,37 @@ func (j *JWTHelper) BuildNewJWTString(userID int) (string, error) {
 	return stringToken, nil
 }
 
-// todo: улучшить секурность, почитать про работу функции возврата секрета
-func (j *JWTHelper) GetUserID(token string) (int, error) {
+// ParseToken checks a token with a key from its "kid" header, a token algorithm should be the key one.
+// Any broken, expired or unknown token gives an error, which is gophermart_errors.MakeErrJWTTokenIsNotValid().
+func (j *JWTHelper) ParseToken(token string) (TokenClaims, error) {
 	claims := claims{}
 
-	tokenGot, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
+	tokenGot, err := jwt.ParseWithClaims(token, &claims, j.keyFunc)
 	if err != nil {
-		return -1, err
+		return TokenClaims{}, errors.Join(gophermart_errors.MakeErrJWTTokenIsNotValid(), err)
 	}
-	if !tokenGot.Valid {
-		return -1, gophermart_errors.MakeErrJWTTokenIsNotValid()
+	if !tokenGot.Valid || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return TokenClaims{}, gophermart_errors.MakeErrJWTTokenIsNotValid()
 	}
 
-	return claims.UserID, nil
+	return TokenClaims{
+		UserID:    claims.UserID,
+		Roles:     claims.Roles,
+		ID:        claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+func (j *JWTHelper) keyFunc(token *jwt.Token) (interface{}, error) {
+	keyID, _ := token.Header["kid"].(string)
+	key, ok := j.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key `%s`", keyID)
+	}
+	//an algorithm is taken from a token, so a public key mustn`t be used as an hmac secret
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("jwt key `%s` is for %s, but a token is signed with %s", keyID, key.method.Alg(), token.Method.Alg())
+	}
+	return key.verifyKey, nil
 }
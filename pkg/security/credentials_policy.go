@@ -0,0 +1,151 @@
+package security
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+// Rules of registration credentials, they are returned to clients in gophermart_errors.CredentialsPolicyError.
+const (
+	RuleLoginLength        = "login_length"
+	RuleLoginCharset       = "login_charset"
+	RulePasswordMinLength  = "password_min_length"
+	RulePasswordMaxLength  = "password_max_length"
+	RulePasswordComplexity = "password_complexity"
+	RulePasswordCommon     = "password_common"
+)
+
+// loginSymbols are allowed in logins besides latin letters and digits.
+const loginSymbols = "._-"
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// CredentialsPolicySettings are registration rules. Lengths are in characters. PasswordMinCharClasses is
+// how many kinds of characters (lowercase, uppercase, digits, other symbols) a password should have.
+// PasswordMaxBytes limits a password in bytes for hash algorithms, which can`t take longer ones (zero means no limit).
+type CredentialsPolicySettings struct {
+	LoginMinLength         int
+	LoginMaxLength         int
+	PasswordMinLength      int
+	PasswordMaxLength      int
+	PasswordMaxBytes       int
+	PasswordMinCharClasses int
+	RejectCommonPasswords  bool
+}
+
+var DefaultCredentialsPolicySettings = CredentialsPolicySettings{
+	LoginMinLength:         3,
+	LoginMaxLength:         64,
+	PasswordMinLength:      8,
+	PasswordMaxLength:      128,
+	PasswordMinCharClasses: 1,
+	RejectCommonPasswords:  true,
+}
+
+type CredentialsPolicy struct {
+	settings        CredentialsPolicySettings
+	commonPasswords map[string]struct{}
+}
+
+func NewCredentialsPolicy(settings CredentialsPolicySettings) (*CredentialsPolicy, error) {
+	if settings.LoginMinLength < 1 || settings.LoginMaxLength < settings.LoginMinLength {
+		return nil, fmt.Errorf("wrong login length limits %d-%d", settings.LoginMinLength, settings.LoginMaxLength)
+	}
+	//logins are kept in VARCHAR(255)
+	if settings.LoginMaxLength > 255 {
+		return nil, fmt.Errorf("login max length %d is more than 255", settings.LoginMaxLength)
+	}
+	if settings.PasswordMinLength < 1 || settings.PasswordMaxLength < settings.PasswordMinLength {
+		return nil, fmt.Errorf("wrong password length limits %d-%d", settings.PasswordMinLength, settings.PasswordMaxLength)
+	}
+	if settings.PasswordMaxBytes < 0 {
+		return nil, fmt.Errorf("password max bytes should not be negative, got %d", settings.PasswordMaxBytes)
+	}
+	if settings.PasswordMinCharClasses < 0 || settings.PasswordMinCharClasses > 4 {
+		return nil, fmt.Errorf("password min char classes should be from 0 to 4, got %d", settings.PasswordMinCharClasses)
+	}
+
+	policy := &CredentialsPolicy{settings: settings}
+	if settings.RejectCommonPasswords {
+		policy.commonPasswords = make(map[string]struct{})
+		for _, line := range strings.Split(commonPasswordsList, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			policy.commonPasswords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return policy, nil
+}
+
+// Check returns *gophermart_errors.CredentialsPolicyError with the first broken rule, login rules are checked first.
+func (c *CredentialsPolicy) Check(login string, password string) error {
+	loginLength := utf8.RuneCountInString(login)
+	if loginLength < c.settings.LoginMinLength || loginLength > c.settings.LoginMaxLength {
+		return policyError(RuleLoginLength, "login should have from %d to %d characters", c.settings.LoginMinLength, c.settings.LoginMaxLength)
+	}
+	for _, r := range login {
+		if !isLoginRune(r) {
+			return policyError(RuleLoginCharset, "login may contain latin letters, digits and `%s` only", loginSymbols)
+		}
+	}
+	return c.CheckPassword(password)
+}
+
+// CheckPassword checks password rules only, it is used when a password of an existing user is changed.
+func (c *CredentialsPolicy) CheckPassword(password string) error {
+	passwordLength := utf8.RuneCountInString(password)
+	if passwordLength < c.settings.PasswordMinLength {
+		return policyError(RulePasswordMinLength, "password should have at least %d characters", c.settings.PasswordMinLength)
+	}
+	if passwordLength > c.settings.PasswordMaxLength {
+		return policyError(RulePasswordMaxLength, "password should have at most %d characters", c.settings.PasswordMaxLength)
+	}
+	if c.settings.PasswordMaxBytes > 0 && len(password) > c.settings.PasswordMaxBytes {
+		return policyError(RulePasswordMaxLength, "password should have at most %d bytes", c.settings.PasswordMaxBytes)
+	}
+	if charClasses(password) < c.settings.PasswordMinCharClasses {
+		return policyError(RulePasswordComplexity, "password should have at least %d of: lowercase letters, uppercase letters, digits, other symbols", c.settings.PasswordMinCharClasses)
+	}
+	if _, ok := c.commonPasswords[strings.ToLower(password)]; ok {
+		return policyError(RulePasswordCommon, "password is too common")
+	}
+	return nil
+}
+
+func policyError(rule string, format string, args ...any) error {
+	return &gophermart_errors.CredentialsPolicyError{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+func isLoginRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || strings.ContainsRune(loginSymbols, r)
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			classes++
+		}
+	}
+	return classes
+}
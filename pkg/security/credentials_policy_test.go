@@ -0,0 +1,46 @@
+package security
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	gophermart_errors "yandex_gophermart/pkg/errors"
+)
+
+func TestCredentialsPolicy_CheckPassword(t *testing.T) {
+	bcryptSettings := DefaultCredentialsPolicySettings
+	bcryptSettings.PasswordMaxBytes = BcryptMaxPasswordBytes
+
+	tests := []struct {
+		name     string
+		settings CredentialsPolicySettings
+		password string
+		wantRule string
+	}{
+		{name: "normal", settings: DefaultCredentialsPolicySettings, password: "correct horse battery"},
+		{name: "too short", settings: DefaultCredentialsPolicySettings, password: "horse", wantRule: RulePasswordMinLength},
+		{name: "too long", settings: DefaultCredentialsPolicySettings, password: strings.Repeat("horse", 30), wantRule: RulePasswordMaxLength},
+		{name: "common", settings: DefaultCredentialsPolicySettings, password: "password", wantRule: RulePasswordCommon},
+		{name: "80 bytes without a byte limit", settings: DefaultCredentialsPolicySettings, password: strings.Repeat("ж", 40)},
+		{name: "72 bytes with bcrypt", settings: bcryptSettings, password: strings.Repeat("ж", 36)},
+		//40 characters are allowed, but bcrypt can`t take 80 bytes
+		{name: "80 bytes with bcrypt", settings: bcryptSettings, password: strings.Repeat("ж", 40), wantRule: RulePasswordMaxLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewCredentialsPolicy(tt.settings)
+			require.NoError(t, err, "cant make a policy")
+
+			err = policy.CheckPassword(tt.password)
+			if tt.wantRule == "" {
+				assert.NoError(t, err, "password is rejected")
+				return
+			}
+			var policyErr *gophermart_errors.CredentialsPolicyError
+			require.True(t, errors.As(err, &policyErr), "not a policy error: %v", err)
+			assert.Equal(t, tt.wantRule, policyErr.Rule, "wrong rule")
+		})
+	}
+}
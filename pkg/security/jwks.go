@@ -0,0 +1,53 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	//RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	//Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public parts of asymmetric keys, so other services can check tokens. HMAC keys are secret and are not published.
+func (j *JWTHelper) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(j.keys))}
+	for _, id := range keyIDs(j.keys) {
+		key := j.keys[id]
+		jwk := JWK{
+			KeyID:     id,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,123 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+)
+
+// testEd25519Key makes an ed25519 key and its private and public PEMs
+func testEd25519Key(t *testing.T) (ed25519.PublicKey, string, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err, "cant generate an ed25519 key")
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err, "cant marshal an ed25519 key")
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err, "cant marshal an ed25519 public key")
+	return public,
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
+
+func TestJWTHelper_AsymmetricKeys(t *testing.T) {
+	rsaKey, rsaPrivate, _ := testRSAKey(t, 2048)
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	_, edPrivate, _ := testEd25519Key(t)
+
+	tests := []struct {
+		name    string
+		key     string
+		wantAlg string
+	}{
+		{name: "rsa pkcs8", key: rsaPrivate, wantAlg: "RS256"},
+		{name: "rsa pkcs1", key: pkcs1, wantAlg: "RS256"},
+		{name: "ed25519", key: edPrivate, wantAlg: "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helper, err := NewJWTHelper(JWTSettings{Keys: map[string]string{"k1": tt.key}})
+			require.NoError(t, err, "cant make a helper")
+			token, err := helper.BuildNewJWTString(7, []string{"admin"})
+			require.NoError(t, err, "cant build a token")
+
+			claims, err := helper.ParseToken(token)
+			require.NoError(t, err, "cant parse a token")
+			assert.Equal(t, 7, claims.UserID, "wrong user")
+			assert.Equal(t, []string{"admin"}, claims.Roles, "wrong roles")
+			assert.Equal(t, tt.wantAlg, helper.JWKS().Keys[0].Algorithm, "wrong algorithm")
+		})
+	}
+}
+
+func TestParseJWTKey_ShortRSAKey(t *testing.T) {
+	_, private, public := testRSAKey(t, 1024)
+
+	_, err := NewJWTHelper(JWTSettings{Keys: map[string]string{"k1": private}})
+	assert.Error(t, err, "short rsa key is accepted")
+	//a retired public key also checks tokens, so it needs the same size
+	_, err = NewJWTHelper(JWTSettings{Keys: map[string]string{"old": public, "new": testHMACSecret}, SigningKeyID: "new"})
+	assert.Error(t, err, "short rsa public key is accepted")
+}
+
+func TestJWTHelper_JWKS(t *testing.T) {
+	rsaKey, rsaPrivate, _ := testRSAKey(t, 2048)
+	_, _, rsaPublic := testRSAKey(t, 2048)
+	edKey, edPrivate, _ := testEd25519Key(t)
+
+	helper, err := NewJWTHelper(JWTSettings{
+		Keys: map[string]string{
+			"rsa":     rsaPrivate,
+			"retired": rsaPublic,
+			"ed":      edPrivate,
+			"hmac":    testHMACSecret,
+		},
+		SigningKeyID: "rsa",
+	})
+	require.NoError(t, err, "cant make a helper")
+
+	set := helper.JWKS()
+	ids := make([]string, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		ids = append(ids, key.KeyID)
+		assert.Equal(t, "sig", key.Use, "wrong key use")
+	}
+	//hmac secrets are never published
+	require.Equal(t, []string{"ed", "retired", "rsa"}, ids, "wrong published keys")
+
+	ed := set.Keys[0]
+	assert.Equal(t, "OKP", ed.KeyType, "wrong ed25519 key type")
+	assert.Equal(t, "Ed25519", ed.Curve, "wrong curve")
+	assert.Equal(t, "EdDSA", ed.Algorithm, "wrong ed25519 algorithm")
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	require.NoError(t, err, "x isn`t base64url")
+	assert.Equal(t, []byte(edKey), x, "wrong ed25519 public key")
+	assert.Empty(t, ed.N, "ed25519 key has rsa fields")
+
+	rsaJWK := set.Keys[2]
+	assert.Equal(t, "RSA", rsaJWK.KeyType, "wrong rsa key type")
+	assert.Equal(t, "RS256", rsaJWK.Algorithm, "wrong rsa algorithm")
+	n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	require.NoError(t, err, "n isn`t base64url")
+	assert.Equal(t, 0, rsaKey.N.Cmp(new(big.Int).SetBytes(n)), "wrong modulus")
+	e, err := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	require.NoError(t, err, "e isn`t base64url")
+	//65537 is published as "AQAB" without leading zeros
+	assert.Equal(t, "AQAB", rsaJWK.E, "wrong exponent encoding")
+	assert.Equal(t, int64(rsaKey.E), new(big.Int).SetBytes(e).Int64(), "wrong exponent")
+	assert.Empty(t, rsaJWK.X, "rsa key has ed25519 fields")
+}
+
+func TestJWTHelper_JWKSWithoutPublicKeys(t *testing.T) {
+	helper, err := NewJWTHelper(JWTSettings{})
+	require.NoError(t, err, "cant make a helper")
+	set := helper.JWKS()
+	assert.NotNil(t, set.Keys, "keys should be an empty list, not null")
+	assert.Empty(t, set.Keys, "generated hmac key is published")
+}
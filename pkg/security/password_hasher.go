@@ -0,0 +1,162 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+
+	//bcrypt doesn`t take longer passwords
+	BcryptMaxPasswordBytes = 72
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// PasswordHashSettings choose an algorithm for new hashes and its cost.
+type PasswordHashSettings struct {
+	Algorithm     string
+	Argon2Time    uint32
+	Argon2Memory  uint32 //KiB
+	Argon2Threads uint8
+	BcryptCost    int
+}
+
+// DefaultPasswordHashSettings follow OWASP recommendations.
+var DefaultPasswordHashSettings = PasswordHashSettings{
+	Algorithm:     PasswordHashArgon2id,
+	Argon2Time:    2,
+	Argon2Memory:  19 * 1024,
+	Argon2Threads: 1,
+	BcryptCost:    bcrypt.DefaultCost,
+}
+
+// PasswordHasher makes password hashes in PHC string format (`$argon2id$v=19$m=...,t=...,p=...$salt$hash`)
+// or in bcrypt format (`$2a$cost$...`), so an algorithm and its params are stored with every hash.
+type PasswordHasher struct {
+	settings PasswordHashSettings
+	//a hash of a random password with current settings, unknown logins are checked against it
+	dummyHash string
+}
+
+func NewPasswordHasher(settings PasswordHashSettings) (*PasswordHasher, error) {
+	switch settings.Algorithm {
+	case PasswordHashArgon2id:
+		if settings.Argon2Time == 0 || settings.Argon2Memory == 0 || settings.Argon2Threads == 0 {
+			return nil, errors.New("argon2id time, memory and threads should be positive")
+		}
+	case PasswordHashBcrypt:
+		if settings.BcryptCost < bcrypt.MinCost || settings.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost should be in [%d, %d]", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm `%s`", settings.Algorithm)
+	}
+	h := &PasswordHasher{settings: settings}
+	dummyPassword := make([]byte, 16)
+	_, err := rand.Read(dummyPassword)
+	if err != nil {
+		return nil, errors.Join(errors.New("error while generating a dummy password"), err)
+	}
+	h.dummyHash, err = h.Hash(base64.RawStdEncoding.EncodeToString(dummyPassword))
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Hash makes a new hash with a random salt.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.settings.Algorithm == PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.settings.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("cant hash a password with bcrypt, err: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.Join(errors.New("error while generating password salt"), err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.settings.Argon2Time, h.settings.Argon2Memory, h.settings.Argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", PasswordHashArgon2id, argon2.Version,
+		h.settings.Argon2Memory, h.settings.Argon2Time, h.settings.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks a password against a stored hash. Hashes without a "$" prefix are legacy SHA-256 ones,
+// they need a separately stored salt. needsRehash is true if a hash was made by another algorithm or with other params.
+func (h *PasswordHasher) Verify(password string, encoded string, legacySalt string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+PasswordHashArgon2id+"$"):
+		return h.verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		} else if err != nil {
+			return false, false, fmt.Errorf("cant check a bcrypt hash, err: %w", err)
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, fmt.Errorf("cant get a bcrypt hash cost, err: %w", err)
+		}
+		return true, h.settings.Algorithm != PasswordHashBcrypt || cost != h.settings.BcryptCost, nil
+	case strings.HasPrefix(encoded, "$"):
+		return false, false, errors.New("unknown password hash format")
+	default:
+		return CheckPassword(password, encoded, legacySalt), true, nil
+	}
+}
+
+// VerifyDummy checks a password against a hash of a random password, so a login of an unknown user
+// takes as long as a login of a known one and doesn`t show which logins exist.
+func (h *PasswordHasher) VerifyDummy(password string) {
+	h.Verify(password, h.dummyHash, "")
+}
+
+func (h *PasswordHasher) verifyArgon2id(password string, encoded string) (bool, bool, error) {
+	//"", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, errors.New("malformed argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2id hash version `%s`", parts[2])
+	}
+	var memory, time uint32
+	var threads uint8
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if err != nil {
+		return false, false, fmt.Errorf("malformed argon2id hash params, err: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("malformed argon2id hash salt, err: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("malformed argon2id hash key, err: %w", err)
+	}
+
+	gotKey := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, gotKey) != 1 {
+		return false, false, nil
+	}
+	needsRehash := h.settings.Algorithm != PasswordHashArgon2id || memory != h.settings.Argon2Memory ||
+		time != h.settings.Argon2Time || threads != h.settings.Argon2Threads
+	return true, needsRehash, nil
+}
@@ -0,0 +1,163 @@
+package security
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// cheap settings keep tests fast, they aren`t used anywhere else
+var (
+	testArgon2Settings = PasswordHashSettings{Algorithm: PasswordHashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+	testBcryptSettings = PasswordHashSettings{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func TestNewPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings PasswordHashSettings
+		wantErr  bool
+	}{
+		{name: "argon2id", settings: testArgon2Settings},
+		{name: "bcrypt", settings: testBcryptSettings},
+		{name: "argon2id without memory", settings: PasswordHashSettings{Algorithm: PasswordHashArgon2id, Argon2Time: 1, Argon2Threads: 1}, wantErr: true},
+		{name: "bcrypt cost too high", settings: PasswordHashSettings{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MaxCost + 1}, wantErr: true},
+		{name: "unknown algorithm", settings: PasswordHashSettings{Algorithm: "md5"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPasswordHasher(tt.settings)
+			assert.Equal(t, tt.wantErr, err != nil, "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestPasswordHasher_HashAndVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings PasswordHashSettings
+		prefix   string
+	}{
+		{name: "argon2id", settings: testArgon2Settings, prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{name: "bcrypt", settings: testBcryptSettings, prefix: "$2a$04$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher, err := NewPasswordHasher(tt.settings)
+			require.NoError(t, err, "cant make a hasher")
+
+			hash, err := hasher.Hash("correct horse")
+			require.NoError(t, err, "cant hash a password")
+			assert.True(t, strings.HasPrefix(hash, tt.prefix), "wrong hash format: %s", hash)
+
+			otherHash, err := hasher.Hash("correct horse")
+			require.NoError(t, err, "cant hash a password")
+			assert.NotEqual(t, hash, otherHash, "hashes of one password have the same salt")
+
+			ok, needsRehash, err := hasher.Verify("correct horse", hash, "")
+			assert.NoError(t, err, "cant verify a password")
+			assert.True(t, ok, "correct password isn`t accepted")
+			assert.False(t, needsRehash, "fresh hash needs a rehash")
+
+			ok, _, err = hasher.Verify("wrong horse", hash, "")
+			assert.NoError(t, err, "cant verify a password")
+			assert.False(t, ok, "wrong password is accepted")
+		})
+	}
+}
+
+func TestPasswordHasher_VerifyPHC(t *testing.T) {
+	hasher, err := NewPasswordHasher(testArgon2Settings)
+	require.NoError(t, err, "cant make a hasher")
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err, "cant hash a password")
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "valid hash", encoded: hash, wantOk: true},
+		{name: "missing part", encoded: strings.Join(parts[:5], "$"), wantErr: true},
+		{name: "unsupported version", encoded: strings.Join([]string{"", parts[1], "v=16", parts[3], parts[4], parts[5]}, "$"), wantErr: true},
+		{name: "malformed params", encoded: strings.Join([]string{"", parts[1], parts[2], "m=x,t=1,p=1", parts[4], parts[5]}, "$"), wantErr: true},
+		{name: "malformed salt", encoded: strings.Join([]string{"", parts[1], parts[2], parts[3], "!!!", parts[5]}, "$"), wantErr: true},
+		{name: "malformed key", encoded: strings.Join([]string{"", parts[1], parts[2], parts[3], parts[4], "!!!"}, "$"), wantErr: true},
+		{name: "unknown algorithm", encoded: "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := hasher.Verify("password", tt.encoded, "")
+			assert.Equal(t, tt.wantErr, err != nil, "unexpected error: %v", err)
+			assert.Equal(t, tt.wantOk, ok, "wrong check result")
+		})
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	argon2Hasher, err := NewPasswordHasher(testArgon2Settings)
+	require.NoError(t, err, "cant make a hasher")
+	bcryptHasher, err := NewPasswordHasher(testBcryptSettings)
+	require.NoError(t, err, "cant make a hasher")
+	strongerSettings := testArgon2Settings
+	strongerSettings.Argon2Time = 2
+	strongerHasher, err := NewPasswordHasher(strongerSettings)
+	require.NoError(t, err, "cant make a hasher")
+
+	argon2Hash, err := argon2Hasher.Hash("password")
+	require.NoError(t, err, "cant hash a password")
+	bcryptHash, err := bcryptHasher.Hash("password")
+	require.NoError(t, err, "cant hash a password")
+
+	tests := []struct {
+		name            string
+		hasher          *PasswordHasher
+		encoded         string
+		legacySalt      string
+		wantNeedsRehash bool
+	}{
+		{name: "same settings", hasher: argon2Hasher, encoded: argon2Hash},
+		{name: "other argon2id params", hasher: strongerHasher, encoded: argon2Hash, wantNeedsRehash: true},
+		{name: "bcrypt hash, argon2id settings", hasher: argon2Hasher, encoded: bcryptHash, wantNeedsRehash: true},
+		{name: "argon2id hash, bcrypt settings", hasher: bcryptHasher, encoded: argon2Hash, wantNeedsRehash: true},
+		{name: "legacy sha-256 hash", hasher: argon2Hasher, encoded: HashPassword("password", "salt"), legacySalt: "salt", wantNeedsRehash: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := tt.hasher.Verify("password", tt.encoded, tt.legacySalt)
+			assert.NoError(t, err, "cant verify a password")
+			assert.True(t, ok, "correct password isn`t accepted")
+			assert.Equal(t, tt.wantNeedsRehash, needsRehash, "wrong rehash flag")
+		})
+	}
+}
+
+func TestPasswordHasher_VerifyLegacy(t *testing.T) {
+	hasher, err := NewPasswordHasher(testArgon2Settings)
+	require.NoError(t, err, "cant make a hasher")
+	legacyHash := HashPassword("password", "salt")
+
+	ok, _, err := hasher.Verify("password", legacyHash, "other salt")
+	assert.NoError(t, err, "cant verify a password")
+	assert.False(t, ok, "legacy hash is accepted with a wrong salt")
+
+	ok, _, err = hasher.Verify("wrong", legacyHash, "salt")
+	assert.NoError(t, err, "cant verify a password")
+	assert.False(t, ok, "wrong password is accepted by a legacy hash")
+}
+
+func TestPasswordHasher_DummyHash(t *testing.T) {
+	hasher, err := NewPasswordHasher(testArgon2Settings)
+	require.NoError(t, err, "cant make a hasher")
+
+	//a dummy hash is made with the same settings, so it costs as much as a real one
+	assert.True(t, strings.HasPrefix(hasher.dummyHash, "$argon2id$v=19$m=64,t=1,p=1$"), "wrong dummy hash format: %s", hasher.dummyHash)
+	ok, _, err := hasher.Verify("password", hasher.dummyHash, "")
+	assert.NoError(t, err, "dummy hash can`t be verified")
+	assert.False(t, ok, "dummy hash accepts a password")
+	hasher.VerifyDummy("password")
+}
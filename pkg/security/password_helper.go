@@ -1,15 +1,12 @@
 package security
 
 import (
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
+	"crypto/subtle"
 	"encoding/hex"
-	"errors"
 )
 
-const passwordSaltLen int = 6
-
+// HashPassword makes a legacy SHA-256 hash. It is kept only to check old hashes, new ones are made by PasswordHasher.
 func HashPassword(password string, salt string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(password))
@@ -19,14 +16,5 @@ func HashPassword(password string, salt string) string {
 
 // CheckPassword returns TRUE if password is CORRECT
 func CheckPassword(password string, passwordHash string, passwordSalt string) bool {
-	return HashPassword(password, passwordSalt) == passwordHash
-}
-
-func GenPasswordSalt() (string, error) {
-	bytes := make([]byte, passwordSaltLen)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		return "", errors.Join(errors.New("error while generating password salt"), err)
-	}
-	return base64.URLEncoding.EncodeToString(bytes), nil
+	return subtle.ConstantTimeCompare([]byte(HashPassword(password, passwordSalt)), []byte(passwordHash)) == 1
 }
@@ -0,0 +1,91 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	RefreshTokenCookieName = "refresh_token"
+	opaqueTokenSize        = 32
+	tokenIDSize            = 16
+	apiKeyPrefix           = "gm_"
+	apiKeyShownLength      = len(apiKeyPrefix) + 8
+)
+
+// NewRefreshToken makes a random token, which is given to a client, and its hash, which is stored.
+func NewRefreshToken() (token string, hash string, err error) {
+	token, err = newOpaqueToken()
+	if err != nil {
+		return "", "", errors.Join(errors.New("error while generating a refresh token"), err)
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken is enough to be a plain SHA-256, because a token is random and long.
+func HashRefreshToken(token string) string {
+	return hashOpaqueToken(token)
+}
+
+// NewPasswordResetToken makes a random single-use token, which is sent to a user, and its hash, which is stored.
+func NewPasswordResetToken() (token string, hash string, err error) {
+	token, err = newOpaqueToken()
+	if err != nil {
+		return "", "", errors.Join(errors.New("error while generating a password reset token"), err)
+	}
+	return token, HashPasswordResetToken(token), nil
+}
+
+func HashPasswordResetToken(token string) string {
+	return hashOpaqueToken(token)
+}
+
+// NewTokenID makes a random id for a "jti" claim or a refresh token family.
+func NewTokenID() (string, error) {
+	bytes := make([]byte, tokenIDSize)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", errors.Join(errors.New("error while generating a token id"), err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func newOpaqueToken() (string, error) {
+	bytes := make([]byte, opaqueTokenSize)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey makes a random key of a merchant and its hash, which is stored. A key has a prefix,
+// so leaked keys are easy to find in logs and code.
+func NewAPIKey() (key string, hash string, err error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", "", errors.Join(errors.New("error while generating an api key"), err)
+	}
+	key = apiKeyPrefix + token
+	return key, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	return hashOpaqueToken(key)
+}
+
+// APIKeyPrefix returns the beginning of a key, which is stored as is to tell keys apart.
+func APIKeyPrefix(key string) string {
+	if len(key) < apiKeyShownLength {
+		return key
+	}
+	return key[:apiKeyShownLength]
+}